@@ -21,6 +21,7 @@ app.get('/health', (req, res) => {
 // Insurance (Registration) Routes
 app.post('/insurance/definePolicy', insuranceController.definePolicy);//tested
 app.get('/insurance/queryPolicy/:policyID', insuranceController.queryPolicy);//tested
+app.post('/insurance/enrolMember', insuranceController.enrolMember);
 app.post('/insurance/registerForPolicy', insuranceController.registerForPolicy);//tested
 app.get('/insurance/queryRegistration/:userId/:policyId', insuranceController.queryRegistration);//tested
 app.post('/insurance/uploadHealthRecords', insuranceController.uploadHealthRecords);//tested
@@ -31,7 +32,10 @@ app.get('/insurance/queryAllPolicies', insuranceController.queryAllPolicies);
 // Claims Routes
 app.post('/claims/uploadPatientDetails', claimsController.uploadPatientDetails);//tested
 app.post('/claims/processClaim', claimsController.processClaim);
-app.get('/claims/queryClaim/:userID', claimsController.queryClaim);
+app.post('/claims/processPendingClaims', claimsController.processPendingClaims);
+app.get('/claims/queryClaim/:claimID', claimsController.queryClaim);
+app.get('/claims/queryClaimsByUser/:userID', claimsController.queryClaimsByUser);
+app.get('/claims/queryClaimsByPolicy/:policyID', claimsController.queryClaimsByPolicy);
 app.get('/claims/queryAllPatientData', claimsController.queryAllPatientData);
 app.get('/claims/queryAllClaims', claimsController.queryAllClaims);
 
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -12,18 +13,42 @@ type SmartContract struct {
 }
 
 type Claim struct {
+	DocType          string  `json:"docType"`
+	ClaimID          string  `json:"claimId"`
 	UserID           string  `json:"userId"`
 	PolicyID         string  `json:"policyId"`
+	PayerRank        string  `json:"payerRank,omitempty"` // PayerPrimary or PayerSecondary under coordination of benefits
+	InsurerMSP       string  `json:"insurerMsp,omitempty"` // The policy's insurer when the claim was filed; empty on older claims
 	SettlementAmount float64 `json:"settlementAmount"`
+	OtherPayerPaid   float64 `json:"otherPayerPaid,omitempty"` // What the primary payer settled, on secondary claims
+	SettledAt        int64   `json:"settledAt,omitempty"` // When the settlement amount was approved
+	PaidAmount       float64 `json:"paidAmount"`
 	HospitalName     string  `json:"hospitalName"`
-	Status           string  `json:"status"` // Example: "Processed", "Pending"
+	ProviderID       string  `json:"providerId,omitempty"`
+	NetworkStatus    string  `json:"networkStatus,omitempty"`
+	Status           string  `json:"status"` // One of the Claim states in lifecycle.go
+	RejectionReasonCode string `json:"rejectionReasonCode,omitempty"`
+	EpisodeID        string  `json:"episodeId,omitempty"` // The episode of care the claim is for; empty on claims filed before episodes
+	Diagnosis        string  `json:"diagnosis"`
+	AdmissionDate    string  `json:"admissionDate"`
+	DischargeDate    string  `json:"dischargeDate"`
+	FraudFlags       []FraudFlag `json:"fraudFlags,omitempty"` // Set when screening sent the claim to manual review
+	PreAuthID        string  `json:"preAuthId,omitempty"`    // Set when the stay was pre-authorised at admission
+	BilledAmount     float64 `json:"billedAmount,omitempty"`
+	ClaimedAmount    float64 `json:"claimedAmount,omitempty"` // What the claim asked to settle before other payers and the remaining cover
+	BillLines        []BillLine `json:"billLines,omitempty"` // Set for claims settled from an itemised bill
+	AwaitingApprovalFor float64 `json:"awaitingApprovalFor,omitempty"` // Settlement held by automatic adjudication until adjusters approve it
+	Approvals        []ClaimApproval `json:"approvals,omitempty"` // Adjuster approvals, one per identity
+	History          []ClaimTransition `json:"history"`
 }
 
-// PatientDetails defines the structure for storing patient details in the private data collection
+// PatientDetails is a flat view of one episode of care, as listed by QueryAllPatientData
 type PatientDetails struct {
+	DocType        string `json:"docType"`
 	UserID         string `json:"userId"`
+	EpisodeID      string `json:"episodeId"`
 	DiseaseDiagnosis string `json:"diseaseDiagnosis"`
-	TreatmentPlan   string `json:"treatmentPlan"`
+	TreatmentPlan   string `json:"treatmentPlan,omitempty"` // Left out of the view given to insurers
 	HospitalName    string `json:"hospitalName"`
 	AdmissionDate   string `json:"admissionDate"`
 	DischargeDate   string `json:"dischargeDate"`
@@ -38,6 +63,7 @@ type Policy struct {
 	EndDate       string            `json:"endDate"`
 	Criteria      Criteria          `json:"criteria"` // Changed to Criteria struct
 	CoveredDiseases []string        `json:"coveredDiseases"`
+	InsurerMSP    string            `json:"insurerMsp,omitempty"`
 }
 
 type Criteria struct {
@@ -45,254 +71,367 @@ type Criteria struct {
 	HasDisease   bool `json:"hasDisease"`
 }
 
-var patientDetailsList = make(map[string]PatientDetails) // Map to store policies by policyID
-
-var claimDetailsList = make(map[string]Claim)
+// UploadPatientDetails allows a clinician to record a complete hospital stay in one go. It opens an episode
+// of care with the admission, diagnosis, treatment and discharge entries and returns the episode ID.
+func (s *SmartContract) UploadPatientDetails(ctx contractapi.TransactionContextInterface, userID string, diseaseDiagnosis string, treatmentPlan string, hospitalName string, admissionDate string, dischargeDate string) (string, error) {
+	if err := authorize(ctx, "upload patient details", providerClinician); err != nil {
+		return "", err
+	}
 
-// UploadPatientDetails allows Org1 to upload patient details to the PDC
-func (s *SmartContract) UploadPatientDetails(ctx contractapi.TransactionContextInterface, userID string, diseaseDiagnosis string, treatmentPlan string, hospitalName string, admissionDate string, dischargeDate string) error {
-	patientDetails := PatientDetails{
-		UserID:          userID,
-		DiseaseDiagnosis: diseaseDiagnosis,
-		TreatmentPlan:    treatmentPlan,
-		HospitalName:     hospitalName,
-		AdmissionDate:    admissionDate,
-		DischargeDate:    dischargeDate,
-		ClaimStatus:     "Pending",
+	// The episode is built up in memory, as writes are not readable until the transaction commits
+	episode, err := newEpisode(ctx, userID, hospitalName, admissionDate, "admitted")
+	if err != nil {
+		return "", err
 	}
 
-	patientDetailsList[userID]=patientDetails
-	// Serialize the patient details to JSON
-	patientDetailsJSON, err := json.Marshal(patientDetails)
+	diagnosis, err := newEpisodeEntry(ctx, "", diseaseDiagnosis)
 	if err != nil {
-		return fmt.Errorf("failed to serialize patient details: %v", err)
+		return "", err
+	}
+	episode.Diagnoses = append(episode.Diagnoses, diagnosis)
+
+	if treatmentPlan != "" {
+		treatment, err := newEpisodeEntry(ctx, "", treatmentPlan)
+		if err != nil {
+			return "", err
+		}
+		episode.Treatments = append(episode.Treatments, treatment)
 	}
 
+	if err := dischargeEpisode(ctx, episode, dischargeDate, "discharged"); err != nil {
+		return "", err
+	}
 
+	// Store the episode in the private data collection
+	if err := putEpisode(ctx, episode); err != nil {
+		return "", err
+	}
 
-	// Store the patient details in the private data collection
-	return ctx.GetStub().PutPrivateData("Org1MSPPrivateCollection", userID, patientDetailsJSON)
+	return episode.EpisodeID, nil
 }
 
-
-// / QueryAllPolicies retrieves all policies from the in-memory list or ledger
+// QueryAllPatientData returns every episode of care to clinicians. Insurers' adjusters and auditors get the
+// claim-relevant fields of their own members' claims instead, without the treatment plan.
 func (s *SmartContract) QueryAllPatientData(ctx contractapi.TransactionContextInterface) ([]PatientDetails, error) {
-	var patients []PatientDetails
+	isClinician, err := callerHolds(ctx, providerClinician)
+	if err != nil {
+		return nil, err
+	}
+	if isClinician {
+		return queryProviderPatientData(ctx)
+	}
+
+	if err := authorize(ctx, "list patient data", providerClinician, insurerAdjuster, insurerAuditor); err != nil {
+		return nil, err
+	}
+
+	return queryInsurerPatientData(ctx)
+}
 
-	// First, check if patients are available in the in-memory store
-	if len(patientDetailsList) > 0 {
-		for _, patient := range patientDetailsList {
-			patients = append(patients, patient)
+// queryProviderPatientData lists every episode of care in the episode collection
+func queryProviderPatientData(ctx contractapi.TransactionContextInterface) ([]PatientDetails, error) {
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(episodeCollection, "episode", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve episodes from the private data collection: %v", err)
+	}
+	defer iterator.Close()
+
+	var patients []PatientDetails
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next episode during iteration: %v", err)
 		}
-	} else {
-		// If no patients in-memory, query the ledger
-		startKey := ""
-		endKey := ""
 
-		iterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+		var episode Episode
+		err = json.Unmarshal(queryResponse.Value, &episode)
 		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve patients from ledger: %v", err)
+			return nil, fmt.Errorf("failed to unmarshal episode JSON from value: %v", err)
 		}
-		defer iterator.Close()
 
-		for iterator.HasNext() {
-			queryResponse, err := iterator.Next()
-			if err != nil {
-				return nil, fmt.Errorf("failed to retrieve next patient entry during iteration: %v", err)
-			}
+		var treatments []string
+		for _, treatment := range episode.Treatments {
+			treatments = append(treatments, treatment.Detail)
+		}
+		patient := PatientDetails{
+			DocType:          patientDetailsDocType,
+			UserID:           episode.UserID,
+			EpisodeID:        episode.EpisodeID,
+			DiseaseDiagnosis: principalDiagnosis(&episode),
+			TreatmentPlan:    strings.Join(treatments, "; "),
+			HospitalName:     episode.HospitalName,
+			AdmissionDate:    episode.Admission.Date,
+			ClaimStatus:      episode.ClaimStatus,
+		}
+		if episode.Discharge != nil {
+			patient.DischargeDate = episode.Discharge.Date
+		}
+
+		patients = append(patients, patient)
+	}
+
+	if len(patients) == 0 {
+		return nil, fmt.Errorf("no patients found in the private data collection")
+	}
+
+	return patients, nil
+}
+
+// queryInsurerPatientData lists one entry per claim filed under a policy the calling insurer defined
+func queryInsurerPatientData(ctx contractapi.TransactionContextInterface) ([]PatientDetails, error) {
+	reader, err := newClaimReader(ctx, "list patient data", insurerAdjuster, insurerAuditor)
+	if err != nil {
+		return nil, err
+	}
 
-			var patient PatientDetails
-			err = json.Unmarshal(queryResponse.Value, &patient)
-			if err != nil {
-				return nil, fmt.Errorf("failed to unmarshal patient JSON from value: %v", err)
-			}
+	iterator, err := ctx.GetStub().GetPrivateDataByRange(claimsCollection, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve claims: %v", err)
+	}
+	defer iterator.Close()
 
-			patients= append(patients, patient)
+	patients := []PatientDetails{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next claim entry during iteration: %v", err)
 		}
 
-		if len(patients) == 0 {
-			return nil, fmt.Errorf("no patients found in the ledger")
+		var claim Claim
+		err = json.Unmarshal(queryResponse.Value, &claim)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal claim JSON from value: %v", err)
 		}
+
+		readable, err := reader.canRead(ctx, &claim)
+		if err != nil {
+			return nil, err
+		}
+		if !readable {
+			continue
+		}
+
+		patients = append(patients, PatientDetails{
+			DocType:          patientDetailsDocType,
+			UserID:           claim.UserID,
+			EpisodeID:        claim.EpisodeID,
+			DiseaseDiagnosis: claim.Diagnosis,
+			HospitalName:     claim.HospitalName,
+			AdmissionDate:    claim.AdmissionDate,
+			DischargeDate:    claim.DischargeDate,
+			ClaimStatus:      claim.Status,
+		})
 	}
 
 	return patients, nil
 }
 
 
-// ProcessClaim processes a claim for a user and stores the claim details
-func (s *SmartContract) ProcessClaim(ctx contractapi.TransactionContextInterface, userID string) error {
-	// Step 1: Query the policy ID associated with the user from the RegistrationContract
-	args := [][]byte{[]byte("QueryPolicyByUserID"), []byte(userID)}
-	response := ctx.GetStub().InvokeChaincode("registration", args, "mychannel") // Use the channel name where RegistrationContract is deployed
-	
-	if response.Status != 200 {
-		return fmt.Errorf("failed to query policy for user %s from RegistrationContract: %v", userID, response.Message)
-	}
-	
-	policyID := string(response.Payload)
-	if policyID == "" {
-		return fmt.Errorf("no policy found for user %s", userID)
+// ProcessClaim files a claim for the user's one discharged episode of care that has not been claimed yet.
+// Patients with several such episodes must name the episode through ProcessEpisodeClaim.
+func (s *SmartContract) ProcessClaim(ctx contractapi.TransactionContextInterface, userID string) (string, error) {
+	if err := authorizeActingFor(ctx, userID, "claim"); err != nil {
+		return "", err
 	}
 
-	// Step 2: Retrieve the policy details using the policyID from RegistrationContract
-	args = [][]byte{[]byte("QueryPolicy"), []byte(policyID)}
-	response = ctx.GetStub().InvokeChaincode("registration", args, "mychannel") // channel name
-	
-	if response.Status != 200 {
-		return fmt.Errorf("failed to query policy details for policyID %s from RegistrationContract: %v", policyID, response.Message)
+	episode, err := pendingEpisode(ctx, userID)
+	if err != nil {
+		return "", err
 	}
 
-	var policy Policy
-	err := json.Unmarshal(response.Payload, &policy)
+	return s.ProcessEpisodeClaim(ctx, episode.EpisodeID)
+}
+
+// ProcessEpisodeClaim files a claim for a discharged episode of care, stores it under a new claim ID and returns that ID.
+// The member, a delegate covering claim or an adjuster of the member's insurer can file it.
+func (s *SmartContract) ProcessEpisodeClaim(ctx contractapi.TransactionContextInterface, episodeID string) (string, error) {
+	// Step 1: Fetch the episode from the episode collection; each episode is claimed once
+	episode, err := getEpisode(ctx, episodeID)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal policy details: %v", err)
+		return "", err
 	}
+	userID := episode.UserID
 
-	// Step 3: Fetch patient details from Org1's PDC
-	patientDetailsJSON, err := ctx.GetStub().GetPrivateData("Org1MSPPrivateCollection", userID)
-	if err != nil {
-		return fmt.Errorf("failed to fetch patient details: %v", err)
+	if err := authorizeActingFor(ctx, userID, "claim"); err != nil {
+		return "", err
+	}
+	if episode.Status != EpisodeDischarged {
+		return "", fmt.Errorf("episode %s is %s, only discharged episodes can be claimed", episodeID, episode.Status)
 	}
-	if patientDetailsJSON == nil {
-		return fmt.Errorf("patient details not found for user %s", userID)
+	if episode.ClaimID != "" {
+		return "", fmt.Errorf("episode %s has already been claimed under %s", episodeID, episode.ClaimID)
+	}
+	diagnosis := principalDiagnosis(episode)
+	if diagnosis == "" {
+		return "", fmt.Errorf("episode %s has no diagnosis to claim for", episodeID)
 	}
 
-	var patientDetails PatientDetails
-	err = json.Unmarshal(patientDetailsJSON, &patientDetails)
+	// Step 2: Look up the user's primary policy in the registration chaincode
+	var lookup PolicyLookup
+	err = invokeRegistration(ctx, "LookupPolicyForUser", []string{userID}, &lookup)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal patient details: %v", err)
+		return "", fmt.Errorf("failed to query policy for user %s: %v", userID, err)
 	}
-
-	// Step 4: Check if the disease diagnosed is covered by the policy
-	diseaseCovered := false
-	for _, disease := range policy.CoveredDiseases {
-		if disease == patientDetails.DiseaseDiagnosis {
-			diseaseCovered = true
-			break
-		}
+	if lookup.PolicyID == "" || lookup.Policy == nil {
+		return "", fmt.Errorf("no policy found for user %s", userID)
 	}
-	if !diseaseCovered {
-		return fmt.Errorf("disease %s is not covered by policy %s", patientDetails.DiseaseDiagnosis, policy.PolicyID)
+	if err := requireFilingInsurer(ctx, userID, lookup.PolicyID); err != nil {
+		return "", err
 	}
 
-	// Step 5: Calculate the settlement amount (e.g., 50% of the cover amount for simplicity)
-	settlementAmount := policy.CoverAmount * 0.5
-
-	// Step 6: Store the claim details
-	claim := Claim{
-		UserID:           userID,
-		PolicyID:         policyID,
-		SettlementAmount: settlementAmount,
-		HospitalName:     patientDetails.HospitalName,
-		Status:           "Processed",
+	// Steps 3 and 4: Submit the claim and adjudicate it
+	claim, err := fileEpisodeClaim(ctx, episode, lookup.Policy, PayerPrimary)
+	if err != nil {
+		return "", err
 	}
 
-	
-	claimDetailsList[userID] = claim
-	// Serialize the claim to JSON
-	claimJSON, err := json.Marshal(claim)
+	// Link the episode to its claim
+	episode.ClaimID = claim.ClaimID
+	episode.ClaimStatus = claim.Status
+	episode.ClaimError = ""
+	err = putEpisode(ctx, episode)
 	if err != nil {
-		return fmt.Errorf("failed to serialize claim: %v", err)
+		return "", err
 	}
 
-	patientDetails.ClaimStatus = "Processed"
+	return claim.ClaimID, nil
+}
 
-	// Update the in-memory map (if the patient exists in the map)
-	if _, exists := patientDetailsList[userID]; exists {
-		patientDetailsList[userID] = patientDetails
+// requireFilingInsurer lets org identities file a member's claim only as an adjuster of the policy's insurer.
+// Members and their delegates are checked by authorizeActingFor.
+func requireFilingInsurer(ctx contractapi.TransactionContextInterface, userID, policyID string) error {
+	callerID, err := callerUserID(ctx)
+	if err != nil || callerID != "" {
+		return err
 	}
 
-	// Serialize the updated patient details to JSON
-	updatedPatientDetailsJSON, err := json.Marshal(patientDetails)
+	return requirePolicyInsurer(ctx, policyID, "file claims for "+userID, insurerAdjuster)
+}
+
+// fileEpisodeClaim submits a claim for an episode with one of the member's payers, adjudicates it against
+// the policy rules straight away and stores it. The caller links the episode to the claim.
+func fileEpisodeClaim(ctx contractapi.TransactionContextInterface, episode *Episode, policy *Policy, payerRank string) (*Claim, error) {
+	insurerMSP, err := policyInsurer(ctx, policy.PolicyID)
 	if err != nil {
-		return fmt.Errorf("failed to serialize updated patient details: %v", err)
+		return nil, err
 	}
 
-	// Update the private data collection with the new patient details
-	err = ctx.GetStub().PutPrivateData("Org1MSPPrivateCollection", userID, updatedPatientDetailsJSON)
+	claim := Claim{
+		ClaimID:       newClaimID(ctx, episode.EpisodeID),
+		UserID:        episode.UserID,
+		PolicyID:      policy.PolicyID,
+		PayerRank:     payerRank,
+		InsurerMSP:    insurerMSP,
+		HospitalName:  episode.HospitalName,
+		EpisodeID:     episode.EpisodeID,
+		Diagnosis:     principalDiagnosis(episode),
+		AdmissionDate: episode.Admission.Date,
+		DischargeDate: episode.Discharge.Date,
+		Status:        ClaimSubmitted,
+	}
+
+	emitEvent(ctx, EventClaimSubmitted, ClaimSubmittedEvent{
+		ClaimID:  claim.ClaimID,
+		UserID:   claim.UserID,
+		PolicyID: claim.PolicyID,
+	})
+
+	err = adjudicateClaim(ctx, &claim, policy, episode)
 	if err != nil {
-		return fmt.Errorf("failed to update patient details in PDC: %v", err)
+		return nil, err
 	}
 
+	// Store the claim details and its user, policy and hospital indexes
+	err = putClaim(ctx, &claim)
+	if err != nil {
+		return nil, err
+	}
 
+	err = recordClaimSubmitted(ctx, &claim)
+	if err != nil {
+		return nil, err
+	}
 
-	// Store the claim details in a collection (e.g., "claims")
-	err = ctx.GetStub().PutPrivateData("ClaimsPrivateCollection", userID, claimJSON)
+	// From here on the hospital and the insurer must both endorse changes to the claim, including its settlement
+	endorsers, err := claimEndorsers(ctx, &claim)
+	if err != nil {
+		return nil, err
+	}
+	err = setClaimEndorsers(ctx, claim.ClaimID, endorsers)
 	if err != nil {
-		return fmt.Errorf("failed to store claim details: %v", err)
+		return nil, err
 	}
 
-	return nil
+	return &claim, nil
 }
 
 
 
-// QueryAllClaims retrieves all claims from the in-memory list or ledger
+// QueryAllClaims retrieves the claims of the caller's insurer for its adjusters and auditors, or a member's own claims
 func (s *SmartContract) QueryAllClaims(ctx contractapi.TransactionContextInterface) ([]Claim, error) {
+	reader, err := newClaimReader(ctx, "list claims", insurerAdjuster, insurerAuditor, anyMember)
+	if err != nil {
+		return nil, err
+	}
+
 	var claims []Claim
 
-	// First, check if claims are available in the in-memory store
-	if len(claimDetailsList) > 0 {
-		for _, claim := range claimDetailsList {
-			claims = append(claims, claim)
-		}
-	} else {
-		// If no claims in-memory, query the ledger
-		startKey := ""
-		endKey := ""
+	// Index entries are composite keys, which a plain range scan skips
+	iterator, err := ctx.GetStub().GetPrivateDataByRange(claimsCollection, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve claims from ledger: %v", err)
+	}
+	defer iterator.Close()
 
-		iterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
 		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve claims from ledger: %v", err)
+			return nil, fmt.Errorf("failed to retrieve next claim entry during iteration: %v", err)
 		}
-		defer iterator.Close()
-
-		for iterator.HasNext() {
-			queryResponse, err := iterator.Next()
-			if err != nil {
-				return nil, fmt.Errorf("failed to retrieve next claim entry during iteration: %v", err)
-			}
 
-			var claim Claim
-			err = json.Unmarshal(queryResponse.Value, &claim)
-			if err != nil {
-				return nil, fmt.Errorf("failed to unmarshal claim JSON from value: %v", err)
-			}
-
-			claims = append(claims, claim)
+		var claim Claim
+		err = json.Unmarshal(queryResponse.Value, &claim)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal claim JSON from value: %v", err)
 		}
-
-		if len(claims) == 0 {
-			return nil, fmt.Errorf("no claims found in the ledger")
+		readable, err := reader.canRead(ctx, &claim)
+		if err != nil {
+			return nil, err
+		}
+		if !readable {
+			continue
 		}
+
+		claims = append(claims, claim)
+	}
+
+	if len(claims) == 0 {
+		return nil, fmt.Errorf("no claims found in the ledger")
 	}
 
 	return claims, nil
 }
 
-// QueryClaim retrieves claim details by userID
-func (s *SmartContract) QueryClaim(ctx contractapi.TransactionContextInterface, userID string) (*Claim, error) {
-	claimJSON, err := ctx.GetStub().GetPrivateData("ClaimsPrivateCollection", userID)
+// QueryClaim retrieves claim details by claimID
+func (s *SmartContract) QueryClaim(ctx contractapi.TransactionContextInterface, claimID string) (*Claim, error) {
+	claim, err := getClaim(ctx, claimID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch claim: %v", err)
-	}
-	if claimJSON == nil {
-		return nil, fmt.Errorf("no claim found for user %s", userID)
+		return nil, err
 	}
 
-	var claim Claim
-	err = json.Unmarshal(claimJSON, &claim)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal claim: %v", err)
+	if err := requireClaimReader(ctx, claim); err != nil {
+		return nil, err
 	}
 
-	return &claim, nil
+	return claim, nil
 }
 
 
 
 func main() {
 	claimsContract := new(SmartContract)
+	claimsContract.TransactionContextHandler = new(TransactionContext)
+	claimsContract.AfterTransaction = flushEvents
 
 	chaincode, err := contractapi.NewChaincode(claimsContract)
 	if err != nil {
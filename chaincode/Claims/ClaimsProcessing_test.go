@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+)
+
+// newFilingContext has user1 admitted by Org4MSP to City Hospital, registered in Org1MSP's provider registry,
+// discharged from episode EP1 with a covered diagnosis and insured under POL1
+func newFilingContext(t *testing.T, caller *fakeIdentity, delegated bool) *TransactionContext {
+	policy := &Policy{PolicyID: "POL1", InsurerMSP: "Org1MSP", CoverAmount: 1000, CoveredDiseases: []string{"malaria"}}
+	registry := claimTestRegistry("")
+	registry["LookupPolicyForUser user1"] = &PolicyLookup{SchemaVersion: "1.0", UserID: "user1", PolicyID: "POL1", Policy: policy}
+	registry["VerifyCoverage user1"] = &CoverageVerdict{SchemaVersion: "1.0", Covered: true}
+	registry["QueryRegistration user1"] = &Registration{UserID: "user1", PolicyID: "POL1"}
+	registry["ConsumeCoverage user1"] = &CoverageDebit{SchemaVersion: "1.0", GrantedAmount: 500}
+	if delegated {
+		registry["VerifyDelegation user1"] = true
+	}
+	ctx, _ := newTestContext(t, withJob("Org1MSP", JobUnderwriter), registry)
+
+	if err := new(SmartContract).RegisterProvider(ctx, "PRV1", "City Hospital", "Org4MSP", InNetwork, ""); err != nil {
+		t.Fatal(err)
+	}
+	err := putEpisode(ctx, &Episode{
+		EpisodeID:    "EP1",
+		UserID:       "user1",
+		HospitalName: "City Hospital",
+		ProviderMSP:  "Org4MSP",
+		Status:       EpisodeDischarged,
+		Admission:    EpisodeEntry{Date: "2024-01-01"},
+		Diagnoses:    []EpisodeEntry{{Detail: "malaria"}},
+		Discharge:    &EpisodeEntry{Date: "2024-01-05"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx.SetClientIdentity(caller)
+	return ctx
+}
+
+func TestProcessEpisodeClaimFiler(t *testing.T) {
+	member := &fakeIdentity{mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: "parent"}}
+
+	tests := []struct {
+		name      string
+		caller    *fakeIdentity
+		delegated bool   // The registry confirms the caller may act for user1 with the claim scope
+		want      string // Status the claim is filed in, or "denied"
+	}{
+		{"member or delegate covering claim", member, true, ClaimUnderReview},
+		{"delegate without the claim scope", member, false, "denied"},
+		{"insurer's adjuster", withJob("Org1MSP", JobAdjuster), false, ClaimApproved},
+		{"another insurer's adjuster", withJob("Org2MSP", JobAdjuster), false, "denied"},
+		{"insurer's auditor", withJob("Org1MSP", JobAuditor), false, "denied"},
+		{"admitting provider's clinician", withJob("Org4MSP", JobClinician), false, "denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newFilingContext(t, tt.caller, tt.delegated)
+
+			claimID, err := new(SmartContract).ProcessEpisodeClaim(ctx, "EP1")
+			if tt.want == "denied" {
+				if !isAccessDenied(err) {
+					t.Fatalf("expected an access denial, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claim, err := getClaim(ctx, claimID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claim.Status != tt.want {
+				t.Fatalf("expected the claim %s, got %s", tt.want, claim.Status)
+			}
+			// Only an adjuster draws on the cover; the member's claim waits for one with the amount the rules allow
+			if tt.want == ClaimUnderReview && (claim.SettlementAmount != 0 || claim.AwaitingApprovalFor != 500) {
+				t.Fatalf("expected 500 awaiting approval and nothing settled, got %+v", claim)
+			}
+			if tt.want == ClaimApproved && claim.SettlementAmount != 500 {
+				t.Fatalf("expected 500 settled, got %.2f", claim.SettlementAmount)
+			}
+		})
+	}
+}
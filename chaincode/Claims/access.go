@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"insurance/internal/authz"
+)
+
+// Roles an organisation can hold, as recorded by the registration chaincode's organisation registry
+const (
+	RoleProvider = authz.RoleProvider // Hospitals, which hold the clinical record
+	RoleInsurer  = authz.RoleInsurer  // Insurers, which see the claim-relevant part of their own members' records
+
+	RoleRegistryAdmin = authz.RoleRegistryAdmin // Organisations allowed to maintain the registry and the registration target
+)
+
+// OrgRecord mirrors the organisation registry's answer to QueryOrg
+type OrgRecord struct {
+	DocType       string   `json:"docType"` // Empty for organisations the registry does not know
+	SchemaVersion string   `json:"schemaVersion"`
+	MSPID         string   `json:"mspId"`
+	Roles         []string `json:"roles"`
+}
+
+func (r *OrgRecord) schemaVersion() string { return r.SchemaVersion }
+
+// RegistryDefaults mirrors the organisation registry's answer to QueryRegistryDefaults
+type RegistryDefaults struct {
+	SchemaVersion     string `json:"schemaVersion"`
+	LegacyInsurerMSP  string `json:"legacyInsurerMsp,omitempty"`
+	LegacyProviderMSP string `json:"legacyProviderMsp,omitempty"`
+}
+
+func (d *RegistryDefaults) schemaVersion() string { return d.SchemaVersion }
+
+// callerOrgRoles returns the roles the registry gives the caller's organisation
+func callerOrgRoles(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	orgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	var record OrgRecord
+	err = invokeRegistry(ctx, "OrgRegistryContract:QueryOrg", []string{orgID}, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the roles of %s: %v", orgID, err)
+	}
+	if record.Roles == nil {
+		return []string{}, nil
+	}
+
+	return record.Roles, nil
+}
+
+// policyInsurer returns the MSP of the insurer that defined a policy, or the registry's legacy insurer for
+// policies defined before policies recorded their insurer
+func policyInsurer(ctx contractapi.TransactionContextInterface, policyID string) (string, error) {
+	var policy Policy
+	err := invokeRegistry(ctx, "QueryPolicy", []string{policyID}, &policy)
+	if err != nil {
+		return "", err
+	}
+	if policy.InsurerMSP != "" {
+		return policy.InsurerMSP, nil
+	}
+
+	defaults, err := registryDefaults(ctx)
+	if err != nil {
+		return "", err
+	}
+	if defaults.LegacyInsurerMSP == "" {
+		return "", fmt.Errorf("policy %s records no insurer and the registry names no legacy insurer", policyID)
+	}
+
+	return defaults.LegacyInsurerMSP, nil
+}
+
+// claimInsurer returns the insurer a claim was filed with, looking it up for claims filed before claims
+// recorded it
+func claimInsurer(ctx contractapi.TransactionContextInterface, claim *Claim) (string, error) {
+	if claim.InsurerMSP != "" {
+		return claim.InsurerMSP, nil
+	}
+
+	return policyInsurer(ctx, claim.PolicyID)
+}
+
+// claimProvider returns the hospital that treated the patient of a claim: the insurer's registered provider the
+// claim was filed against, otherwise the provider that admitted the patient, otherwise the registry's legacy
+// provider. It is "" when none is known.
+func claimProvider(ctx contractapi.TransactionContextInterface, claim *Claim, insurerMSP string) (string, error) {
+	if claim.ProviderID != "" {
+		provider, err := getProvider(ctx, insurerMSP, claim.ProviderID)
+		if err != nil {
+			return "", err
+		}
+		if provider != nil && provider.MSPID != "" {
+			return provider.MSPID, nil
+		}
+	}
+	if claim.EpisodeID != "" {
+		episode, err := getEpisode(ctx, claim.EpisodeID)
+		if err != nil {
+			return "", err
+		}
+		return episodeProvider(ctx, episode)
+	}
+
+	defaults, err := registryDefaults(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return defaults.LegacyProviderMSP, nil
+}
+
+// registryDefaults returns the owners the registry gives records written before records named their owner
+func registryDefaults(ctx contractapi.TransactionContextInterface) (*RegistryDefaults, error) {
+	var defaults RegistryDefaults
+	err := invokeRegistry(ctx, "OrgRegistryContract:QueryRegistryDefaults", nil, &defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	return &defaults, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Reason codes recorded on rejected claims. Claims failing coverage verification carry the
+// reason code of the registration chaincode's verdict instead.
+const (
+	ReasonDiseaseNotCovered = "DISEASE_NOT_COVERED"
+	ReasonCoverExhausted    = "COVER_EXHAUSTED"
+)
+
+// adjudicateClaim takes a submitted claim through the automatic policy rules. Claims that fail a rule
+// are stored as rejected with a reason code, so the decision stays on the ledger and can be appealed.
+// Claims flagged by fraud screening stay under review, with the triggered rules attached, for an adjuster,
+// as do claims with an itemised bill and claims filed by the member or a delegate, which cannot draw on
+// the cover themselves.
+func adjudicateClaim(ctx contractapi.TransactionContextInterface, claim *Claim, policy *Policy, episode *Episode) error {
+	err := applyClaimRule(ctx, claim, ClaimUnderReview, "automatic adjudication")
+	if err != nil {
+		return err
+	}
+
+	// The registration must be paid up, active and cover the admission date, with cover left to draw
+	var verdict CoverageVerdict
+	err = invokeRegistration(ctx, "VerifyCoverage", []string{claim.UserID, claim.PolicyID, claim.AdmissionDate}, &verdict)
+	if err != nil {
+		return err
+	}
+	if !verdict.Covered {
+		return rejectClaim(ctx, claim, verdict.ReasonCode, verdict.Reason)
+	}
+
+	// Only hospitals in the provider registry can be paid
+	provider, err := providerByName(ctx, claim.InsurerMSP, claim.HospitalName)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return rejectClaim(ctx, claim, ReasonUnknownProvider, fmt.Sprintf("hospital %s is not in the provider registry of %s", claim.HospitalName, claim.InsurerMSP))
+	}
+	// The registry entry must be the provider that admitted the patient, not another hospital of the same name
+	admittedBy, err := episodeProvider(ctx, episode)
+	if err != nil {
+		return err
+	}
+	if provider.MSPID != admittedBy {
+		return rejectClaim(ctx, claim, ReasonProviderMismatch, fmt.Sprintf("hospital %s is registered to %s, but the patient was admitted by %s", claim.HospitalName, provider.MSPID, admittedBy))
+	}
+	claim.ProviderID = provider.ProviderID
+	claim.NetworkStatus = provider.NetworkStatus
+
+	// Check if the disease diagnosed is covered by the policy
+	diseaseCovered := false
+	for _, disease := range policy.CoveredDiseases {
+		if disease == claim.Diagnosis {
+			diseaseCovered = true
+			break
+		}
+	}
+	if !diseaseCovered {
+		return rejectClaim(ctx, claim, ReasonDiseaseNotCovered, fmt.Sprintf("disease %s is not covered by policy %s", claim.Diagnosis, policy.PolicyID))
+	}
+
+	var registration Registration
+	err = invokeRegistration(ctx, "QueryRegistration", []string{claim.UserID, claim.PolicyID}, &registration)
+	if err != nil {
+		return err
+	}
+
+	claim.FraudFlags, err = screenClaim(ctx, &ClaimScreening{
+		Claim:        claim,
+		Policy:       policy,
+		Episode:      episode,
+		Registration: &registration,
+	})
+	if err != nil {
+		return err
+	}
+	if len(claim.FraudFlags) > 0 {
+		return nil
+	}
+
+	preAuth, err := findPreAuthorization(ctx, claim)
+	if err != nil {
+		return err
+	}
+	if preAuth != nil {
+		claim.PreAuthID = preAuth.PreAuthID
+		preAuth.Status = PreAuthUsed
+		preAuth.ClaimID = claim.ClaimID
+		err = putPreAuthorization(ctx, preAuth)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Itemised bills stay under review until an adjuster decides every line through AdjudicateBillLines
+	bill, err := takeHospitalBill(ctx, claim)
+	if err != nil {
+		return err
+	}
+	if bill != nil {
+		claim.BillLines = bill.Lines
+		claim.BilledAmount = bill.BilledTotal
+		claim.ClaimedAmount = bill.BilledTotal
+		return nil
+	}
+
+	// Settle 50% of the cover amount for simplicity at the provider's network-tier rate, but no more
+	// than was pre-authorised for a cashless stay, capped at what is left of the member's cover
+	requestedAmount := policy.CoverAmount * 0.5 * networkTierRates[provider.NetworkStatus]
+	if preAuth != nil {
+		requestedAmount = math.Min(requestedAmount, preAuth.ApprovedAmount)
+	}
+	claim.ClaimedAmount = requestedAmount
+
+	// A secondary payer only covers what the primary payer left of the billed charges
+	requestedAmount, err = coordinatedAmount(ctx, claim, requestedAmount)
+	if err != nil {
+		return err
+	}
+	if requestedAmount <= 0 {
+		return rejectClaim(ctx, claim, ReasonPaidByPrimary, fmt.Sprintf("the primary payer's settlement of %.2f leaves nothing of the billed charges to pay", claim.OtherPayerPaid))
+	}
+
+	// Large settlements wait under review for the adjuster approvals the policy's approval rule asks for
+	missing, err := missingApprovals(ctx, claim, requestedAmount)
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		claim.AwaitingApprovalFor = requestedAmount
+		return nil
+	}
+
+	// Only an adjuster of the insurer may draw on the cover, so claims filed by the member or a delegate
+	// wait under review for one to approve the amount the rules allow
+	filedBy, err := callerUserID(ctx)
+	if err != nil {
+		return err
+	}
+	if filedBy != "" {
+		claim.AwaitingApprovalFor = requestedAmount
+		return nil
+	}
+
+	claim.SettlementAmount, err = consumeCoverage(ctx, claim, requestedAmount)
+	if err != nil {
+		return err
+	}
+
+	return applyClaimRule(ctx, claim, ClaimApproved, fmt.Sprintf("disease %s is covered by policy %s", claim.Diagnosis, policy.PolicyID))
+}
+
+// rejectClaim moves a claim to Rejected by an automatic rule, or by a decision the caller has already been
+// authorised for, and records why
+func rejectClaim(ctx contractapi.TransactionContextInterface, claim *Claim, reasonCode, reason string) error {
+	err := applyClaimRule(ctx, claim, ClaimRejected, reason)
+	if err != nil {
+		return err
+	}
+
+	claim.SettlementAmount = 0
+	claim.RejectionReasonCode = reasonCode
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAdjudicationChecksAdmittingProvider(t *testing.T) {
+	tests := []struct {
+		name        string
+		providerMSP string // The MSP the insurer registered the hospital under
+		want        string // Reason code the claim is rejected with
+	}{
+		{"hospital of the admitting provider", "Org4MSP", ReasonDiseaseNotCovered},
+		{"hospital of the same name at another provider", "Org5MSP", ReasonProviderMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry("")
+			registry["OrgRegistryContract:QueryOrg Org5MSP"] = testOrg("Org5MSP", RoleProvider)
+			registry["VerifyCoverage user1"] = &CoverageVerdict{SchemaVersion: "1.0", Covered: true}
+			ctx, _ := newTestContext(t, withJob("Org1MSP", JobUnderwriter), registry)
+
+			err := new(SmartContract).RegisterProvider(ctx, "PRV1", "City Hospital", tt.providerMSP, InNetwork, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx.SetClientIdentity(withJob("Org1MSP", JobAdjuster))
+
+			episode := &Episode{EpisodeID: "EP1", UserID: "user1", HospitalName: "City Hospital", ProviderMSP: "Org4MSP", Status: EpisodeDischarged}
+			claim := &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", HospitalName: "City Hospital", EpisodeID: "EP1", Diagnosis: "fracture", Status: ClaimSubmitted}
+			policy := &Policy{PolicyID: "POL1", InsurerMSP: "Org1MSP", CoveredDiseases: []string{"malaria"}}
+
+			if err := adjudicateClaim(ctx, claim, policy, episode); err != nil {
+				t.Fatal(err)
+			}
+			if claim.Status != ClaimRejected || claim.RejectionReasonCode != tt.want {
+				t.Fatalf("expected the claim rejected with %s, got %s with %q", tt.want, claim.Status, claim.RejectionReasonCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// analyticsPeriodLayout is the format of the monthly periods analytics are grouped by
+const analyticsPeriodLayout = "2006-01"
+
+// topDiagnosesLimit is how many diagnoses QueryPolicyAnalytics ranks
+const topDiagnosesLimit = 5
+
+// Kinds of claim analytics records
+const (
+	analyticsSubmitted = "submitted"
+	analyticsSettled   = "settled"
+)
+
+// ClaimAnalyticsDelta records one claim's contribution to its policy's analytics. Every claim writes its
+// own keys rather than updating a running total, so claims under the same policy never conflict.
+type ClaimAnalyticsDelta struct {
+	DocType       string  `json:"docType"`
+	PolicyID      string  `json:"policyId"`
+	Period        string  `json:"period"`
+	ClaimID       string  `json:"claimId"`
+	Kind          string  `json:"kind"`                    // analyticsSubmitted or analyticsSettled
+	Diagnosis     string  `json:"diagnosis,omitempty"`     // Set on submitted records
+	SettledAmount float64 `json:"settledAmount,omitempty"` // Set on settled records
+}
+
+// PremiumSummary mirrors the registration chaincode's answer to QueryPremiumsCollected
+type PremiumSummary struct {
+	SchemaVersion     string  `json:"schemaVersion"`
+	PolicyID          string  `json:"policyId"`
+	Period            string  `json:"period"`
+	Registrations     int     `json:"registrations"`
+	PremiumsCollected float64 `json:"premiumsCollected"`
+}
+
+func (p *PremiumSummary) schemaVersion() string { return p.SchemaVersion }
+
+// DiagnosisCount is how many claims in a period were filed for a diagnosis
+type DiagnosisCount struct {
+	Diagnosis string `json:"diagnosis"`
+	Count     int    `json:"count"`
+}
+
+// PolicyAnalytics summarises how a policy performed in a period
+type PolicyAnalytics struct {
+	PolicyID          string           `json:"policyId"`
+	Period            string           `json:"period"` // Empty for the lifetime of the policy
+	Registrations     int              `json:"registrations"`
+	PremiumsCollected float64          `json:"premiumsCollected"`
+	ClaimsCount       int              `json:"claimsCount"`
+	SettledCount      int              `json:"settledCount"`
+	SettledAmount     float64          `json:"settledAmount"`
+	LossRatio         float64          `json:"lossRatio"` // Settled amount over premiums collected; 0 when no premium was collected
+	TopDiagnoses      []DiagnosisCount `json:"topDiagnoses"`
+}
+
+// QueryPolicyAnalytics allows an underwriter or auditor to see a policy's premiums, claims, settlements,
+// loss ratio and top diagnoses for a period ("2006-01"), or over the lifetime of the policy when the
+// period is empty.
+// Claims count in the period they were submitted and settlements in the period they were approved.
+func (s *SmartContract) QueryPolicyAnalytics(ctx contractapi.TransactionContextInterface, policyID string, period string) (*PolicyAnalytics, error) {
+	if err := authorize(ctx, "query policy analytics", insurerUnderwriter, insurerAuditor); err != nil {
+		return nil, err
+	}
+
+	keyParts := []string{policyID}
+	if period != "" {
+		if _, err := time.Parse(analyticsPeriodLayout, period); err != nil {
+			return nil, fmt.Errorf("failed to parse period %s: %v", period, err)
+		}
+		keyParts = append(keyParts, period)
+	}
+
+	var premiums PremiumSummary
+	err := invokeRegistration(ctx, "QueryPremiumsCollected", []string{policyID, period}, &premiums)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics := &PolicyAnalytics{
+		PolicyID:          policyID,
+		Period:            period,
+		Registrations:     premiums.Registrations,
+		PremiumsCollected: premiums.PremiumsCollected,
+		TopDiagnoses:      []DiagnosisCount{},
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(claimsCollection, "claimAnalytics", keyParts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read claim analytics: %v", err)
+	}
+	defer iterator.Close()
+
+	diagnoses := map[string]int{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next claim analytics record: %v", err)
+		}
+
+		var delta ClaimAnalyticsDelta
+		err = json.Unmarshal(queryResponse.Value, &delta)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal claim analytics record: %v", err)
+		}
+
+		switch delta.Kind {
+		case analyticsSubmitted:
+			analytics.ClaimsCount++
+			diagnoses[delta.Diagnosis]++
+		case analyticsSettled:
+			analytics.SettledCount++
+			analytics.SettledAmount += delta.SettledAmount
+		}
+	}
+
+	if analytics.PremiumsCollected > 0 {
+		analytics.LossRatio = analytics.SettledAmount / analytics.PremiumsCollected
+	}
+
+	for diagnosis, count := range diagnoses {
+		analytics.TopDiagnoses = append(analytics.TopDiagnoses, DiagnosisCount{Diagnosis: diagnosis, Count: count})
+	}
+	sort.Slice(analytics.TopDiagnoses, func(i, j int) bool {
+		a, b := analytics.TopDiagnoses[i], analytics.TopDiagnoses[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Diagnosis < b.Diagnosis
+	})
+	if len(analytics.TopDiagnoses) > topDiagnosesLimit {
+		analytics.TopDiagnoses = analytics.TopDiagnoses[:topDiagnosesLimit]
+	}
+
+	return analytics, nil
+}
+
+// recordClaimSubmitted counts a new claim and its diagnosis towards its policy's analytics
+func recordClaimSubmitted(ctx contractapi.TransactionContextInterface, claim *Claim) error {
+	return putClaimAnalytics(ctx, claim, ClaimAnalyticsDelta{Kind: analyticsSubmitted, Diagnosis: claim.Diagnosis})
+}
+
+// recordClaimSettled counts a claim's approved amount towards its policy's analytics and stamps when it was settled
+func recordClaimSettled(ctx contractapi.TransactionContextInterface, claim *Claim) error {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	claim.SettledAt = timestamp.Seconds
+
+	return putClaimAnalytics(ctx, claim, ClaimAnalyticsDelta{Kind: analyticsSettled, SettledAmount: claim.SettlementAmount})
+}
+
+func putClaimAnalytics(ctx contractapi.TransactionContextInterface, claim *Claim, delta ClaimAnalyticsDelta) error {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	delta.DocType = claimAnalyticsDocType
+	delta.PolicyID = claim.PolicyID
+	delta.Period = time.Unix(timestamp.Seconds, 0).UTC().Format(analyticsPeriodLayout)
+	delta.ClaimID = claim.ClaimID
+
+	deltaJSON, err := json.Marshal(delta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal claim analytics record: %v", err)
+	}
+
+	deltaKey, err := ctx.GetStub().CreateCompositeKey("claimAnalytics", []string{delta.PolicyID, delta.Period, delta.ClaimID, delta.Kind})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutPrivateData(claimsCollection, deltaKey, deltaJSON)
+}
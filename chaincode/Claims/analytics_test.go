@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestQueryPolicyAnalytics(t *testing.T) {
+	registry := claimTestRegistry("")
+	registry["QueryPremiumsCollected POL1"] = &PremiumSummary{SchemaVersion: "1.0", PolicyID: "POL1", Registrations: 2, PremiumsCollected: 1000}
+	ctx, _ := newTestContext(t, withJob("Org1MSP", JobAuditor), registry)
+
+	for _, claim := range []*Claim{
+		{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", Diagnosis: "Malaria", Status: ClaimSubmitted},
+		{ClaimID: "CLM2", UserID: "user2", PolicyID: "POL1", Diagnosis: "Malaria", Status: ClaimSubmitted},
+		{ClaimID: "CLM3", UserID: "user3", PolicyID: "POL1", Diagnosis: "Dengue", Status: ClaimSubmitted},
+	} {
+		if err := recordClaimSubmitted(ctx, claim); err != nil {
+			t.Fatal(err)
+		}
+		if err := putClaim(ctx, claim); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A settled claim counts once, however often it is stored afterwards
+	claim, err := getClaim(ctx, "CLM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim.Status = ClaimApproved
+	claim.SettlementAmount = 400
+	for i := 0; i < 2; i++ {
+		if err := putClaim(ctx, claim); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analytics, err := new(SmartContract).QueryPolicyAnalytics(ctx, "POL1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analytics.ClaimsCount != 3 || analytics.SettledCount != 1 || analytics.SettledAmount != 400 || analytics.LossRatio != 0.4 {
+		t.Fatalf("expected 3 claims, 1 settled for 400 and a loss ratio of 0.4, got %+v", analytics)
+	}
+	if len(analytics.TopDiagnoses) != 2 || analytics.TopDiagnoses[0] != (DiagnosisCount{Diagnosis: "Malaria", Count: 2}) {
+		t.Fatalf("expected Malaria ranked first with 2 claims, got %+v", analytics.TopDiagnoses)
+	}
+
+	if _, err := new(SmartContract).QueryPolicyAnalytics(ctx, "POL1", "May 2024"); err == nil {
+		t.Fatal("expected a malformed period to be refused")
+	}
+	ctx.SetClientIdentity(withJob("Org4MSP", JobClinician))
+	if _, err := new(SmartContract).QueryPolicyAnalytics(ctx, "POL1", ""); !isAccessDenied(err) {
+		t.Fatalf("expected a clinician to be denied, got %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Appeal outcomes
+const (
+	AppealFiled      = "Filed"
+	AppealUpheld     = "Upheld"     // The rejection stands
+	AppealOverturned = "Overturned" // The claim is approved after all
+)
+
+// Appeal records a patient's challenge to a rejected claim and the final ruling on it
+type Appeal struct {
+	DocType       string  `json:"docType"`
+	AppealID      string  `json:"appealId"`
+	ClaimID       string  `json:"claimId"`
+	Grounds       string  `json:"grounds"`
+	EvidenceHash  string  `json:"evidenceHash"`
+	FiledBy       string  `json:"filedBy"`
+	FiledAt       int64   `json:"filedAt"`
+	Status        string  `json:"status"`
+	Ruling        string  `json:"ruling,omitempty"`
+	RuledBy       string  `json:"ruledBy,omitempty"`
+	RuledByMSP    string  `json:"ruledByMsp,omitempty"`
+	RuledAt       int64   `json:"ruledAt,omitempty"`
+	AwardedAmount float64 `json:"awardedAmount,omitempty"`
+}
+
+// DisputeTimeline is everything that happened to a claim, including its appeals
+type DisputeTimeline struct {
+	ClaimID             string            `json:"claimId"`
+	Status              string            `json:"status"`
+	RejectionReasonCode string            `json:"rejectionReasonCode,omitempty"`
+	Transitions         []ClaimTransition `json:"transitions"`
+	Appeals             []*Appeal         `json:"appeals"`
+}
+
+// ArbitratorConfig mirrors the registration chaincode's appeal arbitrator appointed for an insurer
+type ArbitratorConfig struct {
+	InsurerMSP string `json:"insurerMsp"`
+	MSPID      string `json:"mspId"`
+}
+
+// maxAppealsPerClaim is how many times a claim can be appealed; once the last appeal is upheld the rejection is final
+const maxAppealsPerClaim = 2
+
+// FileAppeal contests a rejected claim, at most maxAppealsPerClaim times. The evidence itself stays off-chain;
+// only its hash is recorded.
+func (s *SmartContract) FileAppeal(ctx contractapi.TransactionContextInterface, claimID string, grounds string, evidenceHash string) (string, error) {
+	if grounds == "" {
+		return "", fmt.Errorf("grounds are required to appeal claim %s", claimID)
+	}
+	if _, err := hex.DecodeString(evidenceHash); err != nil || evidenceHash == "" {
+		return "", fmt.Errorf("evidence hash must be a hex-encoded digest")
+	}
+
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return "", err
+	}
+	if err := authorizeActingFor(ctx, claim.UserID, "claim"); err != nil {
+		return "", err
+	}
+
+	appeals, err := countAppeals(ctx, claimID)
+	if err != nil {
+		return "", err
+	}
+	if appeals >= maxAppealsPerClaim {
+		return "", fmt.Errorf("claim %s has already been appealed %d times, the rejection is final", claimID, appeals)
+	}
+
+	err = transitionClaim(ctx, claim, ClaimUnderAppeal, grounds)
+	if err != nil {
+		return "", err
+	}
+
+	filedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(ctx.GetStub().GetTxID() + ":" + claimID))
+	appeal := Appeal{
+		AppealID:     "APL-" + hex.EncodeToString(sum[:8]),
+		ClaimID:      claimID,
+		Grounds:      grounds,
+		EvidenceHash: evidenceHash,
+		FiledBy:      filedBy,
+		FiledAt:      claim.History[len(claim.History)-1].Timestamp,
+		Status:       AppealFiled,
+	}
+
+	if err := putAppeal(ctx, &appeal); err != nil {
+		return "", err
+	}
+	if err := putClaim(ctx, claim); err != nil {
+		return "", err
+	}
+	if err := syncEpisodeClaimStatus(ctx, claim); err != nil {
+		return "", err
+	}
+
+	return appeal.AppealID, nil
+}
+
+// ResolveAppeal makes the final ruling on an appeal. The arbitrator appointed for the claim's insurer rules when there
+// is one, otherwise the insurer. An overturned rejection is approved for the awarded amount, drawn from the member's
+// remaining cover once the policy's approval rule is met.
+func (s *SmartContract) ResolveAppeal(ctx contractapi.TransactionContextInterface, claimID string, appealID string, decision string, ruling string, awardedAmount float64) error {
+	if decision != AppealUpheld && decision != AppealOverturned {
+		return fmt.Errorf("appeal decision must be %s or %s, got %s", AppealUpheld, AppealOverturned, decision)
+	}
+
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	appeal, err := getAppeal(ctx, claimID, appealID)
+	if err != nil {
+		return err
+	}
+	if appeal.Status != AppealFiled {
+		return fmt.Errorf("appeal %s has already been resolved", appealID)
+	}
+
+	if decision == AppealOverturned {
+		err = transitionClaim(ctx, claim, ClaimApproved, ruling)
+		if err != nil {
+			return err
+		}
+		// Overturned appeals need the same adjuster approvals as any other settlement, whoever rules
+		err = requireSettlementApprovals(ctx, claim, awardedAmount)
+		if err != nil {
+			return err
+		}
+		err = settleAgainstCover(ctx, claim, awardedAmount)
+		if err != nil {
+			return err
+		}
+		claim.RejectionReasonCode = ""
+		appeal.AwardedAmount = awardedAmount
+	} else {
+		err = transitionClaim(ctx, claim, ClaimRejected, ruling)
+		if err != nil {
+			return err
+		}
+	}
+
+	latest := claim.History[len(claim.History)-1]
+	appeal.Status = decision
+	appeal.Ruling = ruling
+	appeal.RuledBy = latest.ActorID
+	appeal.RuledByMSP = latest.ActorMSP
+	appeal.RuledAt = latest.Timestamp
+
+	if err := putAppeal(ctx, appeal); err != nil {
+		return err
+	}
+	if err := putClaim(ctx, claim); err != nil {
+		return err
+	}
+
+	return syncEpisodeClaimStatus(ctx, claim)
+}
+
+// QueryDisputeTimeline returns the full history of a claim together with every appeal filed against it
+func (s *SmartContract) QueryDisputeTimeline(ctx contractapi.TransactionContextInterface, claimID string) (*DisputeTimeline, error) {
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireClaimReader(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(claimsCollection, "appeal", []string{claimID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve appeals: %v", err)
+	}
+	defer iterator.Close()
+
+	timeline := &DisputeTimeline{
+		ClaimID:             claim.ClaimID,
+		Status:              claim.Status,
+		RejectionReasonCode: claim.RejectionReasonCode,
+		Transitions:         claim.History,
+		Appeals:             []*Appeal{},
+	}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next appeal: %v", err)
+		}
+
+		var appeal Appeal
+		err = json.Unmarshal(queryResponse.Value, &appeal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal appeal: %v", err)
+		}
+		timeline.Appeals = append(timeline.Appeals, &appeal)
+	}
+
+	return timeline, nil
+}
+
+// appealArbitratorMSP returns the org appointed to rule on appeals against the claim's insurer, or "" when
+// the insurer rules on them
+func appealArbitratorMSP(ctx contractapi.TransactionContextInterface, claim *Claim) (string, error) {
+	insurerMSP, err := claimInsurer(ctx, claim)
+	if err != nil {
+		return "", err
+	}
+
+	var arbitrator ArbitratorConfig
+	err = invokeRegistry(ctx, "QueryArbitrator", []string{insurerMSP}, &arbitrator)
+	if err != nil {
+		return "", err
+	}
+	return arbitrator.MSPID, nil
+}
+
+// countAppeals returns how many appeals have been filed against a claim
+func countAppeals(ctx contractapi.TransactionContextInterface, claimID string) (int, error) {
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(claimsCollection, "appeal", []string{claimID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve appeals: %v", err)
+	}
+	defer iterator.Close()
+
+	count := 0
+	for iterator.HasNext() {
+		if _, err := iterator.Next(); err != nil {
+			return 0, fmt.Errorf("failed to retrieve next appeal: %v", err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func getAppeal(ctx contractapi.TransactionContextInterface, claimID, appealID string) (*Appeal, error) {
+	appealKey, err := ctx.GetStub().CreateCompositeKey("appeal", []string{claimID, appealID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	appealJSON, err := ctx.GetStub().GetPrivateData(claimsCollection, appealKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch appeal: %v", err)
+	}
+	if appealJSON == nil {
+		return nil, fmt.Errorf("appeal %s for claim %s does not exist", appealID, claimID)
+	}
+
+	var appeal Appeal
+	err = json.Unmarshal(appealJSON, &appeal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal appeal: %v", err)
+	}
+
+	return &appeal, nil
+}
+
+func putAppeal(ctx contractapi.TransactionContextInterface, appeal *Appeal) error {
+	appealKey, err := ctx.GetStub().CreateCompositeKey("appeal", []string{appeal.ClaimID, appeal.AppealID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	appeal.DocType = appealDocType
+	appealJSON, err := json.Marshal(appeal)
+	if err != nil {
+		return fmt.Errorf("failed to serialize appeal: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(claimsCollection, appealKey, appealJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store appeal: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+const testEvidenceHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+// putRejectedClaim stores CLM1 of user1 under POL1, rejected as not covered
+func putRejectedClaim(t *testing.T, ctx *TransactionContext) {
+	t.Helper()
+
+	claim := &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimRejected, RejectionReasonCode: ReasonDiseaseNotCovered}
+	if err := putClaim(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveAppeal(t *testing.T) {
+	member := &fakeIdentity{mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: "user1"}}
+
+	tests := []struct {
+		name       string
+		arbitrator string
+		ruler      *fakeIdentity
+		decision   string
+		want       string // Claim status after the ruling, or "" when the ruler is denied
+	}{
+		{"insurer upholds without an arbitrator", "", withJob("Org1MSP", JobAdjuster), AppealUpheld, ClaimRejected},
+		{"insurer overturns without an arbitrator", "", withJob("Org1MSP", JobAdjuster), AppealOverturned, ClaimApproved},
+		{"arbitrator overturns", "Org3MSP", withJob("Org3MSP", JobAdjuster), AppealOverturned, ClaimApproved},
+		{"insurer rules despite an arbitrator", "Org3MSP", withJob("Org1MSP", JobAdjuster), AppealUpheld, ""},
+		{"another insurer rules", "", withJob("Org2MSP", JobAdjuster), AppealUpheld, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry(tt.arbitrator)
+			registry["VerifyDelegation user1"] = true
+			registry["ConsumeCoverage user1"] = &CoverageDebit{SchemaVersion: "1.0", ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", RequestedAmount: 300, GrantedAmount: 300, RemainingAmount: 700}
+			ctx, _ := newTestContext(t, member, registry)
+			putRejectedClaim(t, ctx)
+
+			appealID, err := new(SmartContract).FileAppeal(ctx, "CLM1", "malaria was confirmed by a second test", testEvidenceHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx.SetClientIdentity(tt.ruler)
+			err = new(SmartContract).ResolveAppeal(ctx, "CLM1", appealID, tt.decision, "ruling", 300)
+			if tt.want == "" {
+				if !isAccessDenied(err) {
+					t.Fatalf("expected an access denial, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claim, err := getClaim(ctx, "CLM1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claim.Status != tt.want {
+				t.Fatalf("expected the claim %s, got %s", tt.want, claim.Status)
+			}
+			if tt.decision == AppealOverturned && (claim.SettlementAmount != 300 || claim.RejectionReasonCode != "") {
+				t.Fatalf("expected 300 settled and the rejection cleared, got %.2f with %q", claim.SettlementAmount, claim.RejectionReasonCode)
+			}
+		})
+	}
+}
+
+func TestAppealsPerClaimAreCapped(t *testing.T) {
+	member := &fakeIdentity{mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: "user1"}}
+	registry := claimTestRegistry("")
+	registry["VerifyDelegation user1"] = true
+	ctx, stub := newTestContext(t, member, registry)
+	putRejectedClaim(t, ctx)
+
+	for i, txID := range []string{"tx2", "tx3"} {
+		ctx.SetClientIdentity(member)
+		appealID, err := new(SmartContract).FileAppeal(ctx, "CLM1", "grounds", testEvidenceHash)
+		if err != nil {
+			t.Fatalf("appeal %d: %v", i+1, err)
+		}
+		ctx.SetClientIdentity(withJob("Org1MSP", JobAdjuster))
+		if err := new(SmartContract).ResolveAppeal(ctx, "CLM1", appealID, AppealUpheld, "ruling", 0); err != nil {
+			t.Fatal(err)
+		}
+		stub.MockTransactionEnd("")
+		stub.MockTransactionStart(txID)
+	}
+
+	ctx.SetClientIdentity(member)
+	if _, err := new(SmartContract).FileAppeal(ctx, "CLM1", "grounds", testEvidenceHash); err == nil {
+		t.Fatalf("expected a third appeal to be refused")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ApprovalRule requires claims under a policy settling for more than ThresholdAmount to be approved by
+// RequiredApprovals distinct adjusters first
+type ApprovalRule struct {
+	DocType           string  `json:"docType"`
+	PolicyID          string  `json:"policyId"`
+	ThresholdAmount   float64 `json:"thresholdAmount"`
+	RequiredApprovals int     `json:"requiredApprovals"`
+	SetBy             string  `json:"setBy,omitempty"`
+	SetAt             int64   `json:"setAt,omitempty"`
+}
+
+// ClaimApproval is one adjuster's sign-off on settling a claim for up to Amount
+type ClaimApproval struct {
+	ApproverID string  `json:"approverId"`
+	Amount     float64 `json:"amount"`
+	Comment    string  `json:"comment,omitempty"`
+	ApprovedAt int64   `json:"approvedAt"`
+}
+
+// SetApprovalRule allows an underwriter of the insurer of a policy to require several adjuster approvals for
+// claims above a threshold. A requiredApprovals of 0 removes the rule.
+func (s *SmartContract) SetApprovalRule(ctx contractapi.TransactionContextInterface, policyID string, thresholdAmount float64, requiredApprovals int) error {
+	if err := requirePolicyInsurer(ctx, policyID, "set approval rules", insurerUnderwriter); err != nil {
+		return err
+	}
+	if thresholdAmount < 0 {
+		return fmt.Errorf("threshold amount cannot be negative, got %.2f", thresholdAmount)
+	}
+	if requiredApprovals < 0 {
+		return fmt.Errorf("required approvals cannot be negative, got %d", requiredApprovals)
+	}
+
+	setBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	ruleKey, err := ctx.GetStub().CreateCompositeKey("config", []string{"approvalRule", policyID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	if requiredApprovals == 0 {
+		return ctx.GetStub().DelState(ruleKey)
+	}
+
+	ruleJSON, err := json.Marshal(ApprovalRule{
+		DocType:           configDocType,
+		PolicyID:          policyID,
+		ThresholdAmount:   thresholdAmount,
+		RequiredApprovals: requiredApprovals,
+		SetBy:             setBy,
+		SetAt:             timestamp.Seconds,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal approval rule: %v", err)
+	}
+
+	return ctx.GetStub().PutState(ruleKey, ruleJSON)
+}
+
+// QueryApprovalRule returns the approval rule of a policy, with no required approvals when it has none
+func (s *SmartContract) QueryApprovalRule(ctx contractapi.TransactionContextInterface, policyID string) (*ApprovalRule, error) {
+	return getApprovalRule(ctx, policyID)
+}
+
+// ApproveClaimSettlement records an adjuster's approval to settle a claim under review for up to amount.
+// Each adjuster approves a claim once; approving again replaces the earlier approval. Only certificates
+// carrying the adjuster attribute count: org admins, which otherwise hold every job role, do not.
+func (s *SmartContract) ApproveClaimSettlement(ctx contractapi.TransactionContextInterface, claimID string, amount float64, comment string) error {
+	isAdjuster, err := callerHasAttribute(ctx, JobAdjuster)
+	if err != nil {
+		return err
+	}
+	if !isAdjuster {
+		return accessDenied("approve claim settlements", JobAdjuster)
+	}
+	if amount <= 0 {
+		return fmt.Errorf("approved amount must be positive, got %.2f", amount)
+	}
+
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	if err := requirePolicyInsurer(ctx, claim.PolicyID, "approve claim settlements", insurerAdjuster); err != nil {
+		return err
+	}
+	if claim.Status != ClaimUnderReview && claim.Status != ClaimUnderAppeal {
+		return fmt.Errorf("claim %s is %s, only claims under review or appeal can be approved", claimID, claim.Status)
+	}
+
+	approverID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	approvals := []ClaimApproval{}
+	for _, approval := range claim.Approvals {
+		if approval.ApproverID != approverID {
+			approvals = append(approvals, approval)
+		}
+	}
+	claim.Approvals = append(approvals, ClaimApproval{
+		ApproverID: approverID,
+		Amount:     amount,
+		Comment:    comment,
+		ApprovedAt: timestamp.Seconds,
+	})
+
+	return putClaim(ctx, claim)
+}
+
+// requireSettlementApprovals fails unless enough distinct adjusters approved settling the claim for at least amount
+func requireSettlementApprovals(ctx contractapi.TransactionContextInterface, claim *Claim, amount float64) error {
+	missing, err := missingApprovals(ctx, claim, amount)
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		return fmt.Errorf("settling claim %s for %.2f needs %d more adjuster approval(s)", claim.ClaimID, amount, missing)
+	}
+
+	return nil
+}
+
+// missingApprovals counts how many more adjusters must approve settling the claim for amount
+func missingApprovals(ctx contractapi.TransactionContextInterface, claim *Claim, amount float64) (int, error) {
+	rule, err := getApprovalRule(ctx, claim.PolicyID)
+	if err != nil {
+		return 0, err
+	}
+	if rule.RequiredApprovals == 0 || amount <= rule.ThresholdAmount {
+		return 0, nil
+	}
+
+	// Approvals are unique per identity; only those covering the amount count
+	approved := 0
+	for _, approval := range claim.Approvals {
+		if approval.Amount >= amount {
+			approved++
+		}
+	}
+	if approved >= rule.RequiredApprovals {
+		return 0, nil
+	}
+
+	return rule.RequiredApprovals - approved, nil
+}
+
+// requirePolicyInsurer fails unless the caller holds the permission within the insurer that defined the policy
+func requirePolicyInsurer(ctx contractapi.TransactionContextInterface, policyID, action string, allowed ...permission) error {
+	if err := authorize(ctx, action, allowed...); err != nil {
+		return err
+	}
+
+	orgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	insurerMSP, err := policyInsurer(ctx, policyID)
+	if err != nil {
+		return err
+	}
+	if orgID != insurerMSP {
+		return accessDenied(action+" under policy "+policyID, insurerMSP)
+	}
+
+	return nil
+}
+
+func getApprovalRule(ctx contractapi.TransactionContextInterface, policyID string) (*ApprovalRule, error) {
+	ruleKey, err := ctx.GetStub().CreateCompositeKey("config", []string{"approvalRule", policyID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	ruleJSON, err := ctx.GetStub().GetState(ruleKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approval rule: %v", err)
+	}
+	if ruleJSON == nil {
+		return &ApprovalRule{PolicyID: policyID}, nil
+	}
+
+	var rule ApprovalRule
+	err = json.Unmarshal(ruleJSON, &rule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal approval rule: %v", err)
+	}
+
+	return &rule, nil
+}
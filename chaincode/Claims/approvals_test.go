@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLargeClaimNeedsApprovals(t *testing.T) {
+	adjuster := func(id string) *fakeIdentity {
+		return &fakeIdentity{id: id, mspID: "Org1MSP", attrs: map[string]string{JobAdjuster: "true"}}
+	}
+
+	registry := claimTestRegistry("")
+	registry["ConsumeCoverage user1"] = &CoverageDebit{SchemaVersion: "1.0", ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", RequestedAmount: 1500, GrantedAmount: 1500, RemainingAmount: 3500}
+	ctx, _ := newTestContext(t, withJob("Org1MSP", JobUnderwriter), registry)
+	contract := new(SmartContract)
+
+	if err := contract.SetApprovalRule(ctx, "POL1", 1000, 2); err != nil {
+		t.Fatal(err)
+	}
+	err := putClaim(ctx, &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimUnderReview, AwaitingApprovalFor: 1500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An org admin holds the adjuster job but does not count as an approving adjuster
+	ctx.SetClientIdentity(&fakeIdentity{id: "admin1", mspID: "Org1MSP", admin: true})
+	if err := contract.ApproveClaimSettlement(ctx, "CLM1", 1500, "ok"); !isAccessDenied(err) {
+		t.Fatalf("expected the admin's approval to be refused, got %v", err)
+	}
+
+	// Approvals for less than the settlement and repeated approvals by one adjuster do not count
+	for _, approval := range []struct {
+		approver string
+		amount   float64
+	}{{"adjuster1", 1500}, {"adjuster1", 1500}, {"adjuster2", 1200}} {
+		ctx.SetClientIdentity(adjuster(approval.approver))
+		if err := contract.ApproveClaimSettlement(ctx, "CLM1", approval.amount, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := contract.ApproveClaim(ctx, "CLM1", 1500, "approved"); err == nil {
+		t.Fatal("expected the settlement to wait for a second approval")
+	}
+
+	ctx.SetClientIdentity(adjuster("adjuster2"))
+	if err := contract.ApproveClaimSettlement(ctx, "CLM1", 1500, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := contract.ApproveClaim(ctx, "CLM1", 1500, "approved"); err != nil {
+		t.Fatal(err)
+	}
+
+	claim, err := getClaim(ctx, "CLM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.Status != ClaimApproved || claim.SettlementAmount != 1500 || claim.AwaitingApprovalFor != 0 {
+		t.Fatalf("expected 1500 settled, got %s for %.2f awaiting %.2f", claim.Status, claim.SettlementAmount, claim.AwaitingApprovalFor)
+	}
+}
+
+func TestMissingApprovals(t *testing.T) {
+	ctx, _ := newTestContext(t, withJob("Org1MSP", JobUnderwriter), claimTestRegistry(""))
+	if err := new(SmartContract).SetApprovalRule(ctx, "POL1", 1000, 2); err != nil {
+		t.Fatal(err)
+	}
+	claim := &Claim{ClaimID: "CLM1", PolicyID: "POL1", Approvals: []ClaimApproval{{ApproverID: "adjuster1", Amount: 1500}}}
+
+	tests := []struct {
+		amount float64
+		want   int
+	}{
+		{1000, 0}, // At the threshold no approvals are needed
+		{1500, 1},
+		{2000, 2}, // The approval for 1500 does not cover 2000
+	}
+	for _, tt := range tests {
+		got, err := missingApprovals(ctx, claim, tt.amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Fatalf("settling %.2f: expected %d missing approvals, got %d", tt.amount, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// maxClaimBatchSize caps how many claims one ProcessPendingClaims transaction adjudicates, keeping its
+// read/write set and response small enough to endorse and commit. Callers loop while Remaining is set.
+const maxClaimBatchSize = 25
+
+// BatchClaimResult is the outcome of one episode in a batch
+type BatchClaimResult struct {
+	EpisodeID string `json:"episodeId"`
+	UserID    string `json:"userId"`
+	ClaimID   string `json:"claimId,omitempty"`
+	Status    string `json:"status,omitempty"` // Claim status after adjudication
+	Error     string `json:"error,omitempty"`  // Set when the episode could not be claimed
+}
+
+// BatchClaimResults is the response of ProcessPendingClaims
+type BatchClaimResults struct {
+	Results   []BatchClaimResult `json:"results"`
+	Processed int                `json:"processed"`
+	Failed    int                `json:"failed"`
+	Remaining bool               `json:"remaining"` // More episodes are waiting; call again
+}
+
+// ProcessPendingClaims allows an adjuster to file and adjudicate claims for up to limit discharged episodes of
+// their insurer's members, capped at maxClaimBatchSize. An episode that fails is reported, marked with its
+// error and taken off the queue without its writes, and the batch carries on; it can be claimed again
+// through ProcessEpisodeClaim. An episode that fails after drawing cover fails the whole batch instead, as
+// only that undoes the draw; the batch can then be resubmitted.
+// A batch takes one episode per member, as two cover draws for a member in one transaction would both
+// read the same balance; the member's other episodes are left for the next batch.
+func (s *SmartContract) ProcessPendingClaims(ctx contractapi.TransactionContextInterface, limit int) (*BatchClaimResults, error) {
+	if err := authorize(ctx, "process pending claims", insurerAdjuster); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	if limit > maxClaimBatchSize {
+		limit = maxClaimBatchSize
+	}
+	callerMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(episodeCollection, episodePendingIndex, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve pending episodes: %v", err)
+	}
+	defer iterator.Close()
+
+	batch := &BatchClaimResults{Results: []BatchClaimResult{}}
+	members := make(map[string]bool)
+	for iterator.HasNext() {
+		if len(batch.Results) == limit {
+			batch.Remaining = true
+			break
+		}
+
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next pending episode: %v", err)
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+		userID, episodeID := keyParts[0], keyParts[1]
+
+		// Episodes of other insurers' members are left on the queue for them
+		ours, err := insuresMember(ctx, callerMSP, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !ours {
+			continue
+		}
+
+		if members[userID] {
+			batch.Remaining = true
+			continue
+		}
+		members[userID] = true
+
+		result := BatchClaimResult{EpisodeID: episodeID, UserID: userID}
+		claim, err := s.processStagedClaim(ctx, episodeID)
+		var unstaged *unstagedWriteError
+		if errors.As(err, &unstaged) {
+			return nil, err
+		}
+		if err != nil {
+			result.Error = err.Error()
+			batch.Failed++
+			if err := markEpisodeClaimFailed(ctx, episodeID, err); err != nil {
+				return nil, err
+			}
+		} else {
+			result.ClaimID = claim.ClaimID
+			result.Status = claim.Status
+			batch.Processed++
+		}
+		batch.Results = append(batch.Results, result)
+	}
+
+	return batch, nil
+}
+
+// insuresMember tells whether insurerMSP insures the member's primary policy. Episodes of members whose policy
+// cannot be looked up are left on the queue, and ProcessEpisodeClaim reports why they cannot be claimed.
+func insuresMember(ctx contractapi.TransactionContextInterface, insurerMSP, userID string) (bool, error) {
+	var lookup PolicyLookup
+	err := invokeRegistration(ctx, "LookupPolicyForUser", []string{userID}, &lookup)
+	if err != nil || lookup.PolicyID == "" {
+		return false, nil
+	}
+
+	policyInsurerMSP, err := policyInsurer(ctx, lookup.PolicyID)
+	if err != nil {
+		return false, err
+	}
+
+	return policyInsurerMSP == insurerMSP, nil
+}
+
+// processStagedClaim claims one episode on a staged stub and applies its writes and events only if it succeeds
+func (s *SmartContract) processStagedClaim(ctx contractapi.TransactionContextInterface, episodeID string) (*Claim, error) {
+	return stageClaim(ctx, episodeID, func(staged contractapi.TransactionContextInterface) (string, error) {
+		return s.ProcessEpisodeClaim(staged, episodeID)
+	})
+}
+
+// stageClaim files a claim on a staged stub and applies its writes and events only if it succeeds. A claim
+// that fails once some of its writes have reached the transaction fails with an unstagedWriteError.
+func stageClaim(ctx contractapi.TransactionContextInterface, episodeID string, file func(contractapi.TransactionContextInterface) (string, error)) (*Claim, error) {
+	staged := newStagedContext(ctx)
+
+	claimID, err := file(staged)
+	var claim *Claim
+	if err == nil {
+		// The claim can only be read back through the staged stub, as Fabric has no read-your-writes
+		claim, err = getClaim(staged, claimID)
+	}
+	if err != nil && staged.stub.unstaged {
+		return nil, &unstagedWriteError{episodeID: episodeID, err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := staged.commit(); err != nil {
+		return nil, &unstagedWriteError{episodeID: episodeID, err: err}
+	}
+
+	return claim, nil
+}
+
+// markEpisodeClaimFailed records why an episode could not be claimed, which also takes it off the pending queue
+func markEpisodeClaimFailed(ctx contractapi.TransactionContextInterface, episodeID string, claimErr error) error {
+	episode, err := getEpisode(ctx, episodeID)
+	if err != nil {
+		return err
+	}
+	episode.ClaimError = claimErr.Error()
+
+	return putEpisode(ctx, episode)
+}
+
+// unstagedWriteError is the failure of a staged claim after some of its writes reached the transaction, by
+// drawing cover through the registration chaincode or while its staged writes were applied. The batch
+// cannot drop such a claim on its own, so it fails as a whole.
+type unstagedWriteError struct {
+	episodeID string
+	err       error
+}
+
+func (e *unstagedWriteError) Error() string {
+	return fmt.Sprintf("episode %s failed after writing outside its staged writes, failing the batch: %v", e.episodeID, e.err)
+}
+
+// unstagedWrites are the functions of other chaincodes a claim calls that write to the ledger
+var unstagedWrites = map[string]bool{"ConsumeCoverage": true}
+
+// stagedWrite is one buffered write of a stagedStub
+type stagedWrite struct {
+	collection string // Empty for world state
+	key        string
+	value      []byte // Nil for a delete
+}
+
+// stagedStub buffers the writes of one claim in a batch so they can be dropped if the claim fails.
+// Reads see the buffered writes first. Range and composite key queries read committed state only, and
+// writes made by chaincode called from the claim go straight to the transaction, so such calls are noted.
+type stagedStub struct {
+	shim.ChaincodeStubInterface
+	writes      map[string]*stagedWrite
+	order       []string
+	validations []*stagedWrite // Key-level endorsement policies, applied after the writes
+	unstaged    bool           // The claim called a function in unstagedWrites
+}
+
+func stagedKey(collection, key string) string {
+	return collection + "\x00" + key
+}
+
+func (s *stagedStub) stage(collection, key string, value []byte) {
+	id := stagedKey(collection, key)
+	if _, ok := s.writes[id]; !ok {
+		s.order = append(s.order, id)
+	}
+	s.writes[id] = &stagedWrite{collection: collection, key: key, value: value}
+}
+
+func (s *stagedStub) read(collection, key string, committed func() ([]byte, error)) ([]byte, error) {
+	if write, ok := s.writes[stagedKey(collection, key)]; ok {
+		return write.value, nil
+	}
+
+	return committed()
+}
+
+func (s *stagedStub) GetState(key string) ([]byte, error) {
+	return s.read("", key, func() ([]byte, error) { return s.ChaincodeStubInterface.GetState(key) })
+}
+
+func (s *stagedStub) PutState(key string, value []byte) error {
+	s.stage("", key, value)
+	return nil
+}
+
+func (s *stagedStub) DelState(key string) error {
+	s.stage("", key, nil)
+	return nil
+}
+
+func (s *stagedStub) SetStateValidationParameter(key string, ep []byte) error {
+	s.validations = append(s.validations, &stagedWrite{key: key, value: ep})
+	return nil
+}
+
+func (s *stagedStub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	s.validations = append(s.validations, &stagedWrite{collection: collection, key: key, value: ep})
+	return nil
+}
+
+func (s *stagedStub) GetPrivateData(collection, key string) ([]byte, error) {
+	return s.read(collection, key, func() ([]byte, error) { return s.ChaincodeStubInterface.GetPrivateData(collection, key) })
+}
+
+func (s *stagedStub) PutPrivateData(collection, key string, value []byte) error {
+	s.stage(collection, key, value)
+	return nil
+}
+
+func (s *stagedStub) DelPrivateData(collection, key string) error {
+	s.stage(collection, key, nil)
+	return nil
+}
+
+func (s *stagedStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	if len(args) > 0 && unstagedWrites[string(args[0])] {
+		s.unstaged = true
+	}
+
+	return s.ChaincodeStubInterface.InvokeChaincode(chaincodeName, args, channel)
+}
+
+// stagedContext is a transaction context whose stub and events are held back until commit
+type stagedContext struct {
+	contractapi.TransactionContextInterface
+	stub   *stagedStub
+	events []EventRecord
+}
+
+func newStagedContext(ctx contractapi.TransactionContextInterface) *stagedContext {
+	return &stagedContext{
+		TransactionContextInterface: ctx,
+		stub:                        &stagedStub{ChaincodeStubInterface: ctx.GetStub(), writes: make(map[string]*stagedWrite)},
+	}
+}
+
+func (c *stagedContext) GetStub() shim.ChaincodeStubInterface {
+	return c.stub
+}
+
+func (c *stagedContext) queueEvent(event EventRecord) {
+	c.events = append(c.events, event)
+}
+
+// commit applies the buffered writes and events to the enclosing transaction
+func (c *stagedContext) commit() error {
+	parent := c.TransactionContextInterface
+	stub := parent.GetStub()
+	for _, id := range c.stub.order {
+		write := c.stub.writes[id]
+
+		var err error
+		switch {
+		case write.collection == "" && write.value == nil:
+			err = stub.DelState(write.key)
+		case write.collection == "":
+			err = stub.PutState(write.key, write.value)
+		case write.value == nil:
+			err = stub.DelPrivateData(write.collection, write.key)
+		default:
+			err = stub.PutPrivateData(write.collection, write.key, write.value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply staged write to %s: %v", write.key, err)
+		}
+	}
+
+	for _, validation := range c.stub.validations {
+		var err error
+		if validation.collection == "" {
+			err = stub.SetStateValidationParameter(validation.key, validation.value)
+		} else {
+			err = stub.SetPrivateDataValidationParameter(validation.collection, validation.key, validation.value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply staged endorsement policy to %s: %v", validation.key, err)
+		}
+	}
+
+	for _, event := range c.events {
+		emitEvent(parent, event.Type, event.Data)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestStageClaim(t *testing.T) {
+	claim := &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimApproved}
+	failure := errors.New("claim failed")
+
+	tests := []struct {
+		name       string
+		drawCover  bool
+		err        error
+		wantClaim  bool
+		failsBatch bool
+	}{
+		{"claim filed", true, nil, true, false},
+		{"claim failing before drawing cover", false, failure, false, false},
+		{"claim failing after drawing cover", true, failure, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := newTestContext(t, withJob("Org1MSP", JobAdjuster), map[string]interface{}{
+				"ConsumeCoverage user1": &CoverageDebit{SchemaVersion: "1.0", ClaimID: "CLM1", GrantedAmount: 100},
+			})
+
+			got, err := stageClaim(ctx, "EP1", func(staged contractapi.TransactionContextInterface) (string, error) {
+				if tt.drawCover {
+					if _, err := consumeCoverage(staged, claim, 100); err != nil {
+						return "", err
+					}
+				}
+				if err := putClaim(staged, claim); err != nil {
+					return "", err
+				}
+				return claim.ClaimID, tt.err
+			})
+
+			var unstaged *unstagedWriteError
+			if errors.As(err, &unstaged) != tt.failsBatch {
+				t.Fatalf("expected the batch to fail: %v, got %v", tt.failsBatch, err)
+			}
+			if tt.wantClaim && (err != nil || got == nil || got.ClaimID != claim.ClaimID) {
+				t.Fatalf("expected claim %s, got %+v, %v", claim.ClaimID, got, err)
+			}
+
+			stored, err := ctx.GetStub().GetPrivateData(claimsCollection, claim.ClaimID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (stored != nil) != tt.wantClaim {
+				t.Fatalf("expected the claim's writes applied: %v, got %s", tt.wantClaim, stored)
+			}
+		})
+	}
+}
+
+func TestInsuresMember(t *testing.T) {
+	tests := []struct {
+		name   string
+		lookup interface{}
+		want   bool
+	}{
+		{"member of the insurer", &PolicyLookup{SchemaVersion: "1.0", PolicyID: "POL1"}, true},
+		{"member of another insurer", &PolicyLookup{SchemaVersion: "1.0", PolicyID: "POL2"}, false},
+		{"member without a policy", &PolicyLookup{SchemaVersion: "1.0"}, false},
+		{"member whose policy cannot be looked up", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry("")
+			registry["QueryPolicy POL2"] = &Policy{PolicyID: "POL2", InsurerMSP: "Org2MSP"}
+			if tt.lookup != nil {
+				registry["LookupPolicyForUser user1"] = tt.lookup
+			}
+			ctx, _ := newTestContext(t, withJob("Org1MSP", JobAdjuster), registry)
+
+			got, err := insuresMember(ctx, "Org1MSP", "user1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
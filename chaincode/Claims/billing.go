@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// billCategories are the kinds of line a hospital bill can contain
+var billCategories = map[string]bool{
+	"room":       true,
+	"procedure":  true,
+	"drug":       true,
+	"consumable": true,
+}
+
+// Reason codes for adjustments made to a bill after line-item adjudication
+const (
+	AdjustmentPreAuthLimit = "PRE_AUTH_LIMIT"
+	AdjustmentCoverLimit   = "COVER_LIMIT"
+	AdjustmentOtherPayer   = "OTHER_PAYER"
+	ReasonNoAllowedAmount  = "NO_ALLOWED_AMOUNT"
+)
+
+// BillLine is one item of an itemised hospital bill
+type BillLine struct {
+	LineID      string  `json:"lineId"`
+	Category    string  `json:"category"` // One of billCategories
+	Code        string  `json:"code,omitempty"`
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitAmount  float64 `json:"unitAmount"`
+	Amount      float64 `json:"amount"`
+}
+
+// HospitalBill is the itemised bill for an episode of care, picked up by the claim for that episode
+type HospitalBill struct {
+	DocType     string     `json:"docType"`
+	EpisodeID   string     `json:"episodeId"`
+	UserID      string     `json:"userId"`
+	Lines       []BillLine `json:"lines"`
+	BilledTotal float64    `json:"billedTotal"`
+	SubmittedBy string     `json:"submittedBy"`
+	SubmittedAt int64      `json:"submittedAt"`
+	ClaimID     string     `json:"claimId,omitempty"` // Set once a claim has taken the bill
+}
+
+// LineDecision is the insurer's decision on one bill line
+type LineDecision struct {
+	LineID        string  `json:"lineId"`
+	Allowed       bool    `json:"allowed"`
+	AllowedAmount float64 `json:"allowedAmount,omitempty"` // Defaults to the full line amount when allowed
+	ReasonCode    string  `json:"reasonCode,omitempty"`
+}
+
+// EOBLine is a bill line with the decision taken on it
+type EOBLine struct {
+	Line          BillLine `json:"line"`
+	Allowed       bool     `json:"allowed"`
+	AllowedAmount float64  `json:"allowedAmount"`
+	ReasonCode    string   `json:"reasonCode,omitempty"`
+}
+
+// EOBAdjustment is a policy rule that reduced the allowed total
+type EOBAdjustment struct {
+	Rule   string  `json:"rule"`
+	Amount float64 `json:"amount"` // Negative: the amount taken off
+}
+
+// ExplanationOfBenefits documents how the settlement of an itemised claim was worked out
+type ExplanationOfBenefits struct {
+	DocType       string          `json:"docType"`
+	ClaimID       string          `json:"claimId"`
+	Lines         []EOBLine       `json:"lines"`
+	BilledTotal   float64         `json:"billedTotal"`
+	AllowedTotal  float64         `json:"allowedTotal"`
+	Adjustments   []EOBAdjustment `json:"adjustments"`
+	PayableAmount float64         `json:"payableAmount"`
+	IssuedBy      string          `json:"issuedBy"`
+	IssuedAt      int64           `json:"issuedAt"`
+}
+
+// SubmitHospitalBill allows a clinician of the admitting provider to submit the itemised bill for an episode of
+// care before it is claimed. Each episode has one bill, which cannot be replaced once submitted.
+func (s *SmartContract) SubmitHospitalBill(ctx contractapi.TransactionContextInterface, episodeID string, linesJSON string) error {
+	if err := authorize(ctx, "submit hospital bills", providerClinician); err != nil {
+		return err
+	}
+
+	episode, err := getEpisode(ctx, episodeID)
+	if err != nil {
+		return err
+	}
+	if err := requireAdmittingProvider(ctx, episode, "submit the bill for episode "+episodeID); err != nil {
+		return err
+	}
+	if episode.ClaimID != "" {
+		return fmt.Errorf("episode %s has already been claimed under %s", episodeID, episode.ClaimID)
+	}
+
+	existing, err := getHospitalBill(ctx, episodeID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ClaimID != "" {
+		return fmt.Errorf("the bill for episode %s has already been claimed under %s", episodeID, existing.ClaimID)
+	}
+	if existing != nil {
+		return fmt.Errorf("the bill for episode %s has already been submitted", episodeID)
+	}
+
+	var lines []BillLine
+	err = json.Unmarshal([]byte(linesJSON), &lines)
+	if err != nil {
+		return fmt.Errorf("failed to parse bill lines JSON: %v", err)
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("a hospital bill needs at least one line")
+	}
+
+	seen := make(map[string]bool)
+	billedTotal := 0.0
+	for _, line := range lines {
+		if line.LineID == "" || seen[line.LineID] {
+			return fmt.Errorf("bill lines need unique line IDs, got %q", line.LineID)
+		}
+		seen[line.LineID] = true
+		if !billCategories[line.Category] {
+			return fmt.Errorf("line %s has unknown category %s", line.LineID, line.Category)
+		}
+		if line.Quantity <= 0 || line.UnitAmount < 0 {
+			return fmt.Errorf("line %s needs a positive quantity and a non-negative unit amount", line.LineID)
+		}
+		if math.Abs(line.Quantity*line.UnitAmount-line.Amount) > 0.005 {
+			return fmt.Errorf("line %s amount %.2f does not equal quantity times unit amount", line.LineID, line.Amount)
+		}
+		billedTotal += line.Amount
+	}
+
+	submittedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	return putHospitalBill(ctx, &HospitalBill{
+		EpisodeID:   episodeID,
+		UserID:      episode.UserID,
+		Lines:       lines,
+		BilledTotal: billedTotal,
+		SubmittedBy: submittedBy,
+		SubmittedAt: timestamp.Seconds,
+	})
+}
+
+// AdjudicateBillLines allows an adjuster of the claim's insurer to allow or disallow every line of an itemised claim. The allowed lines
+// are summed, the policy limits applied, and the result stored as the claim's explanation of benefits.
+func (s *SmartContract) AdjudicateBillLines(ctx contractapi.TransactionContextInterface, claimID string, decisionsJSON string) (*ExplanationOfBenefits, error) {
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePolicyInsurer(ctx, claim.PolicyID, "adjudicate bill lines", insurerAdjuster); err != nil {
+		return nil, err
+	}
+	if len(claim.BillLines) == 0 {
+		return nil, fmt.Errorf("claim %s has no itemised bill", claimID)
+	}
+	if claim.Status != ClaimUnderReview {
+		return nil, fmt.Errorf("claim %s is %s, not %s", claimID, claim.Status, ClaimUnderReview)
+	}
+
+	var decisions []LineDecision
+	err = json.Unmarshal([]byte(decisionsJSON), &decisions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse line decisions JSON: %v", err)
+	}
+	insurerMSP, err := claimInsurer(ctx, claim)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := getProvider(ctx, insurerMSP, claim.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("provider %s of claim %s is no longer registered", claim.ProviderID, claimID)
+	}
+
+	decisionsByLine := make(map[string]LineDecision)
+	for _, decision := range decisions {
+		decisionsByLine[decision.LineID] = decision
+	}
+
+	eob := ExplanationOfBenefits{ClaimID: claimID, Adjustments: []EOBAdjustment{}}
+	for _, line := range claim.BillLines {
+		decision, ok := decisionsByLine[line.LineID]
+		if !ok {
+			return nil, fmt.Errorf("no decision for bill line %s", line.LineID)
+		}
+
+		eobLine := EOBLine{Line: line, Allowed: decision.Allowed, ReasonCode: decision.ReasonCode}
+		if decision.Allowed {
+			eobLine.AllowedAmount = line.Amount
+			if decision.AllowedAmount > 0 {
+				eobLine.AllowedAmount = math.Min(decision.AllowedAmount, line.Amount)
+			}
+		}
+		if eobLine.AllowedAmount < line.Amount && eobLine.ReasonCode == "" {
+			return nil, fmt.Errorf("a reason code is required to reduce or disallow bill line %s", line.LineID)
+		}
+
+		// Lines are never allowed above the provider's negotiated rate
+		if rate, ok := provider.FeeSchedule[line.Code]; ok && line.Code != "" {
+			if negotiated := rate * line.Quantity; eobLine.AllowedAmount > negotiated {
+				eobLine.AllowedAmount = negotiated
+				if eobLine.ReasonCode == "" {
+					eobLine.ReasonCode = AdjustmentFeeScheduleCap
+				}
+			}
+		}
+
+		eob.Lines = append(eob.Lines, eobLine)
+		eob.BilledTotal += line.Amount
+		eob.AllowedTotal += eobLine.AllowedAmount
+	}
+
+	eob.PayableAmount, err = applyPolicyLimits(ctx, claim, provider, &eob)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case eob.PayableAmount <= 0 && hasAdjustment(&eob, AdjustmentCoverLimit):
+		err = rejectClaim(ctx, claim, ReasonCoverExhausted, fmt.Sprintf("cover under policy %s is exhausted", claim.PolicyID))
+	case eob.PayableAmount <= 0:
+		err = rejectClaim(ctx, claim, ReasonNoAllowedAmount, "no part of the itemised bill is payable")
+	case eob.PayableAmount < eob.BilledTotal:
+		claim.SettlementAmount = eob.PayableAmount
+		err = transitionClaim(ctx, claim, ClaimPartiallyApproved, fmt.Sprintf("%.2f of %.2f billed is payable", eob.PayableAmount, eob.BilledTotal))
+	default:
+		claim.SettlementAmount = eob.PayableAmount
+		err = transitionClaim(ctx, claim, ClaimApproved, "all bill lines allowed")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	latest := claim.History[len(claim.History)-1]
+	eob.IssuedBy = latest.ActorID
+	eob.IssuedAt = latest.Timestamp
+
+	if err := putExplanationOfBenefits(ctx, &eob); err != nil {
+		return nil, err
+	}
+	if err := putClaim(ctx, claim); err != nil {
+		return nil, err
+	}
+	if err := syncEpisodeClaimStatus(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	return &eob, nil
+}
+
+// QueryExplanationOfBenefits retrieves the explanation of benefits issued for an itemised claim
+func (s *SmartContract) QueryExplanationOfBenefits(ctx contractapi.TransactionContextInterface, claimID string) (*ExplanationOfBenefits, error) {
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireClaimReader(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	eobKey, err := ctx.GetStub().CreateCompositeKey("eob", []string{claimID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	eobJSON, err := ctx.GetStub().GetPrivateData(claimsCollection, eobKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch explanation of benefits: %v", err)
+	}
+	if eobJSON == nil {
+		return nil, fmt.Errorf("no explanation of benefits has been issued for claim %s", claimID)
+	}
+
+	var eob ExplanationOfBenefits
+	err = json.Unmarshal(eobJSON, &eob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal explanation of benefits: %v", err)
+	}
+
+	return &eob, nil
+}
+
+// applyPolicyLimits applies the provider's network-tier rate to the allowed total, caps it at the pre-authorised
+// amount, at what a primary payer left of the charges and at the member's remaining cover, draws the result
+// from the cover and records every reduction on the explanation of benefits
+func applyPolicyLimits(ctx contractapi.TransactionContextInterface, claim *Claim, provider *Provider, eob *ExplanationOfBenefits) (float64, error) {
+	payable := eob.AllowedTotal
+
+	if rate := networkTierRates[provider.NetworkStatus]; rate < 1 {
+		eob.Adjustments = append(eob.Adjustments, EOBAdjustment{Rule: AdjustmentNetworkTierRate, Amount: payable*rate - payable})
+		payable = payable * rate
+	}
+
+	if claim.PreAuthID != "" {
+		preAuth, err := getPreAuthorization(ctx, claim.PreAuthID)
+		if err != nil {
+			return 0, err
+		}
+		if payable > preAuth.ApprovedAmount {
+			eob.Adjustments = append(eob.Adjustments, EOBAdjustment{Rule: AdjustmentPreAuthLimit, Amount: preAuth.ApprovedAmount - payable})
+			payable = preAuth.ApprovedAmount
+		}
+	}
+
+	coordinated, err := coordinatedAmount(ctx, claim, payable)
+	if err != nil {
+		return 0, err
+	}
+	if coordinated < payable {
+		eob.Adjustments = append(eob.Adjustments, EOBAdjustment{Rule: AdjustmentOtherPayer, Amount: coordinated - payable})
+		payable = coordinated
+	}
+	if payable <= 0 {
+		return 0, nil
+	}
+
+	if err := requireSettlementApprovals(ctx, claim, payable); err != nil {
+		return 0, err
+	}
+
+	var balance CoverageBalance
+	err = invokeRegistration(ctx, "QueryCoverageBalance", []string{claim.UserID, claim.PolicyID}, &balance)
+	if err != nil {
+		return 0, err
+	}
+	if balance.RemainingAmount <= 0 {
+		eob.Adjustments = append(eob.Adjustments, EOBAdjustment{Rule: AdjustmentCoverLimit, Amount: -payable})
+		return 0, nil
+	}
+
+	granted, err := consumeCoverage(ctx, claim, payable)
+	if err != nil {
+		return 0, err
+	}
+	if granted < payable {
+		eob.Adjustments = append(eob.Adjustments, EOBAdjustment{Rule: AdjustmentCoverLimit, Amount: granted - payable})
+	}
+
+	return granted, nil
+}
+
+// hasAdjustment tells whether a rule reduced the amount payable on an explanation of benefits
+func hasAdjustment(eob *ExplanationOfBenefits, rule string) bool {
+	for _, adjustment := range eob.Adjustments {
+		if adjustment.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// takeHospitalBill hands the bill of the claim's episode to the claim, or returns nil when there is none
+func takeHospitalBill(ctx contractapi.TransactionContextInterface, claim *Claim) (*HospitalBill, error) {
+	if claim.EpisodeID == "" {
+		return nil, nil
+	}
+
+	bill, err := getHospitalBill(ctx, claim.EpisodeID)
+	if err != nil {
+		return nil, err
+	}
+	if bill == nil || bill.ClaimID != "" {
+		return nil, nil
+	}
+
+	bill.ClaimID = claim.ClaimID
+	if err := putHospitalBill(ctx, bill); err != nil {
+		return nil, err
+	}
+
+	return bill, nil
+}
+
+// getHospitalBill returns the bill submitted for an episode, or nil when there is none
+func getHospitalBill(ctx contractapi.TransactionContextInterface, episodeID string) (*HospitalBill, error) {
+	billKey, err := ctx.GetStub().CreateCompositeKey("bill", []string{episodeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	billJSON, err := ctx.GetStub().GetPrivateData(claimsCollection, billKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch hospital bill: %v", err)
+	}
+	if billJSON == nil {
+		return nil, nil
+	}
+
+	var bill HospitalBill
+	err = json.Unmarshal(billJSON, &bill)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal hospital bill: %v", err)
+	}
+
+	return &bill, nil
+}
+
+func putHospitalBill(ctx contractapi.TransactionContextInterface, bill *HospitalBill) error {
+	billKey, err := ctx.GetStub().CreateCompositeKey("bill", []string{bill.EpisodeID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	bill.DocType = hospitalBillDocType
+	billJSON, err := json.Marshal(bill)
+	if err != nil {
+		return fmt.Errorf("failed to serialize hospital bill: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(claimsCollection, billKey, billJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store hospital bill: %v", err)
+	}
+
+	return nil
+}
+
+func putExplanationOfBenefits(ctx contractapi.TransactionContextInterface, eob *ExplanationOfBenefits) error {
+	eobKey, err := ctx.GetStub().CreateCompositeKey("eob", []string{eob.ClaimID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	eob.DocType = eobDocType
+	eobJSON, err := json.Marshal(eob)
+	if err != nil {
+		return fmt.Errorf("failed to serialize explanation of benefits: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(claimsCollection, eobKey, eobJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store explanation of benefits: %v", err)
+	}
+
+	return nil
+}
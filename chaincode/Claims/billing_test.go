@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// putItemisedClaim registers PRV1 with Org1MSP and stores CLM1, under review with a single bill line of 400
+func putItemisedClaim(t *testing.T, ctx *TransactionContext) {
+	t.Helper()
+
+	ctx.SetClientIdentity(withJob("Org1MSP", JobUnderwriter))
+	err := new(SmartContract).RegisterProvider(ctx, "PRV1", "City Hospital", "Org4MSP", InNetwork, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := BillLine{LineID: "L1", Category: "room", Description: "ward", Quantity: 1, UnitAmount: 400, Amount: 400}
+	claim := &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", ProviderID: "PRV1", Status: ClaimUnderReview, BillLines: []BillLine{line}, BilledAmount: 400, ClaimedAmount: 400}
+	if err := putClaim(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetClientIdentity(withJob("Org1MSP", JobAdjuster))
+}
+
+func TestAdjudicateBillLinesRejections(t *testing.T) {
+	tests := []struct {
+		name      string
+		decisions string
+		remaining float64 // The member's remaining cover
+		want      string
+	}{
+		{"every line disallowed", `[{"lineId":"L1","allowed":false,"reasonCode":"NOT_MEDICALLY_NECESSARY"}]`, 1000, ReasonNoAllowedAmount},
+		{"cover exhausted", `[{"lineId":"L1","allowed":true}]`, 0, ReasonCoverExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry("")
+			registry["QueryCoverageBalance user1"] = &CoverageBalance{UserID: "user1", PolicyID: "POL1", CoverAmount: 1000, RemainingAmount: tt.remaining}
+			ctx, _ := newTestContext(t, withJob("Org1MSP", JobAdjuster), registry)
+			putItemisedClaim(t, ctx)
+
+			eob, err := new(SmartContract).AdjudicateBillLines(ctx, "CLM1", tt.decisions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if eob.PayableAmount != 0 {
+				t.Fatalf("expected nothing payable, got %.2f", eob.PayableAmount)
+			}
+			claim, err := getClaim(ctx, "CLM1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claim.Status != ClaimRejected || claim.RejectionReasonCode != tt.want {
+				t.Fatalf("expected the claim rejected with %s, got %s with %q", tt.want, claim.Status, claim.RejectionReasonCode)
+			}
+		})
+	}
+}
+
+func TestApproveClaimRefusesItemisedClaims(t *testing.T) {
+	approvals := map[string]func(*SmartContract, *TransactionContext) error{
+		"approve": func(s *SmartContract, ctx *TransactionContext) error {
+			return s.ApproveClaim(ctx, "CLM1", 400, "approved")
+		},
+		"partially approve": func(s *SmartContract, ctx *TransactionContext) error {
+			return s.PartiallyApproveClaim(ctx, "CLM1", 200, "approved in part")
+		},
+	}
+
+	for name, approve := range approvals {
+		t.Run(name, func(t *testing.T) {
+			ctx, _ := newTestContext(t, withJob("Org1MSP", JobAdjuster), claimTestRegistry(""))
+			putItemisedClaim(t, ctx)
+
+			err := approve(new(SmartContract), ctx)
+			if err == nil || !strings.Contains(err.Error(), "AdjudicateBillLines") {
+				t.Fatalf("expected the approval refused in favour of AdjudicateBillLines, got %v", err)
+			}
+		})
+	}
+}
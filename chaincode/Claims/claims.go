@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// claimsCollection is the private data collection holding claims and their indexes
+const claimsCollection = "ClaimsPrivateCollection"
+
+// Composite key object types used to index claims inside claimsCollection
+const (
+	claimByUserIndex     = "claim~user"
+	claimByPolicyIndex   = "claim~policy"
+	claimByHospitalIndex = "claim~hospital"
+)
+
+// ClaimQueryResult is one page of claims. Pass Bookmark back to fetch the next page; it is empty on the last page.
+type ClaimQueryResult struct {
+	Claims              []*Claim `json:"claims"`
+	FetchedRecordsCount int32    `json:"fetchedRecordsCount"`
+	Bookmark            string   `json:"bookmark"`
+}
+
+// QueryClaimsByUser retrieves a page of the claims filed for a user. Members and their delegates see every
+// claim; adjusters and auditors only those filed with their insurer.
+func (s *SmartContract) QueryClaimsByUser(ctx contractapi.TransactionContextInterface, userID string, pageSize int32, bookmark string) (*ClaimQueryResult, error) {
+	callerID, err := callerUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if callerID != "" {
+		if err := authorizeActingFor(ctx, userID, "claim"); err != nil {
+			return nil, err
+		}
+		return queryClaimsByIndex(ctx, claimByUserIndex, userID, pageSize, bookmark)
+	}
+
+	reader, err := newClaimReader(ctx, "list claims of "+userID, insurerAdjuster, insurerAuditor)
+	if err != nil {
+		return nil, err
+	}
+	result, err := queryClaimsByIndex(ctx, claimByUserIndex, userID, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := []*Claim{}
+	for _, claim := range result.Claims {
+		ok, err := reader.canRead(ctx, claim)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			claims = append(claims, claim)
+		}
+	}
+	result.Claims = claims
+
+	return result, nil
+}
+
+// QueryClaimsByPolicy allows an adjuster or auditor of the policy's insurer to retrieve a page of the claims filed against it
+func (s *SmartContract) QueryClaimsByPolicy(ctx contractapi.TransactionContextInterface, policyID string, pageSize int32, bookmark string) (*ClaimQueryResult, error) {
+	if err := requirePolicyInsurer(ctx, policyID, "list claims", insurerAdjuster, insurerAuditor); err != nil {
+		return nil, err
+	}
+
+	return queryClaimsByIndex(ctx, claimByPolicyIndex, policyID, pageSize, bookmark)
+}
+
+// claimReader decides which claims a listing shows its caller: adjusters and auditors see the claims of their
+// own insurer, and members the claims filed for them
+type claimReader struct {
+	insurerMSP string
+	userID     string
+	insurers   map[string]string // Insurer of each policy seen so far
+}
+
+// newClaimReader authorises a listing for the allowed permissions and scopes it to the caller
+func newClaimReader(ctx contractapi.TransactionContextInterface, action string, allowed ...permission) (*claimReader, error) {
+	if err := authorize(ctx, action, allowed...); err != nil {
+		return nil, err
+	}
+
+	userID, err := callerUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if userID != "" {
+		// Confirms with the registry that the caller is the identity enrolled for the userID
+		if err := authorizeActingFor(ctx, userID, "claim"); err != nil {
+			return nil, err
+		}
+		return &claimReader{userID: userID}, nil
+	}
+
+	orgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	return &claimReader{insurerMSP: orgID, insurers: map[string]string{}}, nil
+}
+
+// canRead tells whether the claim belongs in the caller's listing
+func (r *claimReader) canRead(ctx contractapi.TransactionContextInterface, claim *Claim) (bool, error) {
+	if r.userID != "" {
+		return claim.UserID == r.userID, nil
+	}
+
+	insurer := claim.InsurerMSP
+	if insurer == "" {
+		cached, ok := r.insurers[claim.PolicyID]
+		if !ok {
+			var err error
+			cached, err = policyInsurer(ctx, claim.PolicyID)
+			if err != nil {
+				return false, err
+			}
+			r.insurers[claim.PolicyID] = cached
+		}
+		insurer = cached
+	}
+
+	return insurer == r.insurerMSP, nil
+}
+
+// requireClaimReader lets members and their delegates read the claims filed for them, and org identities that
+// are an adjuster or auditor of the claim's insurer or a clinician of the hospital that treated the patient
+func requireClaimReader(ctx contractapi.TransactionContextInterface, claim *Claim) error {
+	callerID, err := callerUserID(ctx)
+	if err != nil {
+		return err
+	}
+	if callerID != "" {
+		return authorizeActingFor(ctx, claim.UserID, "claim")
+	}
+
+	insurerMSP, err := claimInsurer(ctx, claim)
+	if err != nil {
+		return err
+	}
+	providerMSP, err := claimProvider(ctx, claim, insurerMSP)
+	if err != nil {
+		return err
+	}
+
+	return requireRecordOrg(ctx, "read claim "+claim.ClaimID, insurerMSP, providerMSP)
+}
+
+// requireRecordOrg admits an adjuster or auditor of the insurer and a clinician of the provider a record
+// belongs to. providerMSP may be "" when the record names no provider.
+func requireRecordOrg(ctx contractapi.TransactionContextInterface, action, insurerMSP, providerMSP string) error {
+	orgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	if orgID == insurerMSP {
+		ok, err := callerHolds(ctx, insurerAdjuster, insurerAuditor)
+		if err != nil || ok {
+			return err
+		}
+	}
+	if providerMSP != "" && orgID == providerMSP {
+		ok, err := callerHolds(ctx, providerClinician)
+		if err != nil || ok {
+			return err
+		}
+	}
+
+	requires := []string{insurerMSP}
+	if providerMSP != "" {
+		requires = append(requires, providerMSP)
+	}
+	return accessDenied(action, requires...)
+}
+
+// newClaimID derives a claim ID from the transaction so every endorser computes the same one.
+// The discriminator keeps IDs unique when one transaction creates several claims.
+func newClaimID(ctx contractapi.TransactionContextInterface, discriminator string) string {
+	sum := sha256.Sum256([]byte(ctx.GetStub().GetTxID() + ":" + discriminator))
+	return "CLM-" + hex.EncodeToString(sum[:8])
+}
+
+func getClaim(ctx contractapi.TransactionContextInterface, claimID string) (*Claim, error) {
+	claimJSON, err := ctx.GetStub().GetPrivateData(claimsCollection, claimID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch claim: %v", err)
+	}
+	if claimJSON == nil {
+		return nil, fmt.Errorf("claim %s does not exist", claimID)
+	}
+
+	var claim Claim
+	err = json.Unmarshal(claimJSON, &claim)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal claim: %v", err)
+	}
+
+	return &claim, nil
+}
+
+// putClaim stores the claim and keeps its user, policy and hospital indexes in step
+func putClaim(ctx contractapi.TransactionContextInterface, claim *Claim) error {
+	// A claim settles when its amount is approved, however it got there; count it in the analytics once
+	if (claim.Status == ClaimApproved || claim.Status == ClaimPartiallyApproved) && claim.SettledAt == 0 {
+		if err := recordClaimSettled(ctx, claim); err != nil {
+			return err
+		}
+	}
+
+	claim.DocType = claimDocType
+	claimJSON, err := json.Marshal(claim)
+	if err != nil {
+		return fmt.Errorf("failed to serialize claim: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(claimsCollection, claim.ClaimID, claimJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store claim details: %v", err)
+	}
+
+	// Let the member's other payer see this payer's settlement of the episode
+	err = shareClaimSettlement(ctx, claim, claimJSON)
+	if err != nil {
+		return err
+	}
+
+	indexes := map[string]string{
+		claimByUserIndex:     claim.UserID,
+		claimByPolicyIndex:   claim.PolicyID,
+		claimByHospitalIndex: claim.HospitalName,
+	}
+	for index, value := range indexes {
+		indexKey, err := ctx.GetStub().CreateCompositeKey(index, []string{value, claim.ClaimID})
+		if err != nil {
+			return fmt.Errorf("failed to create composite key: %v", err)
+		}
+		// Index entries only need a key; a single byte keeps the value non-nil
+		err = ctx.GetStub().PutPrivateData(claimsCollection, indexKey, []byte{0x00})
+		if err != nil {
+			return fmt.Errorf("failed to store claim index %s: %v", index, err)
+		}
+	}
+
+	return nil
+}
+
+// queryClaimsByIndex pages through one of the claim indexes. Private data has no native
+// pagination, so the bookmark is the last claim ID of the previous page.
+func queryClaimsByIndex(ctx contractapi.TransactionContextInterface, index, value string, pageSize int32, bookmark string) (*ClaimQueryResult, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive, got %d", pageSize)
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(claimsCollection, index, []string{value})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve claims: %v", err)
+	}
+	defer iterator.Close()
+
+	result := &ClaimQueryResult{Claims: []*Claim{}}
+	skipping := bookmark != ""
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next claim index entry: %v", err)
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+		claimID := keyParts[1]
+
+		if skipping {
+			skipping = claimID != bookmark
+			continue
+		}
+		if result.FetchedRecordsCount == pageSize {
+			result.Bookmark = result.Claims[len(result.Claims)-1].ClaimID
+			break
+		}
+
+		claim, err := getClaim(ctx, claimID)
+		if err != nil {
+			return nil, err
+		}
+		result.Claims = append(result.Claims, claim)
+		result.FetchedRecordsCount++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryClaimAccess(t *testing.T) {
+	member := &fakeIdentity{mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: "user2"}}
+
+	tests := []struct {
+		name      string
+		caller    *fakeIdentity
+		delegated bool // The registry confirms the caller may act for user1
+		allowed   bool
+	}{
+		{"member or delegate", member, true, true},
+		{"member without a delegation", member, false, false},
+		{"insurer's adjuster", withJob("Org1MSP", JobAdjuster), false, true},
+		{"insurer's auditor", withJob("Org1MSP", JobAuditor), false, true},
+		{"insurer's underwriter", withJob("Org1MSP", JobUnderwriter), false, false},
+		{"another insurer's adjuster", withJob("Org2MSP", JobAdjuster), false, false},
+		{"another insurer's adjuster with a delegation", withJob("Org2MSP", JobAdjuster), true, false},
+		{"admitting provider's clinician", withJob("Org4MSP", JobClinician), false, true},
+		{"another provider's clinician", withJob("Org5MSP", JobClinician), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry("")
+			registry["OrgRegistryContract:QueryOrg Org5MSP"] = testOrg("Org5MSP", RoleProvider)
+			if tt.delegated {
+				registry["VerifyDelegation user1"] = true
+			}
+			ctx, _ := newTestContext(t, tt.caller, registry)
+
+			err := putEpisode(ctx, &Episode{EpisodeID: "EP1", UserID: "user1", ProviderMSP: "Org4MSP", Status: EpisodeAdmitted})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = putClaim(ctx, &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", EpisodeID: "EP1", Status: ClaimSubmitted})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = new(SmartContract).QueryClaim(ctx, "CLM1")
+			if tt.allowed && err != nil {
+				t.Fatalf("expected to read the claim, got %v", err)
+			}
+			if !tt.allowed && !isAccessDenied(err) {
+				t.Fatalf("expected an access denial, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewClaimID(t *testing.T) {
+	ctx, stub := newTestContext(t, withJob("Org1MSP", JobAdjuster), claimTestRegistry(""))
+
+	first := newClaimID(ctx, "EP1")
+	if again := newClaimID(ctx, "EP1"); again != first {
+		t.Fatalf("expected every endorser to derive %s, got %s", first, again)
+	}
+	if other := newClaimID(ctx, "EP2"); other == first {
+		t.Fatal("expected claims created in one transaction to get different IDs")
+	}
+	stub.MockTransactionEnd("")
+	stub.MockTransactionStart("tx2")
+	if later := newClaimID(ctx, "EP1"); later == first {
+		t.Fatal("expected a later transaction to get a different ID")
+	}
+}
+
+func TestQueryClaimsByUserPages(t *testing.T) {
+	member := &fakeIdentity{mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: "user1"}}
+	registry := claimTestRegistry("")
+	registry["VerifyDelegation user1"] = true
+	ctx, _ := newTestContext(t, member, registry)
+
+	for _, claim := range []*Claim{
+		{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimApproved},
+		{ClaimID: "CLM2", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimSubmitted},
+		{ClaimID: "CLM3", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimSubmitted},
+		{ClaimID: "CLM4", UserID: "user2", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimSubmitted},
+	} {
+		if err := putClaim(ctx, claim); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var claimIDs []string
+	bookmark := ""
+	for pages := 1; ; pages++ {
+		result, err := new(SmartContract).QueryClaimsByUser(ctx, "user1", 2, bookmark)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, claim := range result.Claims {
+			claimIDs = append(claimIDs, claim.ClaimID)
+		}
+		if result.Bookmark == "" {
+			if pages != 2 {
+				t.Fatalf("expected two pages, got %d", pages)
+			}
+			break
+		}
+		bookmark = result.Bookmark
+	}
+	if strings.Join(claimIDs, ",") != "CLM1,CLM2,CLM3" {
+		t.Fatalf("expected user1's three claims, got %v", claimIDs)
+	}
+}
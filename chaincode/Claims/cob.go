@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// coordinationCollection is shared by every insurer. It holds amounts and claim hashes only, so a payer
+// can see what another payer settled for an episode without reading the other payer's claim.
+const coordinationCollection = "ClaimsCoordinationCollection"
+
+// Payer ranks of a claim under coordination of benefits
+const (
+	PayerPrimary   = "primary"
+	PayerSecondary = "secondary"
+)
+
+// ReasonPaidByPrimary is the rejection reason code of a secondary claim with nothing left to pay
+const ReasonPaidByPrimary = "COB_PAID_BY_PRIMARY"
+
+// PayerSettlement is one payer's position on an episode as shared with the other payers
+type PayerSettlement struct {
+	PolicyID      string  `json:"policyId"`
+	ClaimHash     string  `json:"claimHash"` // SHA-256 of the claim as stored in the claims collection
+	Status        string  `json:"status"`
+	ClaimedAmount float64 `json:"claimedAmount,omitempty"` // What the claim asked to settle; 0 on records shared before it was kept
+	SettledAmount float64 `json:"settledAmount"`
+	UpdatedAt     int64   `json:"updatedAt"`
+}
+
+// BenefitCoordination is what the payers of an episode share. It is keyed by a hash of the member and
+// episode rather than by either of them.
+type BenefitCoordination struct {
+	DocType      string           `json:"docType"`
+	EpisodeHash  string           `json:"episodeHash"`
+	BilledAmount float64          `json:"billedAmount"` // The episode's itemised charges; 0 when the primary claim had no bill
+	Primary      *PayerSettlement `json:"primary,omitempty"`
+	Secondary    *PayerSettlement `json:"secondary,omitempty"`
+}
+
+// ProcessSecondaryClaim files a claim for an episode with the member's secondary payer once the primary
+// payer has decided its claim. The secondary payer pays at most what is left of the billed charges after
+// the primary payer's settlement, or acts as the primary payer if the primary claim was rejected. The member,
+// a delegate covering claim or an adjuster of the secondary payer can file it.
+func (s *SmartContract) ProcessSecondaryClaim(ctx contractapi.TransactionContextInterface, episodeID string) (string, error) {
+	episode, err := getEpisode(ctx, episodeID)
+	if err != nil {
+		return "", err
+	}
+	userID := episode.UserID
+
+	if err := authorizeActingFor(ctx, userID, "claim"); err != nil {
+		return "", err
+	}
+	if episode.ClaimID == "" {
+		return "", fmt.Errorf("episode %s must be claimed with the primary payer first", episodeID)
+	}
+	if episode.SecondaryClaimID != "" {
+		return "", fmt.Errorf("episode %s has already been claimed with the secondary payer under %s", episodeID, episode.SecondaryClaimID)
+	}
+
+	coordination, err := getBenefitCoordination(ctx, userID, episodeID)
+	if err != nil {
+		return "", err
+	}
+	if coordination == nil || coordination.Primary == nil || !payerDecided(coordination.Primary) {
+		return "", fmt.Errorf("the primary payer has not decided claim %s yet", episode.ClaimID)
+	}
+
+	var order PayerOrder
+	err = invokeRegistration(ctx, "QueryPayerOrder", []string{userID}, &order)
+	if err != nil {
+		return "", fmt.Errorf("failed to query payer order for user %s: %v", userID, err)
+	}
+	if order.SecondaryPolicyID == "" {
+		return "", fmt.Errorf("user %s has no secondary payer", userID)
+	}
+
+	if err := requireFilingInsurer(ctx, userID, order.SecondaryPolicyID); err != nil {
+		return "", err
+	}
+
+	var policy Policy
+	err = invokeRegistration(ctx, "QueryPolicy", []string{order.SecondaryPolicyID}, &policy)
+	if err != nil {
+		return "", fmt.Errorf("failed to query policy %s: %v", order.SecondaryPolicyID, err)
+	}
+
+	claim, err := fileEpisodeClaim(ctx, episode, &policy, PayerSecondary)
+	if err != nil {
+		return "", err
+	}
+
+	episode.SecondaryClaimID = claim.ClaimID
+	episode.SecondaryClaimStatus = claim.Status
+	err = putEpisode(ctx, episode)
+	if err != nil {
+		return "", err
+	}
+
+	return claim.ClaimID, nil
+}
+
+// QueryBenefitCoordination allows an adjuster or auditor to see what each payer settled for an episode
+func (s *SmartContract) QueryBenefitCoordination(ctx contractapi.TransactionContextInterface, userID, episodeID string) (*BenefitCoordination, error) {
+	if err := authorize(ctx, "query benefit coordination", insurerAdjuster, insurerAuditor); err != nil {
+		return nil, err
+	}
+
+	coordination, err := getBenefitCoordination(ctx, userID, episodeID)
+	if err != nil {
+		return nil, err
+	}
+	if coordination == nil {
+		return nil, fmt.Errorf("no payer has claimed episode %s", episodeID)
+	}
+
+	return coordination, nil
+}
+
+// coordinatedAmount caps what a secondary claim may settle at the charges left after the primary payer's
+// settlement, and records that settlement on the claim. The charges are the episode's itemised bill or,
+// when the primary claim had none, what the primary claim asked to settle. Primary claims are not capped,
+// nor are secondary claims whose primary claim was shared before its amount was kept.
+func coordinatedAmount(ctx contractapi.TransactionContextInterface, claim *Claim, amount float64) (float64, error) {
+	if claim.PayerRank != PayerSecondary {
+		return amount, nil
+	}
+
+	coordination, err := getBenefitCoordination(ctx, claim.UserID, claim.EpisodeID)
+	if err != nil {
+		return 0, err
+	}
+	if coordination == nil || coordination.Primary == nil || !payerDecided(coordination.Primary) {
+		return 0, fmt.Errorf("the primary payer has not decided episode %s yet", claim.EpisodeID)
+	}
+	if coordination.Primary.Status == ClaimRejected {
+		claim.OtherPayerPaid = 0
+		return amount, nil
+	}
+
+	claim.OtherPayerPaid = coordination.Primary.SettledAmount
+	charges := coordination.BilledAmount
+	if charges == 0 {
+		charges = coordination.Primary.ClaimedAmount
+	}
+	if charges == 0 {
+		return amount, nil
+	}
+	remaining := math.Max(charges-coordination.Primary.SettledAmount, 0)
+
+	return math.Min(amount, remaining), nil
+}
+
+// payerDecided tells whether a payer's claim has been approved, rejected or paid
+func payerDecided(settlement *PayerSettlement) bool {
+	switch settlement.Status {
+	case ClaimApproved, ClaimPartiallyApproved, ClaimRejected, ClaimPaid, ClaimClosed:
+		return true
+	}
+	return false
+}
+
+// shareClaimSettlement publishes a claim's status, amounts and hash to the coordination collection
+func shareClaimSettlement(ctx contractapi.TransactionContextInterface, claim *Claim, claimJSON []byte) error {
+	// Claims filed before coordination of benefits have no payer rank and nothing to share
+	if claim.EpisodeID == "" || claim.PayerRank == "" {
+		return nil
+	}
+
+	coordination, err := getBenefitCoordination(ctx, claim.UserID, claim.EpisodeID)
+	if err != nil {
+		return err
+	}
+	if coordination == nil {
+		coordination = &BenefitCoordination{EpisodeHash: episodeHash(claim.UserID, claim.EpisodeID)}
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	claimHash := sha256.Sum256(claimJSON)
+	settlement := &PayerSettlement{
+		PolicyID:      claim.PolicyID,
+		ClaimHash:     hex.EncodeToString(claimHash[:]),
+		Status:        claim.Status,
+		ClaimedAmount: claim.ClaimedAmount,
+		SettledAmount: claim.SettlementAmount,
+		UpdatedAt:     timestamp.Seconds,
+	}
+
+	if claim.PayerRank == PayerSecondary {
+		coordination.Secondary = settlement
+	} else {
+		coordination.Primary = settlement
+		coordination.BilledAmount = claim.BilledAmount
+	}
+
+	return putBenefitCoordination(ctx, coordination)
+}
+
+// episodeHash identifies an episode in the coordination collection without naming the member or episode
+func episodeHash(userID, episodeID string) string {
+	sum := sha256.Sum256([]byte(userID + ":" + episodeID))
+	return hex.EncodeToString(sum[:])
+}
+
+func getBenefitCoordination(ctx contractapi.TransactionContextInterface, userID, episodeID string) (*BenefitCoordination, error) {
+	coordinationKey, err := ctx.GetStub().CreateCompositeKey("cob", []string{episodeHash(userID, episodeID)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	coordinationJSON, err := ctx.GetStub().GetPrivateData(coordinationCollection, coordinationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch benefit coordination: %v", err)
+	}
+	if coordinationJSON == nil {
+		return nil, nil
+	}
+
+	var coordination BenefitCoordination
+	err = json.Unmarshal(coordinationJSON, &coordination)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal benefit coordination: %v", err)
+	}
+
+	return &coordination, nil
+}
+
+func putBenefitCoordination(ctx contractapi.TransactionContextInterface, coordination *BenefitCoordination) error {
+	coordinationKey, err := ctx.GetStub().CreateCompositeKey("cob", []string{coordination.EpisodeHash})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	coordination.DocType = benefitCoordinationDocType
+	coordinationJSON, err := json.Marshal(coordination)
+	if err != nil {
+		return fmt.Errorf("failed to serialize benefit coordination: %v", err)
+	}
+
+	return ctx.GetStub().PutPrivateData(coordinationCollection, coordinationKey, coordinationJSON)
+}
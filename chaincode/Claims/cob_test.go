@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCoordinatedAmount(t *testing.T) {
+	tests := []struct {
+		name         string
+		billed       float64
+		primary      *PayerSettlement
+		amount       float64
+		want         float64
+		wantOtherPay float64
+	}{
+		{"billed charges left after the primary", 1000, &PayerSettlement{Status: ClaimApproved, ClaimedAmount: 1000, SettledAmount: 600}, 500, 400, 600},
+		{"less than what is left", 1000, &PayerSettlement{Status: ClaimPaid, ClaimedAmount: 1000, SettledAmount: 600}, 300, 300, 600},
+		{"nothing left of the bill", 1000, &PayerSettlement{Status: ClaimApproved, ClaimedAmount: 1000, SettledAmount: 1000}, 500, 0, 1000},
+		{"no bill falls back to the primary claim", 0, &PayerSettlement{Status: ClaimPartiallyApproved, ClaimedAmount: 800, SettledAmount: 500}, 1000, 300, 500},
+		{"primary claim shared before its amount was kept", 0, &PayerSettlement{Status: ClaimApproved, SettledAmount: 500}, 700, 700, 500},
+		{"rejected primary leaves the secondary as first payer", 1000, &PayerSettlement{Status: ClaimRejected, ClaimedAmount: 1000}, 900, 900, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := newTestContext(t, withJob("Org2MSP", JobAdjuster), nil)
+			err := putBenefitCoordination(ctx, &BenefitCoordination{
+				EpisodeHash:  episodeHash("user1", "EP1"),
+				BilledAmount: tt.billed,
+				Primary:      tt.primary,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claim := &Claim{ClaimID: "CLM2", UserID: "user1", EpisodeID: "EP1", PayerRank: PayerSecondary}
+			got, err := coordinatedAmount(ctx, claim, tt.amount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %.2f payable, got %.2f", tt.want, got)
+			}
+			if claim.OtherPayerPaid != tt.wantOtherPay {
+				t.Fatalf("expected the primary's %.2f recorded, got %.2f", tt.wantOtherPay, claim.OtherPayerPaid)
+			}
+		})
+	}
+}
+
+func TestCoordinatedAmountLeavesPrimaryClaims(t *testing.T) {
+	ctx, _ := newTestContext(t, withJob("Org1MSP", JobAdjuster), nil)
+
+	for _, rank := range []string{PayerPrimary, ""} {
+		got, err := coordinatedAmount(ctx, &Claim{UserID: "user1", EpisodeID: "EP1", PayerRank: rank}, 750)
+		if err != nil || got != 750 {
+			t.Fatalf("expected a %q claim to be uncapped, got %.2f, %v", rank, got, err)
+		}
+	}
+}
+
+func TestCoordinatedAmountWaitsForPrimaryDecision(t *testing.T) {
+	ctx, _ := newTestContext(t, withJob("Org2MSP", JobAdjuster), nil)
+	claim := &Claim{UserID: "user1", EpisodeID: "EP1", PayerRank: PayerSecondary}
+
+	if _, err := coordinatedAmount(ctx, claim, 100); err == nil {
+		t.Fatal("expected a secondary claim without a primary claim to be refused")
+	}
+
+	err := putBenefitCoordination(ctx, &BenefitCoordination{
+		EpisodeHash: episodeHash("user1", "EP1"),
+		Primary:     &PayerSettlement{Status: ClaimUnderReview, ClaimedAmount: 500},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := coordinatedAmount(ctx, claim, 100); err == nil {
+		t.Fatal("expected a secondary claim to wait until the primary claim is decided")
+	}
+}
+
+func TestSharedSettlementCapsSecondaryClaim(t *testing.T) {
+	ctx, _ := newTestContext(t, withJob("Org1MSP", JobAdjuster), nil)
+
+	primary := &Claim{
+		ClaimID:          "CLM1",
+		UserID:           "user1",
+		PolicyID:         "POL1",
+		EpisodeID:        "EP1",
+		PayerRank:        PayerPrimary,
+		Status:           ClaimApproved,
+		ClaimedAmount:    800,
+		SettlementAmount: 500,
+	}
+	if err := shareClaimSettlement(ctx, primary, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	secondary := &Claim{ClaimID: "CLM2", UserID: "user1", EpisodeID: "EP1", PayerRank: PayerSecondary}
+	got, err := coordinatedAmount(ctx, secondary, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 300 {
+		t.Fatalf("expected the 300 the primary left of its claim, got %.2f", got)
+	}
+}
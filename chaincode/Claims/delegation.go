@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// userIDAttribute is the certificate attribute carrying the userID of a member acting for themselves or a dependant
+const userIDAttribute = "userId"
+
+// authorizeActingFor checks with the registry chaincode that a member caller is the identity enrolled
+// for their userID and, when acting for somebody else, holds a delegation with the given scope. Org
+// identities carry no userID and pass through; callers check them against the record acted on.
+func authorizeActingFor(ctx contractapi.TransactionContextInterface, userID, scope string) error {
+	callerID, err := callerUserID(ctx)
+	if err != nil {
+		return err
+	}
+	if callerID == "" {
+		return nil
+	}
+
+	err = invokeRegistry(ctx, "VerifyDelegation", []string{userID, scope}, nil)
+	if err != nil {
+		return accessDenied("act for "+userID, "the identity enrolled for "+userID, "a live delegation covering "+scope)
+	}
+
+	return nil
+}
+
+// callerUserID returns the userID carried by the caller's certificate, or "" for org identities. Only the
+// registration chaincode knows which identity enrolled it, so authorizeActingFor confirms it there.
+func callerUserID(ctx contractapi.TransactionContextInterface) (string, error) {
+	userID, _, err := ctx.GetClientIdentity().GetAttributeValue(userIDAttribute)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client attributes: %v", err)
+	}
+
+	return userID, nil
+}
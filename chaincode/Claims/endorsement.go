@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// RotateClaimEndorsement allows an org admin of the insurer of a claim's policy to change the orgs whose peers
+// must all endorse updates to the claim. The orgs must be registered and include the claim's hospital and
+// insurer, and an empty list resets it to those two. The transaction itself must be endorsed by the claim's
+// current endorsers.
+func (s *SmartContract) RotateClaimEndorsement(ctx contractapi.TransactionContextInterface, claimID string, endorsersJSON string) error {
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	if err := requirePolicyInsurer(ctx, claim.PolicyID, "rotate claim endorsement policies", insurerAdjuster); err != nil {
+		return err
+	}
+	isAdmin, err := callerIsOrgAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return accessDenied("rotate claim endorsement policies", "an org admin certificate")
+	}
+
+	required, err := claimEndorsers(ctx, claim)
+	if err != nil {
+		return err
+	}
+
+	var endorsers []string
+	if endorsersJSON != "" {
+		err = json.Unmarshal([]byte(endorsersJSON), &endorsers)
+		if err != nil {
+			return fmt.Errorf("failed to parse endorsers JSON: %v", err)
+		}
+	}
+	if len(endorsers) == 0 {
+		endorsers = required
+	}
+	for _, mspID := range required {
+		if !includesOrg(endorsers, mspID) {
+			return fmt.Errorf("the endorsers of claim %s must include %s", claimID, mspID)
+		}
+	}
+	for _, mspID := range endorsers {
+		var org OrgRecord
+		err = invokeRegistry(ctx, "OrgRegistryContract:QueryOrg", []string{mspID}, &org)
+		if err != nil {
+			return fmt.Errorf("failed to look up %s: %v", mspID, err)
+		}
+		if org.DocType == "" {
+			return fmt.Errorf("endorser %s is not registered in the organisation registry", mspID)
+		}
+	}
+
+	return setClaimEndorsers(ctx, claim.ClaimID, endorsers)
+}
+
+// QueryClaimEndorsement lists the orgs that must endorse updates to a claim; an empty list means the
+// chaincode endorsement policy applies
+func (s *SmartContract) QueryClaimEndorsement(ctx contractapi.TransactionContextInterface, claimID string) ([]string, error) {
+	policy, err := ctx.GetStub().GetPrivateDataValidationParameter(claimsCollection, claimID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read endorsement policy of claim %s: %v", claimID, err)
+	}
+	if len(policy) == 0 {
+		return []string{}, nil
+	}
+
+	endorsement, err := statebased.NewStateEP(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endorsement policy of claim %s: %v", claimID, err)
+	}
+
+	return endorsement.ListOrgs(), nil
+}
+
+// claimEndorsers returns the hospital and insurer of a claim, which must both endorse its settlement. Claims
+// without a known hospital are endorsed by the insurer alone.
+func claimEndorsers(ctx contractapi.TransactionContextInterface, claim *Claim) ([]string, error) {
+	insurerMSP, err := claimInsurer(ctx, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	providerMSP, err := claimProvider(ctx, claim, insurerMSP)
+	if err != nil {
+		return nil, err
+	}
+
+	if providerMSP == "" || providerMSP == insurerMSP {
+		return []string{insurerMSP}, nil
+	}
+	return []string{providerMSP, insurerMSP}, nil
+}
+
+// setClaimEndorsers requires a peer of every given org to endorse later updates to the claim
+func setClaimEndorsers(ctx contractapi.TransactionContextInterface, claimID string, endorsers []string) error {
+	policy, err := endorsementPolicy(endorsers)
+	if err != nil {
+		return fmt.Errorf("failed to build endorsement policy of claim %s: %v", claimID, err)
+	}
+
+	err = ctx.GetStub().SetPrivateDataValidationParameter(claimsCollection, claimID, policy)
+	if err != nil {
+		return fmt.Errorf("failed to set endorsement policy of claim %s: %v", claimID, err)
+	}
+
+	return nil
+}
+
+// setKeyEndorsers requires a peer of every given org to endorse later updates to a public key
+func setKeyEndorsers(ctx contractapi.TransactionContextInterface, key string, endorsers []string) error {
+	policy, err := endorsementPolicy(endorsers)
+	if err != nil {
+		return fmt.Errorf("failed to build endorsement policy of %s: %v", key, err)
+	}
+
+	err = ctx.GetStub().SetStateValidationParameter(key, policy)
+	if err != nil {
+		return fmt.Errorf("failed to set endorsement policy of %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// endorsementPolicy builds a key-level policy requiring a peer of every given org
+func endorsementPolicy(endorsers []string) ([]byte, error) {
+	endorsement, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return nil, err
+	}
+	err = endorsement.AddOrgs(statebased.RoleTypePeer, endorsers...)
+	if err != nil {
+		return nil, err
+	}
+
+	return endorsement.Policy()
+}
+
+// includesOrg tells whether mspID is among the orgs
+func includesOrg(orgs []string, mspID string) bool {
+	for _, org := range orgs {
+		if org == mspID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRotateClaimEndorsement(t *testing.T) {
+	insurerAdmin := &fakeIdentity{id: "admin1", mspID: "Org1MSP", admin: true}
+
+	tests := []struct {
+		name      string
+		caller    *fakeIdentity
+		endorsers string
+		want      []string // Nil when the rotation is refused
+	}{
+		{"insurer admin resets to the hospital and insurer", insurerAdmin, "", []string{"Org1MSP", "Org4MSP"}},
+		{"insurer admin adds a registered org", insurerAdmin, `["Org1MSP","Org3MSP","Org4MSP"]`, []string{"Org1MSP", "Org3MSP", "Org4MSP"}},
+		{"endorsers without the hospital", insurerAdmin, `["Org1MSP"]`, nil},
+		{"unregistered endorser", insurerAdmin, `["Org1MSP","Org4MSP","Org9MSP"]`, nil},
+		{"adjuster without an admin certificate", withJob("Org1MSP", JobAdjuster), "", nil},
+		{"admin of another insurer", &fakeIdentity{id: "admin2", mspID: "Org2MSP", admin: true}, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry("")
+			registry["OrgRegistryContract:QueryOrg Org9MSP"] = &OrgRecord{MSPID: "Org9MSP"}
+			ctx, _ := newTestContext(t, tt.caller, registry)
+
+			err := putEpisode(ctx, &Episode{EpisodeID: "EP1", UserID: "user1", ProviderMSP: "Org4MSP", Status: EpisodeDischarged})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = putClaim(ctx, &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", EpisodeID: "EP1", Status: ClaimApproved})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = new(SmartContract).RotateClaimEndorsement(ctx, "CLM1", tt.endorsers)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("expected the rotation to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := new(SmartContract).QueryClaimEndorsement(ctx, "CLM1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected endorsers %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// episodeCollection holds the clinical record of every episode of care. Its members are the hospitals that
+// record episodes and the insurers whose transactions claim them and track their claim status, and it
+// keeps episodes for good, as claims and appeals refer to them long after discharge.
+const episodeCollection = "ClaimsEpisodeCollection"
+
+// episodeByUserIndex is the composite key object type indexing episodes by patient
+const episodeByUserIndex = "episode~user"
+
+// episodePendingIndex is the composite key object type listing discharged episodes awaiting a claim
+const episodePendingIndex = "episode~pending"
+
+// Episode states
+const (
+	EpisodeAdmitted   = "Admitted"
+	EpisodeDischarged = "Discharged"
+)
+
+// EpisodeEntry is one admission, diagnosis, treatment or discharge note within an episode
+type EpisodeEntry struct {
+	Date       string `json:"date,omitempty"` // Set on admission and discharge entries
+	Detail     string `json:"detail"`
+	RecordedBy string `json:"recordedBy"`
+	RecordedAt int64  `json:"recordedAt"`
+}
+
+// Episode is one hospital stay, from admission to discharge. A patient can have any number of episodes,
+// and each episode is claimed at most once.
+type Episode struct {
+	DocType      string         `json:"docType"`
+	EpisodeID    string         `json:"episodeId"`
+	UserID       string         `json:"userId"`
+	HospitalName string         `json:"hospitalName"`
+	ProviderMSP  string         `json:"providerMsp,omitempty"` // The admitting provider; empty on episodes admitted before it was kept
+	Status       string         `json:"status"`                // EpisodeAdmitted or EpisodeDischarged
+	Admission    EpisodeEntry   `json:"admission"`
+	Diagnoses    []EpisodeEntry `json:"diagnoses"`
+	Treatments   []EpisodeEntry `json:"treatments"`
+	Discharge    *EpisodeEntry  `json:"discharge,omitempty"`
+	ClaimID      string         `json:"claimId,omitempty"`
+	ClaimStatus  string         `json:"claimStatus,omitempty"`
+	ClaimError   string         `json:"claimError,omitempty"` // Why the last batch claim attempt failed
+	// The claim filed with the member's secondary payer under coordination of benefits
+	SecondaryClaimID     string `json:"secondaryClaimId,omitempty"`
+	SecondaryClaimStatus string `json:"secondaryClaimStatus,omitempty"`
+}
+
+// AdmitPatient allows a clinician to open an episode of care and returns its ID
+func (s *SmartContract) AdmitPatient(ctx contractapi.TransactionContextInterface, userID, hospitalName, admissionDate, reason string) (string, error) {
+	if err := authorize(ctx, "admit patients", providerClinician); err != nil {
+		return "", err
+	}
+
+	episode, err := newEpisode(ctx, userID, hospitalName, admissionDate, reason)
+	if err != nil {
+		return "", err
+	}
+	if err := putEpisode(ctx, episode); err != nil {
+		return "", err
+	}
+
+	return episode.EpisodeID, nil
+}
+
+// RecordDiagnosis allows a clinician of the admitting provider to add a diagnosis to an episode that has not been claimed yet
+func (s *SmartContract) RecordDiagnosis(ctx contractapi.TransactionContextInterface, episodeID, diagnosis string) error {
+	return s.addEpisodeEntry(ctx, episodeID, diagnosis, "record diagnoses", func(episode *Episode, entry EpisodeEntry) {
+		episode.Diagnoses = append(episode.Diagnoses, entry)
+	})
+}
+
+// RecordTreatment allows a clinician of the admitting provider to add a treatment to an episode that has not been claimed yet
+func (s *SmartContract) RecordTreatment(ctx contractapi.TransactionContextInterface, episodeID, treatment string) error {
+	return s.addEpisodeEntry(ctx, episodeID, treatment, "record treatments", func(episode *Episode, entry EpisodeEntry) {
+		episode.Treatments = append(episode.Treatments, entry)
+	})
+}
+
+// DischargePatient allows a clinician of the admitting provider to close an episode, after which it can be claimed
+func (s *SmartContract) DischargePatient(ctx contractapi.TransactionContextInterface, episodeID, dischargeDate, summary string) error {
+	if err := authorize(ctx, "discharge patients", providerClinician); err != nil {
+		return err
+	}
+
+	episode, err := getEpisode(ctx, episodeID)
+	if err != nil {
+		return err
+	}
+	if err := requireAdmittingProvider(ctx, episode, "discharge the patient of episode "+episodeID); err != nil {
+		return err
+	}
+	if err := dischargeEpisode(ctx, episode, dischargeDate, summary); err != nil {
+		return err
+	}
+
+	return putEpisode(ctx, episode)
+}
+
+// QueryEpisode retrieves an episode of care by ID for the patient or their delegate, or a clinician of the
+// provider that admitted the patient
+func (s *SmartContract) QueryEpisode(ctx contractapi.TransactionContextInterface, episodeID string) (*Episode, error) {
+	if err := requireEpisodeReader(ctx); err != nil {
+		return nil, err
+	}
+
+	episode, err := getEpisode(ctx, episodeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeActingFor(ctx, episode.UserID, "claim"); err != nil {
+		return nil, err
+	}
+	callerID, err := callerUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if callerID == "" {
+		if err := requireAdmittingProvider(ctx, episode, "read episode "+episodeID); err != nil {
+			return nil, err
+		}
+	}
+
+	return episode, nil
+}
+
+// QueryPatientEpisodes lists a patient's episodes of care with the status of the claim filed for each. A
+// clinician sees only the episodes their own provider admitted.
+func (s *SmartContract) QueryPatientEpisodes(ctx contractapi.TransactionContextInterface, userID string) ([]*Episode, error) {
+	if err := requireEpisodeReader(ctx); err != nil {
+		return nil, err
+	}
+	if err := authorizeActingFor(ctx, userID, "claim"); err != nil {
+		return nil, err
+	}
+
+	episodes, err := listEpisodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	callerID, err := callerUserID(ctx)
+	if err != nil || callerID != "" {
+		return episodes, err
+	}
+
+	orgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+	admitted := []*Episode{}
+	for _, episode := range episodes {
+		providerMSP, err := episodeProvider(ctx, episode)
+		if err != nil {
+			return nil, err
+		}
+		if providerMSP == orgID {
+			admitted = append(admitted, episode)
+		}
+	}
+
+	return admitted, nil
+}
+
+// addEpisodeEntry appends a diagnosis or treatment to an open or discharged episode that is not yet claimed
+func (s *SmartContract) addEpisodeEntry(ctx contractapi.TransactionContextInterface, episodeID, detail, action string, add func(*Episode, EpisodeEntry)) error {
+	if err := authorize(ctx, action, providerClinician); err != nil {
+		return err
+	}
+	if detail == "" {
+		return fmt.Errorf("an entry needs a detail")
+	}
+
+	episode, err := getEpisode(ctx, episodeID)
+	if err != nil {
+		return err
+	}
+	if err := requireAdmittingProvider(ctx, episode, action+" for episode "+episodeID); err != nil {
+		return err
+	}
+	if episode.ClaimID != "" {
+		return fmt.Errorf("episode %s has already been claimed under %s", episodeID, episode.ClaimID)
+	}
+
+	entry, err := newEpisodeEntry(ctx, "", detail)
+	if err != nil {
+		return err
+	}
+	add(episode, entry)
+	// A corrected episode goes back on the pending queue
+	episode.ClaimError = ""
+
+	return putEpisode(ctx, episode)
+}
+
+// requireEpisodeReader allows clinicians and members to read episodes. Insurers' peers hold the collection so
+// that claims can be filed, but their users see episodes only through the claims filed for them.
+func requireEpisodeReader(ctx contractapi.TransactionContextInterface) error {
+	return authorize(ctx, "read episodes of care", providerClinician, anyMember)
+}
+
+// newEpisode opens an episode of care with its admission entry
+func newEpisode(ctx contractapi.TransactionContextInterface, userID, hospitalName, admissionDate, reason string) (*Episode, error) {
+	if _, err := time.Parse(dateLayout, admissionDate); err != nil {
+		return nil, fmt.Errorf("failed to parse admission date %s: %v", admissionDate, err)
+	}
+
+	admission, err := newEpisodeEntry(ctx, admissionDate, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	providerMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(ctx.GetStub().GetTxID() + ":" + userID))
+	return &Episode{
+		EpisodeID:    "EP-" + hex.EncodeToString(sum[:8]),
+		UserID:       userID,
+		HospitalName: hospitalName,
+		ProviderMSP:  providerMSP,
+		Status:       EpisodeAdmitted,
+		Admission:    admission,
+		Diagnoses:    []EpisodeEntry{},
+		Treatments:   []EpisodeEntry{},
+	}, nil
+}
+
+// dischargeEpisode closes an admitted episode on a date no earlier than its admission
+func dischargeEpisode(ctx contractapi.TransactionContextInterface, episode *Episode, dischargeDate, summary string) error {
+	if episode.Status != EpisodeAdmitted {
+		return fmt.Errorf("episode %s is %s and cannot be discharged", episode.EpisodeID, episode.Status)
+	}
+
+	discharge, err := time.Parse(dateLayout, dischargeDate)
+	if err != nil {
+		return fmt.Errorf("failed to parse discharge date %s: %v", dischargeDate, err)
+	}
+	admission, err := time.Parse(dateLayout, episode.Admission.Date)
+	if err != nil {
+		return fmt.Errorf("failed to parse admission date of episode %s: %v", episode.EpisodeID, err)
+	}
+	if discharge.Before(admission) {
+		return fmt.Errorf("discharge date %s is before the admission date %s", dischargeDate, episode.Admission.Date)
+	}
+
+	entry, err := newEpisodeEntry(ctx, dischargeDate, summary)
+	if err != nil {
+		return err
+	}
+	episode.Discharge = &entry
+	episode.Status = EpisodeDischarged
+
+	return nil
+}
+
+// principalDiagnosis is the most recent diagnosis of an episode, which its claim is filed for
+func principalDiagnosis(episode *Episode) string {
+	if len(episode.Diagnoses) == 0 {
+		return ""
+	}
+
+	return episode.Diagnoses[len(episode.Diagnoses)-1].Detail
+}
+
+// pendingEpisode finds the one discharged episode of a patient that has not been claimed yet
+func pendingEpisode(ctx contractapi.TransactionContextInterface, userID string) (*Episode, error) {
+	episodes, err := listEpisodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*Episode
+	for _, episode := range episodes {
+		if episode.Status == EpisodeDischarged && episode.ClaimID == "" {
+			pending = append(pending, episode)
+		}
+	}
+
+	switch len(pending) {
+	case 0:
+		return nil, fmt.Errorf("user %s has no discharged episode awaiting a claim", userID)
+	case 1:
+		return pending[0], nil
+	default:
+		return nil, fmt.Errorf("user %s has %d discharged episodes awaiting a claim, name one through ProcessEpisodeClaim", userID, len(pending))
+	}
+}
+
+func newEpisodeEntry(ctx contractapi.TransactionContextInterface, date, detail string) (EpisodeEntry, error) {
+	recordedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return EpisodeEntry{}, fmt.Errorf("failed to get client identity: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return EpisodeEntry{}, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	return EpisodeEntry{Date: date, Detail: detail, RecordedBy: recordedBy, RecordedAt: timestamp.Seconds}, nil
+}
+
+func listEpisodes(ctx contractapi.TransactionContextInterface, userID string) ([]*Episode, error) {
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(episodeCollection, episodeByUserIndex, []string{userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve episodes: %v", err)
+	}
+	defer iterator.Close()
+
+	episodes := []*Episode{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next episode index entry: %v", err)
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+
+		episode, err := getEpisode(ctx, keyParts[1])
+		if err != nil {
+			return nil, err
+		}
+		episodes = append(episodes, episode)
+	}
+
+	return episodes, nil
+}
+
+// episodeProvider returns the provider that admitted the patient, or the registry's legacy provider for episodes
+// opened before episodes recorded it
+func episodeProvider(ctx contractapi.TransactionContextInterface, episode *Episode) (string, error) {
+	if episode.ProviderMSP != "" {
+		return episode.ProviderMSP, nil
+	}
+
+	defaults, err := registryDefaults(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return defaults.LegacyProviderMSP, nil
+}
+
+// requireAdmittingProvider fails unless the caller belongs to the provider that admitted the patient
+func requireAdmittingProvider(ctx contractapi.TransactionContextInterface, episode *Episode, action string) error {
+	providerMSP, err := episodeProvider(ctx, episode)
+	if err != nil {
+		return err
+	}
+	orgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if orgID != providerMSP {
+		return accessDenied(action, providerMSP)
+	}
+
+	return nil
+}
+
+func getEpisode(ctx contractapi.TransactionContextInterface, episodeID string) (*Episode, error) {
+	episodeKey, err := ctx.GetStub().CreateCompositeKey("episode", []string{episodeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	episodeJSON, err := ctx.GetStub().GetPrivateData(episodeCollection, episodeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch episode: %v", err)
+	}
+	if episodeJSON == nil {
+		return nil, fmt.Errorf("episode %s does not exist", episodeID)
+	}
+
+	var episode Episode
+	err = json.Unmarshal(episodeJSON, &episode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal episode: %v", err)
+	}
+
+	return &episode, nil
+}
+
+// putEpisode stores the episode and its entry in the patient index
+func putEpisode(ctx contractapi.TransactionContextInterface, episode *Episode) error {
+	episodeKey, err := ctx.GetStub().CreateCompositeKey("episode", []string{episode.EpisodeID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	episode.DocType = episodeDocType
+	episodeJSON, err := json.Marshal(episode)
+	if err != nil {
+		return fmt.Errorf("failed to serialize episode: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(episodeCollection, episodeKey, episodeJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store episode: %v", err)
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(episodeByUserIndex, []string{episode.UserID, episode.EpisodeID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	// Index entries only need a key; a single byte keeps the value non-nil
+	err = ctx.GetStub().PutPrivateData(episodeCollection, indexKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to store episode index: %v", err)
+	}
+
+	// Discharged, unclaimed episodes are queued for ProcessPendingClaims until a batch attempt fails
+	pendingKey, err := ctx.GetStub().CreateCompositeKey(episodePendingIndex, []string{episode.UserID, episode.EpisodeID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	if episode.Status == EpisodeDischarged && episode.ClaimID == "" && episode.ClaimError == "" {
+		err = ctx.GetStub().PutPrivateData(episodeCollection, pendingKey, []byte{0x00})
+	} else {
+		err = ctx.GetStub().DelPrivateData(episodeCollection, pendingKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update pending episode index: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEpisodeUpdatesNeedAdmittingProvider(t *testing.T) {
+	updates := map[string]func(*TransactionContext) error{
+		"diagnosis": func(ctx *TransactionContext) error {
+			return new(SmartContract).RecordDiagnosis(ctx, "EP1", "malaria")
+		},
+		"treatment": func(ctx *TransactionContext) error {
+			return new(SmartContract).RecordTreatment(ctx, "EP1", "antimalarials")
+		},
+		"discharge": func(ctx *TransactionContext) error {
+			return new(SmartContract).DischargePatient(ctx, "EP1", "2024-01-05", "recovered")
+		},
+	}
+
+	tests := []struct {
+		name        string
+		caller      *fakeIdentity
+		providerMSP string // Recorded on the episode; empty for episodes admitted before it was kept
+		allowed     bool
+	}{
+		{"admitting provider's clinician", withJob("Org4MSP", JobClinician), "Org4MSP", true},
+		{"another provider's clinician", withJob("Org5MSP", JobClinician), "Org4MSP", false},
+		{"legacy provider's clinician on an older episode", withJob("Org4MSP", JobClinician), "", true},
+		{"another provider's clinician on an older episode", withJob("Org5MSP", JobClinician), "", false},
+	}
+
+	for update, apply := range updates {
+		for _, tt := range tests {
+			t.Run(update+" by "+tt.name, func(t *testing.T) {
+				registry := claimTestRegistry("")
+				registry["OrgRegistryContract:QueryOrg Org5MSP"] = testOrg("Org5MSP", RoleProvider)
+				registry["OrgRegistryContract:QueryRegistryDefaults"] = &RegistryDefaults{SchemaVersion: "1.0", LegacyProviderMSP: "Org4MSP"}
+				ctx, _ := newTestContext(t, tt.caller, registry)
+
+				err := putEpisode(ctx, &Episode{
+					EpisodeID:   "EP1",
+					UserID:      "user1",
+					ProviderMSP: tt.providerMSP,
+					Status:      EpisodeAdmitted,
+					Admission:   EpisodeEntry{Date: "2024-01-01"},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = apply(ctx)
+				if tt.allowed && err != nil {
+					t.Fatalf("expected the update to be allowed, got %v", err)
+				}
+				if !tt.allowed && !isAccessDenied(err) {
+					t.Fatalf("expected an access denial, got %v", err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// eventSchemaVersion is the version of the event envelope and payloads documented in the README.
+// It changes only when a field is removed or changes meaning; adding optional fields keeps it.
+const eventSchemaVersion = "1.0"
+
+// Event types emitted by the claims chaincode
+const (
+	EventClaimSubmitted          = "ClaimSubmitted"
+	EventClaimStatusChanged      = "ClaimStatusChanged"
+	EventClaimPaymentRecorded    = "ClaimPaymentRecorded"
+	EventPreAuthorizationDecided = "PreAuthorizationDecided"
+)
+
+// EventRecord is one typed change inside an event envelope
+type EventRecord struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// EventEnvelope is the payload of every chaincode event
+type EventEnvelope struct {
+	SchemaVersion string        `json:"schemaVersion"`
+	TxID          string        `json:"txId"`
+	Timestamp     int64         `json:"timestamp"`
+	Events        []EventRecord `json:"events"`
+}
+
+// ClaimSubmittedEvent announces a new claim
+type ClaimSubmittedEvent struct {
+	ClaimID  string `json:"claimId"`
+	UserID   string `json:"userId"`
+	PolicyID string `json:"policyId"`
+}
+
+// ClaimStatusChangedEvent announces a claim moving between states. The free-text reason is left out
+// because it can carry clinical details; amounts and reason codes are read from the claim itself.
+type ClaimStatusChangedEvent struct {
+	ClaimID  string `json:"claimId"`
+	UserID   string `json:"userId"`
+	PolicyID string `json:"policyId"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+}
+
+// ClaimPaymentRecordedEvent announces a payment against a claim
+type ClaimPaymentRecordedEvent struct {
+	ClaimID    string  `json:"claimId"`
+	Payee      string  `json:"payee"`
+	Amount     float64 `json:"amount"`
+	PaymentRef string  `json:"paymentRef"`
+}
+
+// PreAuthorizationDecidedEvent announces the insurer's decision on a pre-authorisation
+type PreAuthorizationDecidedEvent struct {
+	PreAuthID      string  `json:"preAuthId"`
+	UserID         string  `json:"userId"`
+	Status         string  `json:"status"`
+	ApprovedAmount float64 `json:"approvedAmount"`
+}
+
+// TransactionContext buffers the events raised during a transaction. Fabric keeps only the last
+// SetEvent call of a transaction, so the events are emitted together once the transaction succeeds.
+type TransactionContext struct {
+	contractapi.TransactionContext
+	events []EventRecord
+}
+
+// eventQueue is implemented by contexts that collect events until they can be emitted
+type eventQueue interface {
+	queueEvent(event EventRecord)
+}
+
+func (c *TransactionContext) queueEvent(event EventRecord) {
+	c.events = append(c.events, event)
+}
+
+// emitEvent queues an event to be emitted when the transaction completes
+func emitEvent(ctx contractapi.TransactionContextInterface, eventType string, data interface{}) {
+	if queue, ok := ctx.(eventQueue); ok {
+		queue.queueEvent(EventRecord{Type: eventType, Data: data})
+	}
+}
+
+// flushEvents is the contract's AfterTransaction hook. The chaincode event is named after the first
+// event of the transaction and carries all of them in one envelope.
+func flushEvents(ctx contractapi.TransactionContextInterface) error {
+	eventCtx, ok := ctx.(*TransactionContext)
+	if !ok || len(eventCtx.events) == 0 {
+		return nil
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	payload, err := json.Marshal(EventEnvelope{
+		SchemaVersion: eventSchemaVersion,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     timestamp.Seconds,
+		Events:        eventCtx.events,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal chaincode event: %v", err)
+	}
+
+	return ctx.GetStub().SetEvent(eventCtx.events[0].Type, payload)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFlushEventsEmitsOneEnvelope(t *testing.T) {
+	ctx, stub := newTestContext(t, withJob("Org1MSP", JobAdjuster), claimTestRegistry(""))
+
+	claim := &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimSubmitted}
+	emitEvent(ctx, EventClaimSubmitted, ClaimSubmittedEvent{ClaimID: claim.ClaimID, UserID: claim.UserID, PolicyID: claim.PolicyID})
+	if err := transitionClaim(ctx, claim, ClaimUnderReview, "diagnosis code unclear"); err != nil {
+		t.Fatal(err)
+	}
+	if err := flushEvents(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-stub.ChaincodeEventsChannel:
+		if event.EventName != EventClaimSubmitted {
+			t.Fatalf("expected the event named after the first change, got %s", event.EventName)
+		}
+		if strings.Contains(string(event.Payload), "diagnosis code unclear") {
+			t.Fatal("expected the event to leave out the free-text reason")
+		}
+
+		var envelope EventEnvelope
+		if err := json.Unmarshal(event.Payload, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if envelope.SchemaVersion != eventSchemaVersion || envelope.TxID != "tx1" || len(envelope.Events) != 2 {
+			t.Fatalf("expected both changes in one envelope of tx1, got %+v", envelope)
+		}
+		if envelope.Events[1].Type != EventClaimStatusChanged {
+			t.Fatalf("expected the status change second, got %s", envelope.Events[1].Type)
+		}
+	default:
+		t.Fatal("expected a chaincode event")
+	}
+}
+
+func TestFlushEventsWithoutChanges(t *testing.T) {
+	ctx, stub := newTestContext(t, withJob("Org1MSP", JobAdjuster), claimTestRegistry(""))
+
+	if err := flushEvents(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-stub.ChaincodeEventsChannel:
+		t.Fatalf("expected no event, got %s", event.EventName)
+	default:
+	}
+}
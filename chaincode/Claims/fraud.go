@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// dateLayout is the format of admission and discharge dates
+const dateLayout = "2006-01-02"
+
+// earlyClaimWindow is how soon after registering a claim is considered suspicious
+const earlyClaimWindow = 30 * 24 * time.Hour
+
+// chronicConditions are diagnoses that would normally have shown up in the health record at underwriting
+var chronicConditions = map[string]bool{
+	"Diabetes":      true,
+	"Hypertension":  true,
+	"Asthma":        true,
+	"HeartDisease":  true,
+	"KidneyDisease": true,
+}
+
+// smokingRelatedConditions are diagnoses that contradict a non-smoker declaration
+var smokingRelatedConditions = map[string]bool{
+	"COPD":       true,
+	"LungCancer": true,
+	"Emphysema":  true,
+}
+
+// FraudFlag records a screening rule that a claim triggered
+type FraudFlag struct {
+	Rule   string `json:"rule"`
+	Detail string `json:"detail"`
+}
+
+// ClaimScreening is what fraud rules get to look at
+type ClaimScreening struct {
+	Claim        *Claim
+	Policy       *Policy
+	Episode      *Episode
+	Registration *Registration
+}
+
+// FraudRule is one check of the screening stage. It returns a non-empty detail when the claim is flagged.
+type FraudRule interface {
+	Name() string
+	Evaluate(ctx contractapi.TransactionContextInterface, screening *ClaimScreening) (string, error)
+}
+
+// fraudRules are run in order on every claim before it is settled; add a rule here to extend screening
+var fraudRules = []FraudRule{
+	dischargeBeforeAdmissionRule{},
+	earlyClaimRule{},
+	overlappingAdmissionRule{},
+	underwritingContradictionRule{},
+}
+
+// screenClaim runs every fraud rule and returns the ones the claim triggered
+func screenClaim(ctx contractapi.TransactionContextInterface, screening *ClaimScreening) ([]FraudFlag, error) {
+	var flags []FraudFlag
+	for _, rule := range fraudRules {
+		detail, err := rule.Evaluate(ctx, screening)
+		if err != nil {
+			return nil, fmt.Errorf("fraud rule %s failed: %v", rule.Name(), err)
+		}
+		if detail != "" {
+			flags = append(flags, FraudFlag{Rule: rule.Name(), Detail: detail})
+		}
+	}
+
+	return flags, nil
+}
+
+// dischargeBeforeAdmissionRule flags stays whose dates are missing, malformed or run backwards
+type dischargeBeforeAdmissionRule struct{}
+
+func (dischargeBeforeAdmissionRule) Name() string { return "DISCHARGE_BEFORE_ADMISSION" }
+
+func (dischargeBeforeAdmissionRule) Evaluate(ctx contractapi.TransactionContextInterface, screening *ClaimScreening) (string, error) {
+	admission, discharge, err := stayDates(screening.Claim)
+	if err != nil {
+		return err.Error(), nil
+	}
+	if discharge.Before(admission) {
+		return fmt.Sprintf("discharge date %s is before admission date %s", screening.Claim.DischargeDate, screening.Claim.AdmissionDate), nil
+	}
+
+	return "", nil
+}
+
+// earlyClaimRule flags claims filed shortly after the member registered
+type earlyClaimRule struct{}
+
+func (earlyClaimRule) Name() string { return "EARLY_CLAIM" }
+
+func (earlyClaimRule) Evaluate(ctx contractapi.TransactionContextInterface, screening *ClaimScreening) (string, error) {
+	// Registrations made before registration times were recorded cannot be checked
+	if screening.Registration.RegisteredAt == 0 {
+		return "", nil
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	registeredAt := time.Unix(screening.Registration.RegisteredAt, 0)
+	if time.Unix(timestamp.Seconds, 0).Sub(registeredAt) < earlyClaimWindow {
+		return fmt.Sprintf("claim filed within %v of registering for policy %s", earlyClaimWindow, screening.Registration.PolicyID), nil
+	}
+
+	return "", nil
+}
+
+// overlappingAdmissionRule flags claims whose stay overlaps another claim of the same member
+type overlappingAdmissionRule struct{}
+
+func (overlappingAdmissionRule) Name() string { return "OVERLAPPING_ADMISSION" }
+
+func (overlappingAdmissionRule) Evaluate(ctx contractapi.TransactionContextInterface, screening *ClaimScreening) (string, error) {
+	admission, discharge, err := stayDates(screening.Claim)
+	if err != nil {
+		// Malformed dates are reported by dischargeBeforeAdmissionRule
+		return "", nil
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(claimsCollection, claimByUserIndex, []string{screening.Claim.UserID})
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve claims: %v", err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve next claim index entry: %v", err)
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return "", fmt.Errorf("failed to split composite key: %v", err)
+		}
+		if keyParts[1] == screening.Claim.ClaimID {
+			continue
+		}
+
+		other, err := getClaim(ctx, keyParts[1])
+		if err != nil {
+			return "", err
+		}
+		if other.Status == ClaimRejected || (other.Status == ClaimClosed && other.SettlementAmount == 0) {
+			continue
+		}
+		// The member's other payer claiming the same episode is coordination of benefits, not a duplicate
+		if other.EpisodeID != "" && other.EpisodeID == screening.Claim.EpisodeID {
+			continue
+		}
+		otherAdmission, otherDischarge, err := stayDates(other)
+		if err != nil {
+			continue
+		}
+		if !admission.After(otherDischarge) && !otherAdmission.After(discharge) {
+			return fmt.Sprintf("stay overlaps claim %s (%s to %s)", other.ClaimID, other.AdmissionDate, other.DischargeDate), nil
+		}
+	}
+
+	return "", nil
+}
+
+// underwritingContradictionRule flags diagnoses that contradict the health record the member was underwritten on
+type underwritingContradictionRule struct{}
+
+func (underwritingContradictionRule) Name() string { return "CONTRADICTS_UNDERWRITING" }
+
+func (underwritingContradictionRule) Evaluate(ctx contractapi.TransactionContextInterface, screening *ClaimScreening) (string, error) {
+	diagnosis := screening.Claim.Diagnosis
+	if !screening.Registration.HasDisease && chronicConditions[diagnosis] {
+		return fmt.Sprintf("chronic condition %s diagnosed but no disease was recorded at underwriting", diagnosis), nil
+	}
+	if screening.Registration.IsNonSmoker && smokingRelatedConditions[diagnosis] {
+		return fmt.Sprintf("smoking-related condition %s diagnosed for a member underwritten as a non-smoker", diagnosis), nil
+	}
+
+	return "", nil
+}
+
+// stayDates parses the admission and discharge dates of a claim
+func stayDates(claim *Claim) (time.Time, time.Time, error) {
+	admission, err := time.Parse(dateLayout, claim.AdmissionDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("admission date %q is not a valid date", claim.AdmissionDate)
+	}
+	discharge, err := time.Parse(dateLayout, claim.DischargeDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("discharge date %q is not a valid date", claim.DischargeDate)
+	}
+
+	return admission, discharge, nil
+}
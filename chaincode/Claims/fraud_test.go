@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScreenClaim(t *testing.T) {
+	longAgo := time.Now().Add(-365 * 24 * time.Hour).Unix()
+
+	tests := []struct {
+		name         string
+		claim        Claim
+		registration Registration
+		want         string // The rule the claim triggers, or "" for none
+	}{
+		{"ordinary stay", Claim{AdmissionDate: "2024-05-01", DischargeDate: "2024-05-04", Diagnosis: "Malaria"}, Registration{RegisteredAt: longAgo}, ""},
+		{"discharge before admission", Claim{AdmissionDate: "2024-05-04", DischargeDate: "2024-05-01", Diagnosis: "Malaria"}, Registration{RegisteredAt: longAgo}, "DISCHARGE_BEFORE_ADMISSION"},
+		{"malformed dates", Claim{AdmissionDate: "May 1st", DischargeDate: "2024-05-04", Diagnosis: "Malaria"}, Registration{RegisteredAt: longAgo}, "DISCHARGE_BEFORE_ADMISSION"},
+		{"claim right after registering", Claim{AdmissionDate: "2024-05-01", DischargeDate: "2024-05-04", Diagnosis: "Malaria"}, Registration{RegisteredAt: time.Now().Add(-24 * time.Hour).Unix()}, "EARLY_CLAIM"},
+		{"registration time unknown", Claim{AdmissionDate: "2024-05-01", DischargeDate: "2024-05-04", Diagnosis: "Malaria"}, Registration{}, ""},
+		{"stay overlapping another claim", Claim{AdmissionDate: "2024-03-05", DischargeDate: "2024-03-08", Diagnosis: "Malaria"}, Registration{RegisteredAt: longAgo}, "OVERLAPPING_ADMISSION"},
+		{"undeclared chronic condition", Claim{AdmissionDate: "2024-05-01", DischargeDate: "2024-05-04", Diagnosis: "Diabetes"}, Registration{RegisteredAt: longAgo}, "CONTRADICTS_UNDERWRITING"},
+		{"declared chronic condition", Claim{AdmissionDate: "2024-05-01", DischargeDate: "2024-05-04", Diagnosis: "Diabetes"}, Registration{RegisteredAt: longAgo, HasDisease: true}, ""},
+		{"smoking-related condition of a non-smoker", Claim{AdmissionDate: "2024-05-01", DischargeDate: "2024-05-04", Diagnosis: "COPD"}, Registration{RegisteredAt: longAgo, IsNonSmoker: true}, "CONTRADICTS_UNDERWRITING"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := newTestContext(t, withJob("Org1MSP", JobAdjuster), claimTestRegistry(""))
+			earlier := &Claim{ClaimID: "CLM0", UserID: "user1", PolicyID: "POL1", AdmissionDate: "2024-03-01", DischargeDate: "2024-03-06", Status: ClaimApproved}
+			if err := putClaim(ctx, earlier); err != nil {
+				t.Fatal(err)
+			}
+
+			claim := tt.claim
+			claim.ClaimID = "CLM1"
+			claim.UserID = "user1"
+			registration := tt.registration
+			registration.UserID = "user1"
+			registration.PolicyID = "POL1"
+
+			flags, err := screenClaim(ctx, &ClaimScreening{Claim: &claim, Policy: &Policy{PolicyID: "POL1"}, Registration: &registration})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if len(flags) != 0 {
+					t.Fatalf("expected no flags, got %+v", flags)
+				}
+				return
+			}
+			if len(flags) != 1 || flags[0].Rule != tt.want {
+				t.Fatalf("expected only %s, got %+v", tt.want, flags)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const testChannel = "mychannel"
+
+// fakeIdentity is a client identity with the given MSP, certificate attributes and, for admins, an admin
+// certificate. Identities without an ID share one per MSP.
+type fakeIdentity struct {
+	id    string
+	mspID string
+	attrs map[string]string
+	admin bool
+}
+
+func (f *fakeIdentity) GetMSPID() (string, error) { return f.mspID, nil }
+
+func (f *fakeIdentity) GetID() (string, error) {
+	if f.id != "" {
+		return f.id, nil
+	}
+	return "x509::" + f.mspID, nil
+}
+
+func (f *fakeIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := f.attrs[name]
+	return value, found, nil
+}
+
+func (f *fakeIdentity) AssertAttributeValue(name, value string) error {
+	if f.attrs[name] != value {
+		return errors.New("attribute mismatch")
+	}
+	return nil
+}
+
+func (f *fakeIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	ou := "client"
+	if f.admin {
+		ou = "admin"
+	}
+	return &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{ou}}}, nil
+}
+
+func withJob(mspID, job string) *fakeIdentity {
+	return &fakeIdentity{mspID: mspID, attrs: map[string]string{job: "true"}}
+}
+
+// fakeRegistry stands in for the registration chaincode. It answers a function called with a first
+// argument from the response under "function argument", and otherwise from the one under "function".
+type fakeRegistry struct {
+	responses map[string]interface{}
+}
+
+func (r *fakeRegistry) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return shim.Success(nil)
+}
+
+func (r *fakeRegistry) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	function, args := stub.GetFunctionAndParameters()
+
+	key := function
+	if len(args) > 0 {
+		key += " " + args[0]
+	}
+	response, ok := r.responses[key]
+	if !ok {
+		response, ok = r.responses[function]
+	}
+	if !ok {
+		return shim.Error("unexpected call to " + key)
+	}
+
+	payload, err := json.Marshal(response)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(payload)
+}
+
+// testStub adds the private data deletes and queries the mock stub does not implement. Rich queries are
+// recorded and answered with every record of the collection, as the mock has no CouchDB to run them.
+type testStub struct {
+	*shimtest.MockStub
+	queries []string
+}
+
+func (s *testStub) DelPrivateData(collection, key string) error {
+	delete(s.PvtState[collection], key)
+	return nil
+}
+
+func (s *testStub) GetPrivateDataByPartialCompositeKey(collection, objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := s.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.privateEntries(collection, func(key string) bool { return strings.HasPrefix(key, prefix) }), nil
+}
+
+func (s *testStub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	// Range queries skip composite keys, as they do on a peer
+	return s.privateEntries(collection, func(key string) bool {
+		return !strings.HasPrefix(key, "\x00") && key >= startKey && (endKey == "" || key < endKey)
+	}), nil
+}
+
+func (s *testStub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	s.queries = append(s.queries, query)
+
+	// Composite keys hold indexes, not records
+	return s.privateEntries(collection, func(key string) bool { return !strings.HasPrefix(key, "\x00") }), nil
+}
+
+// privateEntries iterates in key order over the entries of a collection whose keys are kept
+func (s *testStub) privateEntries(collection string, keep func(key string) bool) *testIterator {
+	keys := []string{}
+	for key := range s.PvtState[collection] {
+		if keep(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	results := &testIterator{}
+	for _, key := range keys {
+		results.entries = append(results.entries, &queryresult.KV{Namespace: s.Name, Key: key, Value: s.PvtState[collection][key]})
+	}
+	return results
+}
+
+// testIterator iterates over a fixed list of results
+type testIterator struct {
+	entries []*queryresult.KV
+}
+
+func (i *testIterator) HasNext() bool { return len(i.entries) > 0 }
+func (i *testIterator) Close() error  { return nil }
+
+func (i *testIterator) Next() (*queryresult.KV, error) {
+	if len(i.entries) == 0 {
+		return nil, errors.New("no more results")
+	}
+	next := i.entries[0]
+	i.entries = i.entries[1:]
+	return next, nil
+}
+
+// newTestContext starts a transaction on a fresh ledger whose registration chaincode gives the answers
+func newTestContext(t *testing.T, caller *fakeIdentity, responses map[string]interface{}) (*TransactionContext, *testStub) {
+	t.Helper()
+
+	stub := &testStub{MockStub: shimtest.NewMockStub("claims", nil)}
+	stub.ChannelID = testChannel
+	stub.MockPeerChaincode(registryChaincode, shimtest.NewMockStub(registryChaincode, &fakeRegistry{responses: responses}), testChannel)
+	stub.MockTransactionStart("tx1")
+
+	ctx := new(TransactionContext)
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(caller)
+	return ctx, stub
+}
+
+// testOrg is the registry's record of an organisation with the given roles
+func testOrg(mspID string, roles ...string) *OrgRecord {
+	return &OrgRecord{DocType: "org", SchemaVersion: "1.0", MSPID: mspID, Roles: roles}
+}
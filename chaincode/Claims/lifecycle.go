@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Claim states
+const (
+	ClaimSubmitted            = "Submitted"
+	ClaimUnderReview          = "UnderReview"
+	ClaimInformationRequested = "InformationRequested"
+	ClaimApproved             = "Approved"
+	ClaimPartiallyApproved    = "PartiallyApproved"
+	ClaimRejected             = "Rejected"
+	ClaimUnderAppeal          = "UnderAppeal"
+	ClaimPaid                 = "Paid"
+	ClaimClosed               = "Closed"
+)
+
+// appealDecider stands in for whoever rules on appeals, which is resolved when the transition happens
+var appealDecider = permission{OrgRole: "appealDecider"}
+
+// claimTransitions lists, for every state, the states a claim may move to and who may move it
+var claimTransitions = map[string]map[string][]permission{
+	ClaimSubmitted: {
+		ClaimUnderReview: {insurerAdjuster},
+		ClaimRejected:    {insurerAdjuster},
+	},
+	ClaimUnderReview: {
+		ClaimInformationRequested: {insurerAdjuster},
+		ClaimApproved:             {insurerAdjuster},
+		ClaimPartiallyApproved:    {insurerAdjuster},
+		ClaimRejected:             {insurerAdjuster},
+	},
+	ClaimInformationRequested: {
+		ClaimUnderReview: {providerClinician},
+	},
+	ClaimApproved: {
+		ClaimPaid: {insurerAdjuster},
+	},
+	ClaimPartiallyApproved: {
+		ClaimPaid: {insurerAdjuster},
+	},
+	ClaimRejected: {
+		ClaimUnderAppeal: {providerClinician, anyMember},
+		ClaimClosed:      {insurerAdjuster},
+	},
+	ClaimUnderAppeal: {
+		ClaimApproved: {appealDecider},
+		ClaimRejected: {appealDecider},
+	},
+	ClaimPaid: {
+		ClaimClosed: {insurerAdjuster},
+	},
+}
+
+// ClaimTransition records one step of a claim through the adjudication process
+type ClaimTransition struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Timestamp int64  `json:"timestamp"`
+	ActorMSP  string `json:"actorMsp"`
+	ActorID   string `json:"actorId"`
+	Reason    string `json:"reason"`
+}
+
+// StartClaimReview moves a submitted claim into review
+func (s *SmartContract) StartClaimReview(ctx contractapi.TransactionContextInterface, claimID string, reason string) error {
+	return s.changeClaimStatus(ctx, claimID, ClaimUnderReview, reason, nil)
+}
+
+// RequestClaimInformation asks the hospital for more information before the claim can be decided
+func (s *SmartContract) RequestClaimInformation(ctx contractapi.TransactionContextInterface, claimID string, reason string) error {
+	return s.changeClaimStatus(ctx, claimID, ClaimInformationRequested, reason, nil)
+}
+
+// ProvideClaimInformation lets the hospital answer an information request and return the claim to review
+func (s *SmartContract) ProvideClaimInformation(ctx contractapi.TransactionContextInterface, claimID string, reason string) error {
+	return s.changeClaimStatus(ctx, claimID, ClaimUnderReview, reason, nil)
+}
+
+// ApproveClaim approves a claim under review for the given settlement amount
+func (s *SmartContract) ApproveClaim(ctx contractapi.TransactionContextInterface, claimID string, settlementAmount float64, reason string) error {
+	return s.changeClaimStatus(ctx, claimID, ClaimApproved, reason, func(claim *Claim) error {
+		return approveSettlement(ctx, claim, settlementAmount)
+	})
+}
+
+// PartiallyApproveClaim approves part of a claim under review
+func (s *SmartContract) PartiallyApproveClaim(ctx contractapi.TransactionContextInterface, claimID string, settlementAmount float64, reason string) error {
+	return s.changeClaimStatus(ctx, claimID, ClaimPartiallyApproved, reason, func(claim *Claim) error {
+		return approveSettlement(ctx, claim, settlementAmount)
+	})
+}
+
+// RejectClaim rejects a submitted claim or one under review with a reason code
+func (s *SmartContract) RejectClaim(ctx contractapi.TransactionContextInterface, claimID string, reasonCode string, reason string) error {
+	if reasonCode == "" {
+		return fmt.Errorf("a reason code is required to reject claim %s", claimID)
+	}
+
+	return s.changeClaimStatus(ctx, claimID, ClaimRejected, reason, func(claim *Claim) error {
+		claim.SettlementAmount = 0
+		claim.RejectionReasonCode = reasonCode
+		return nil
+	})
+}
+
+// CloseClaim closes a paid or rejected claim
+func (s *SmartContract) CloseClaim(ctx contractapi.TransactionContextInterface, claimID string, reason string) error {
+	return s.changeClaimStatus(ctx, claimID, ClaimClosed, reason, nil)
+}
+
+// approveSettlement settles a claim an adjuster approved, once the approvals its policy asks for are in.
+// Itemised claims are only settled line by line, so that their payments reconcile against an explanation of
+// benefits.
+func approveSettlement(ctx contractapi.TransactionContextInterface, claim *Claim, settlementAmount float64) error {
+	if len(claim.BillLines) > 0 || claim.BilledAmount > 0 {
+		return fmt.Errorf("claim %s has an itemised bill; decide its lines with AdjudicateBillLines", claim.ClaimID)
+	}
+	if err := requireSettlementApprovals(ctx, claim, settlementAmount); err != nil {
+		return err
+	}
+	claim.AwaitingApprovalFor = 0
+
+	return settleAgainstCover(ctx, claim, settlementAmount)
+}
+
+// settleAgainstCover draws a manually approved amount from the member's cover, refusing amounts above what is left
+func settleAgainstCover(ctx contractapi.TransactionContextInterface, claim *Claim, settlementAmount float64) error {
+	if settlementAmount <= 0 {
+		return fmt.Errorf("settlement amount must be positive, got %.2f", settlementAmount)
+	}
+	// Claims sent to manual review were never priced, so what the adjuster approves is what they claim
+	if claim.ClaimedAmount == 0 {
+		claim.ClaimedAmount = settlementAmount
+	}
+
+	payable, err := coordinatedAmount(ctx, claim, settlementAmount)
+	if err != nil {
+		return err
+	}
+	if payable < settlementAmount {
+		return fmt.Errorf("settlement amount %.2f exceeds the %.2f left after the primary payer's settlement", settlementAmount, payable)
+	}
+
+	granted, err := consumeCoverage(ctx, claim, settlementAmount)
+	if err != nil {
+		return err
+	}
+	if granted < settlementAmount {
+		return fmt.Errorf("settlement amount %.2f exceeds the remaining cover of %.2f", settlementAmount, granted)
+	}
+	claim.SettlementAmount = settlementAmount
+
+	return nil
+}
+
+// changeClaimStatus loads a claim, moves it to the target state and applies an optional update
+func (s *SmartContract) changeClaimStatus(ctx contractapi.TransactionContextInterface, claimID, to, reason string, update func(*Claim) error) error {
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return err
+	}
+
+	if err := transitionClaim(ctx, claim, to, reason); err != nil {
+		return err
+	}
+
+	if update != nil {
+		if err := update(claim); err != nil {
+			return err
+		}
+	}
+
+	if err := putClaim(ctx, claim); err != nil {
+		return err
+	}
+
+	return syncEpisodeClaimStatus(ctx, claim)
+}
+
+// transitionClaim checks that the move is allowed for the caller and records it in the claim history
+func transitionClaim(ctx contractapi.TransactionContextInterface, claim *Claim, to, reason string) error {
+	allowed, err := claimTransition(claim, to, reason)
+	if err != nil {
+		return err
+	}
+
+	actorMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	action := fmt.Sprintf("move claim %s from %s to %s", claim.ClaimID, claim.Status, to)
+
+	// Appeals are ruled on by an adjuster of the arbitrator appointed for the claim's insurer, or by the
+	// insurer's own adjuster when there is none
+	if allowed[0] == appealDecider {
+		arbitratorMSP, err := appealArbitratorMSP(ctx, claim)
+		if err != nil {
+			return err
+		}
+		if arbitratorMSP != "" && actorMSP != arbitratorMSP {
+			return accessDenied(action, "an adjuster of the arbitrator "+arbitratorMSP)
+		}
+		allowed = []permission{insurerAdjuster}
+		if arbitratorMSP != "" {
+			allowed = []permission{{Job: JobAdjuster}}
+		}
+	}
+
+	// Insurer moves are made by the policy's own insurer, never by another one
+	switch {
+	case len(allowed) == 1 && allowed[0].OrgRole == RoleInsurer:
+		if err := requirePolicyInsurer(ctx, claim.PolicyID, action, allowed[0]); err != nil {
+			return err
+		}
+	case allowed != nil:
+		if err := authorize(ctx, action, allowed...); err != nil {
+			return err
+		}
+	}
+
+	return recordTransition(ctx, claim, to, reason)
+}
+
+// applyClaimRule moves a claim as an automatic adjudication rule decides. The rules run for whoever filed the
+// claim, so only the move itself is checked, not the caller's permission to make it.
+func applyClaimRule(ctx contractapi.TransactionContextInterface, claim *Claim, to, reason string) error {
+	if _, err := claimTransition(claim, to, reason); err != nil {
+		return err
+	}
+
+	return recordTransition(ctx, claim, to, reason)
+}
+
+// claimTransition returns who may make a move, failing for moves the claim state machine does not allow
+func claimTransition(claim *Claim, to, reason string) ([]permission, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to move claim %s to %s", claim.ClaimID, to)
+	}
+
+	allowed, ok := claimTransitions[claim.Status][to]
+	if !ok {
+		return nil, fmt.Errorf("claim %s cannot move from %s to %s", claim.ClaimID, claim.Status, to)
+	}
+
+	return allowed, nil
+}
+
+// recordTransition moves a claim and records the move in its history and as an event
+func recordTransition(ctx contractapi.TransactionContextInterface, claim *Claim, to, reason string) error {
+	actorMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	actorID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	emitEvent(ctx, EventClaimStatusChanged, ClaimStatusChangedEvent{
+		ClaimID:  claim.ClaimID,
+		UserID:   claim.UserID,
+		PolicyID: claim.PolicyID,
+		From:     claim.Status,
+		To:       to,
+	})
+
+	claim.History = append(claim.History, ClaimTransition{
+		From:      claim.Status,
+		To:        to,
+		Timestamp: timestamp.Seconds,
+		ActorMSP:  actorMSP,
+		ActorID:   actorID,
+		Reason:    reason,
+	})
+	claim.Status = to
+
+	return nil
+}
+
+// syncEpisodeClaimStatus mirrors the claim state onto its episode of care in the episode collection
+func syncEpisodeClaimStatus(ctx contractapi.TransactionContextInterface, claim *Claim) error {
+	// Claims filed before episodes of care have nothing to update
+	if claim.EpisodeID == "" {
+		return nil
+	}
+
+	episode, err := getEpisode(ctx, claim.EpisodeID)
+	if err != nil {
+		return err
+	}
+	if claim.ClaimID == episode.SecondaryClaimID {
+		episode.SecondaryClaimStatus = claim.Status
+	} else {
+		episode.ClaimStatus = claim.Status
+	}
+
+	return putEpisode(ctx, episode)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+)
+
+// claimTestRegistry has POL1 defined by Org1MSP, another insurer Org2MSP, a provider Org4MSP and, when set,
+// an arbitrator for Org1MSP's appeals
+func claimTestRegistry(arbitratorMSP string) map[string]interface{} {
+	return map[string]interface{}{
+		"OrgRegistryContract:QueryOrg Org1MSP":      testOrg("Org1MSP", RoleInsurer),
+		"OrgRegistryContract:QueryOrg Org2MSP":      testOrg("Org2MSP", RoleInsurer),
+		"OrgRegistryContract:QueryOrg Org3MSP":      testOrg("Org3MSP"),
+		"OrgRegistryContract:QueryOrg Org4MSP":      testOrg("Org4MSP", RoleProvider),
+		"QueryPolicy POL1":                          &Policy{PolicyID: "POL1", InsurerMSP: "Org1MSP"},
+		"QueryArbitrator Org1MSP":                   &ArbitratorConfig{InsurerMSP: "Org1MSP", MSPID: arbitratorMSP},
+		"OrgRegistryContract:QueryRegistryDefaults": &RegistryDefaults{SchemaVersion: "1.0"},
+	}
+}
+
+func TestTransitionClaim(t *testing.T) {
+	member := &fakeIdentity{mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: "user1"}}
+
+	tests := []struct {
+		name       string
+		caller     *fakeIdentity
+		from, to   string
+		arbitrator string
+		want       string // "moved", "denied" or "invalid"
+	}{
+		{"insurer starts review", withJob("Org1MSP", JobAdjuster), ClaimSubmitted, ClaimUnderReview, "", "moved"},
+		{"insurer approves", withJob("Org1MSP", JobAdjuster), ClaimUnderReview, ClaimApproved, "", "moved"},
+		{"insurer pays", withJob("Org1MSP", JobAdjuster), ClaimApproved, ClaimPaid, "", "moved"},
+		{"insurer closes", withJob("Org1MSP", JobAdjuster), ClaimPaid, ClaimClosed, "", "moved"},
+		{"no skipping to paid", withJob("Org1MSP", JobAdjuster), ClaimSubmitted, ClaimPaid, "", "invalid"},
+		{"no reopening", withJob("Org1MSP", JobAdjuster), ClaimClosed, ClaimUnderReview, "", "invalid"},
+		{"another insurer", withJob("Org2MSP", JobAdjuster), ClaimSubmitted, ClaimUnderReview, "", "denied"},
+		{"insurer without the adjuster job", withJob("Org1MSP", JobUnderwriter), ClaimUnderReview, ClaimApproved, "", "denied"},
+		{"provider cannot approve", withJob("Org4MSP", JobClinician), ClaimUnderReview, ClaimApproved, "", "denied"},
+		{"provider answers an information request", withJob("Org4MSP", JobClinician), ClaimInformationRequested, ClaimUnderReview, "", "moved"},
+		{"insurer cannot answer for the provider", withJob("Org1MSP", JobAdjuster), ClaimInformationRequested, ClaimUnderReview, "", "denied"},
+		{"member appeals", member, ClaimRejected, ClaimUnderAppeal, "", "moved"},
+		{"member cannot approve", member, ClaimUnderReview, ClaimApproved, "", "denied"},
+		{"insurer rules without an arbitrator", withJob("Org1MSP", JobAdjuster), ClaimUnderAppeal, ClaimApproved, "", "moved"},
+		{"another insurer cannot rule", withJob("Org2MSP", JobAdjuster), ClaimUnderAppeal, ClaimApproved, "", "denied"},
+		{"arbitrator rules", withJob("Org3MSP", JobAdjuster), ClaimUnderAppeal, ClaimRejected, "Org3MSP", "moved"},
+		{"insurer cannot rule over its arbitrator", withJob("Org1MSP", JobAdjuster), ClaimUnderAppeal, ClaimApproved, "Org3MSP", "denied"},
+		{"arbitrator needs the adjuster job", withJob("Org3MSP", JobAuditor), ClaimUnderAppeal, ClaimApproved, "Org3MSP", "denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := newTestContext(t, tt.caller, claimTestRegistry(tt.arbitrator))
+			claim := &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: tt.from}
+
+			err := transitionClaim(ctx, claim, tt.to, "test")
+			switch tt.want {
+			case "moved":
+				if err != nil {
+					t.Fatalf("expected the claim to move, got %v", err)
+				}
+				if claim.Status != tt.to || len(claim.History) != 1 {
+					t.Fatalf("expected status %s with one history entry, got %s with %d", tt.to, claim.Status, len(claim.History))
+				}
+				if entry := claim.History[0]; entry.From != tt.from || entry.To != tt.to || entry.ActorMSP != tt.caller.mspID {
+					t.Fatalf("unexpected history entry %+v", entry)
+				}
+			case "denied":
+				if !isAccessDenied(err) {
+					t.Fatalf("expected an access denial, got %v", err)
+				}
+			default:
+				if err == nil || isAccessDenied(err) {
+					t.Fatalf("expected the transition to be invalid, got %v", err)
+				}
+			}
+			if tt.want != "moved" && (claim.Status != tt.from || len(claim.History) != 0) {
+				t.Fatalf("expected the refused claim to stay %s, got %s", tt.from, claim.Status)
+			}
+		})
+	}
+}
+
+func TestTransitionClaimNeedsReason(t *testing.T) {
+	ctx, _ := newTestContext(t, withJob("Org1MSP", JobAdjuster), claimTestRegistry(""))
+	claim := &Claim{ClaimID: "CLM1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimSubmitted}
+
+	if err := transitionClaim(ctx, claim, ClaimUnderReview, ""); err == nil {
+		t.Fatal("expected a transition without a reason to be refused")
+	}
+}
+
+func TestClaimTransitionsReachKnownStates(t *testing.T) {
+	for from, targets := range claimTransitions {
+		for to, allowed := range targets {
+			if _, ok := claimTransitions[to]; !ok && to != ClaimClosed {
+				t.Errorf("%s -> %s leads to a state with no way out", from, to)
+			}
+			if len(allowed) == 0 {
+				t.Errorf("%s -> %s allows nobody", from, to)
+			}
+		}
+	}
+}
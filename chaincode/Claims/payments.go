@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Who a claim payment goes to
+const (
+	PayeeHospital = "hospital" // Cashless payout to the provider
+	PayeePatient  = "patient"  // Reimbursement to the member
+)
+
+// paymentTolerance absorbs rounding when comparing paid and approved amounts
+const paymentTolerance = 0.005
+
+// ClaimPayment records money paid out against an approved claim
+type ClaimPayment struct {
+	DocType    string  `json:"docType"`
+	ClaimID    string  `json:"claimId"`
+	Payee      string  `json:"payee"`
+	PayeeID    string  `json:"payeeId"`
+	Amount     float64 `json:"amount"`
+	PaymentRef string  `json:"paymentRef"`
+	RecordedBy string  `json:"recordedBy"`
+	RecordedAt int64   `json:"recordedAt"`
+}
+
+// ReconciliationItem is a claim whose payments do not line up with its approved amount
+type ReconciliationItem struct {
+	ClaimID        string  `json:"claimId"`
+	UserID         string  `json:"userId"`
+	Status         string  `json:"status"`
+	ApprovedAmount float64 `json:"approvedAmount"`
+	PaidAmount     float64 `json:"paidAmount"`
+	Difference     float64 `json:"difference"` // Approved minus paid
+}
+
+// ReconciliationReport lists approved claims still waiting for money and paid claims that do not match
+type ReconciliationReport struct {
+	ApprovedUnpaid []ReconciliationItem `json:"approvedUnpaid"`
+	Mismatched     []ReconciliationItem `json:"mismatched"`
+}
+
+// RecordClaimPayment allows an adjuster of the claim's insurer to record a payout to the hospital or a
+// reimbursement to the patient. The claim moves to Paid once the payments cover the approved amount.
+func (s *SmartContract) RecordClaimPayment(ctx contractapi.TransactionContextInterface, claimID string, payee string, amount float64, paymentRef string) error {
+	if amount <= 0 {
+		return fmt.Errorf("payment amount must be positive, got %.2f", amount)
+	}
+	if paymentRef == "" {
+		return fmt.Errorf("a payment reference is required")
+	}
+
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return err
+	}
+	if err := requirePolicyInsurer(ctx, claim.PolicyID, "record claim payments", insurerAdjuster); err != nil {
+		return err
+	}
+	if claim.Status != ClaimApproved && claim.Status != ClaimPartiallyApproved {
+		return fmt.Errorf("claim %s is %s and cannot be paid", claimID, claim.Status)
+	}
+
+	var payeeID string
+	switch payee {
+	case PayeeHospital:
+		payeeID = claim.ProviderID
+	case PayeePatient:
+		payeeID = claim.UserID
+	default:
+		return fmt.Errorf("payee must be %s or %s, got %s", PayeeHospital, PayeePatient, payee)
+	}
+
+	// A payment reference can only ever be used once
+	refKey, err := ctx.GetStub().CreateCompositeKey("payment~ref", []string{paymentRef})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	usedBy, err := ctx.GetStub().GetPrivateData(claimsCollection, refKey)
+	if err != nil {
+		return fmt.Errorf("failed to read payment reference: %v", err)
+	}
+	if usedBy != nil {
+		return fmt.Errorf("payment reference %s has already been recorded for claim %s", paymentRef, string(usedBy))
+	}
+
+	recordedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	paymentJSON, err := json.Marshal(ClaimPayment{
+		DocType:    claimPaymentDocType,
+		ClaimID:    claimID,
+		Payee:      payee,
+		PayeeID:    payeeID,
+		Amount:     amount,
+		PaymentRef: paymentRef,
+		RecordedBy: recordedBy,
+		RecordedAt: timestamp.Seconds,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize claim payment: %v", err)
+	}
+
+	paymentKey, err := ctx.GetStub().CreateCompositeKey("payment", []string{claimID, paymentRef})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutPrivateData(claimsCollection, paymentKey, paymentJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store claim payment: %v", err)
+	}
+	err = ctx.GetStub().PutPrivateData(claimsCollection, refKey, []byte(claimID))
+	if err != nil {
+		return fmt.Errorf("failed to store payment reference: %v", err)
+	}
+
+	emitEvent(ctx, EventClaimPaymentRecorded, ClaimPaymentRecordedEvent{
+		ClaimID:    claimID,
+		Payee:      payee,
+		Amount:     amount,
+		PaymentRef: paymentRef,
+	})
+
+	claim.PaidAmount += amount
+	if claim.PaidAmount >= claim.SettlementAmount-paymentTolerance {
+		err = transitionClaim(ctx, claim, ClaimPaid, fmt.Sprintf("paid %.2f to %s under %s", amount, payee, paymentRef))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := putClaim(ctx, claim); err != nil {
+		return err
+	}
+
+	return syncEpisodeClaimStatus(ctx, claim)
+}
+
+// QueryClaimPayments retrieves every payment recorded against a claim
+func (s *SmartContract) QueryClaimPayments(ctx contractapi.TransactionContextInterface, claimID string) ([]*ClaimPayment, error) {
+	claim, err := getClaim(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireClaimReader(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(claimsCollection, "payment", []string{claimID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve claim payments: %v", err)
+	}
+	defer iterator.Close()
+
+	payments := []*ClaimPayment{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next claim payment: %v", err)
+		}
+
+		var payment ClaimPayment
+		err = json.Unmarshal(queryResponse.Value, &payment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal claim payment: %v", err)
+		}
+		payments = append(payments, &payment)
+	}
+
+	return payments, nil
+}
+
+// ReconcileClaimPayments lists, for an adjuster or auditor, their insurer's approved claims that have not been
+// paid in full, and paid or closed claims whose recorded payments differ from the approved amount
+func (s *SmartContract) ReconcileClaimPayments(ctx contractapi.TransactionContextInterface) (*ReconciliationReport, error) {
+	reader, err := newClaimReader(ctx, "reconcile claim payments", insurerAdjuster, insurerAuditor)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataByRange(claimsCollection, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve claims from ledger: %v", err)
+	}
+	defer iterator.Close()
+
+	report := &ReconciliationReport{ApprovedUnpaid: []ReconciliationItem{}, Mismatched: []ReconciliationItem{}}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next claim entry during iteration: %v", err)
+		}
+
+		var claim Claim
+		err = json.Unmarshal(queryResponse.Value, &claim)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal claim JSON from value: %v", err)
+		}
+		readable, err := reader.canRead(ctx, &claim)
+		if err != nil {
+			return nil, err
+		}
+		if !readable {
+			continue
+		}
+
+		item := ReconciliationItem{
+			ClaimID:        claim.ClaimID,
+			UserID:         claim.UserID,
+			Status:         claim.Status,
+			ApprovedAmount: claim.SettlementAmount,
+			PaidAmount:     claim.PaidAmount,
+			Difference:     claim.SettlementAmount - claim.PaidAmount,
+		}
+		switch claim.Status {
+		case ClaimApproved, ClaimPartiallyApproved:
+			report.ApprovedUnpaid = append(report.ApprovedUnpaid, item)
+		case ClaimPaid, ClaimClosed:
+			if math.Abs(item.Difference) > paymentTolerance {
+				report.Mismatched = append(report.Mismatched, item)
+			}
+		}
+	}
+
+	return report, nil
+}
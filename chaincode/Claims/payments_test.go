@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRecordClaimPayment(t *testing.T) {
+	ctx, _ := newTestContext(t, withJob("Org1MSP", JobAdjuster), claimTestRegistry(""))
+	contract := new(SmartContract)
+	err := putClaim(ctx, &Claim{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", ProviderID: "PRV1", Status: ClaimApproved, SettlementAmount: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := contract.RecordClaimPayment(ctx, "CLM1", PayeeHospital, 300, "REF1"); err != nil {
+		t.Fatal(err)
+	}
+	claim, err := getClaim(ctx, "CLM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.Status != ClaimApproved || claim.PaidAmount != 300 {
+		t.Fatalf("expected the claim approved with 300 paid, got %s with %.2f", claim.Status, claim.PaidAmount)
+	}
+
+	refused := []struct {
+		name   string
+		caller *fakeIdentity
+		payee  string
+		ref    string
+	}{
+		{"reused payment reference", withJob("Org1MSP", JobAdjuster), PayeePatient, "REF1"},
+		{"unknown payee", withJob("Org1MSP", JobAdjuster), "broker", "REF2"},
+		{"another insurer's adjuster", withJob("Org2MSP", JobAdjuster), PayeePatient, "REF2"},
+	}
+	for _, tt := range refused {
+		ctx.SetClientIdentity(tt.caller)
+		if err := contract.RecordClaimPayment(ctx, "CLM1", tt.payee, 200, tt.ref); err == nil {
+			t.Fatalf("%s: expected the payment to be refused", tt.name)
+		}
+	}
+
+	ctx.SetClientIdentity(withJob("Org1MSP", JobAdjuster))
+	if err := contract.RecordClaimPayment(ctx, "CLM1", PayeePatient, 200, "REF2"); err != nil {
+		t.Fatal(err)
+	}
+	payments, err := contract.QueryClaimPayments(ctx, "CLM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim, err = getClaim(ctx, "CLM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.Status != ClaimPaid || len(payments) != 2 || payments[0].PayeeID != "PRV1" || payments[1].PayeeID != "user1" {
+		t.Fatalf("expected the claim paid to the hospital and the patient, got %s with %+v", claim.Status, payments)
+	}
+}
+
+func TestReconcileClaimPayments(t *testing.T) {
+	ctx, _ := newTestContext(t, withJob("Org1MSP", JobAuditor), claimTestRegistry(""))
+	for _, claim := range []*Claim{
+		{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimPaid, SettlementAmount: 500, PaidAmount: 500},
+		{ClaimID: "CLM2", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimApproved, SettlementAmount: 300},
+		{ClaimID: "CLM3", UserID: "user2", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimPaid, SettlementAmount: 500, PaidAmount: 450},
+		{ClaimID: "CLM4", UserID: "user3", PolicyID: "POL2", InsurerMSP: "Org2MSP", Status: ClaimApproved, SettlementAmount: 900},
+	} {
+		if err := putClaim(ctx, claim); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := new(SmartContract).ReconcileClaimPayments(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.ApprovedUnpaid) != 1 || report.ApprovedUnpaid[0].ClaimID != "CLM2" {
+		t.Fatalf("expected only CLM2 approved and unpaid, got %+v", report.ApprovedUnpaid)
+	}
+	if len(report.Mismatched) != 1 || report.Mismatched[0].ClaimID != "CLM3" || report.Mismatched[0].Difference != 50 {
+		t.Fatalf("expected only CLM3 short by 50, got %+v", report.Mismatched)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Pre-authorisation states
+const (
+	PreAuthRequested = "Requested"
+	PreAuthApproved  = "Approved"
+	PreAuthRejected  = "Rejected"
+	PreAuthUsed      = "Used" // Settled by a claim at discharge
+)
+
+// preAuthByUserIndex indexes pre-authorisations by member inside claimsCollection
+const preAuthByUserIndex = "preauth~user"
+
+// PreAuthorization is a hospital's request, at admission, for the insurer to guarantee a cashless stay
+type PreAuthorization struct {
+	DocType        string  `json:"docType"`
+	PreAuthID      string  `json:"preAuthId"`
+	UserID         string  `json:"userId"`
+	PolicyID       string  `json:"policyId"`
+	Diagnosis      string  `json:"diagnosis"`
+	EstimatedCost  float64 `json:"estimatedCost"`
+	RequestedBy    string  `json:"requestedBy"`
+	ProviderMSP    string  `json:"providerMsp,omitempty"` // Provider of the requesting clinician; empty on requests made before it was kept
+	RequestedAt    int64   `json:"requestedAt"`
+	Status         string  `json:"status"`
+	ApprovedAmount float64 `json:"approvedAmount,omitempty"`
+	ValidFrom      string  `json:"validFrom,omitempty"`
+	ValidUntil     string  `json:"validUntil,omitempty"`
+	Reason         string  `json:"reason,omitempty"`
+	DecidedBy      string  `json:"decidedBy,omitempty"`
+	DecidedAt      int64   `json:"decidedAt,omitempty"`
+	ClaimID        string  `json:"claimId,omitempty"`
+}
+
+// RequestPreAuthorization allows a clinician to ask the insurer to pre-authorise a stay at admission
+func (s *SmartContract) RequestPreAuthorization(ctx contractapi.TransactionContextInterface, userID string, policyID string, diagnosis string, estimatedCost float64) (string, error) {
+	if err := authorize(ctx, "request pre-authorisation", providerClinician); err != nil {
+		return "", err
+	}
+	if estimatedCost <= 0 {
+		return "", fmt.Errorf("estimated cost must be positive, got %.2f", estimatedCost)
+	}
+
+	// Make sure the member is actually registered for the policy
+	var registration Registration
+	err := invokeRegistration(ctx, "QueryRegistration", []string{userID, policyID}, &registration)
+	if err != nil {
+		return "", err
+	}
+
+	requestedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+	providerMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(ctx.GetStub().GetTxID() + ":" + userID))
+	preAuth := PreAuthorization{
+		PreAuthID:     "PA-" + hex.EncodeToString(sum[:8]),
+		UserID:        userID,
+		PolicyID:      policyID,
+		Diagnosis:     diagnosis,
+		EstimatedCost: estimatedCost,
+		RequestedBy:   requestedBy,
+		ProviderMSP:   providerMSP,
+		RequestedAt:   timestamp.Seconds,
+		Status:        PreAuthRequested,
+	}
+
+	if err := putPreAuthorization(ctx, &preAuth); err != nil {
+		return "", err
+	}
+
+	return preAuth.PreAuthID, nil
+}
+
+// DecidePreAuthorization allows an adjuster of the policy's insurer to approve a pre-authorisation for an amount
+// and validity window, or reject it
+func (s *SmartContract) DecidePreAuthorization(ctx contractapi.TransactionContextInterface, preAuthID string, approve bool, approvedAmount float64, validFrom string, validUntil string, reason string) error {
+	preAuth, err := getPreAuthorization(ctx, preAuthID)
+	if err != nil {
+		return err
+	}
+	if err := requirePolicyInsurer(ctx, preAuth.PolicyID, "decide pre-authorisation", insurerAdjuster); err != nil {
+		return err
+	}
+	if preAuth.Status != PreAuthRequested {
+		return fmt.Errorf("pre-authorisation %s has already been decided", preAuthID)
+	}
+
+	if approve {
+		if approvedAmount <= 0 {
+			return fmt.Errorf("approved amount must be positive, got %.2f", approvedAmount)
+		}
+		from, err := time.Parse(dateLayout, validFrom)
+		if err != nil {
+			return fmt.Errorf("failed to parse valid-from date %s: %v", validFrom, err)
+		}
+		until, err := time.Parse(dateLayout, validUntil)
+		if err != nil {
+			return fmt.Errorf("failed to parse valid-until date %s: %v", validUntil, err)
+		}
+		if until.Before(from) {
+			return fmt.Errorf("validity window ends on %s before it starts on %s", validUntil, validFrom)
+		}
+
+		preAuth.Status = PreAuthApproved
+		preAuth.ApprovedAmount = approvedAmount
+		preAuth.ValidFrom = validFrom
+		preAuth.ValidUntil = validUntil
+	} else {
+		preAuth.Status = PreAuthRejected
+	}
+
+	preAuth.Reason = reason
+	preAuth.DecidedBy, err = ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	preAuth.DecidedAt = timestamp.Seconds
+
+	emitEvent(ctx, EventPreAuthorizationDecided, PreAuthorizationDecidedEvent{
+		PreAuthID:      preAuth.PreAuthID,
+		UserID:         preAuth.UserID,
+		Status:         preAuth.Status,
+		ApprovedAmount: preAuth.ApprovedAmount,
+	})
+
+	return putPreAuthorization(ctx, preAuth)
+}
+
+// QueryPreAuthorization retrieves a pre-authorisation by ID for the member or their delegate, an adjuster or
+// auditor of the policy's insurer, or a clinician of the provider that requested it
+func (s *SmartContract) QueryPreAuthorization(ctx contractapi.TransactionContextInterface, preAuthID string) (*PreAuthorization, error) {
+	preAuth, err := getPreAuthorization(ctx, preAuthID)
+	if err != nil {
+		return nil, err
+	}
+
+	callerID, err := callerUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if callerID != "" {
+		if err := authorizeActingFor(ctx, preAuth.UserID, "claim"); err != nil {
+			return nil, err
+		}
+		return preAuth, nil
+	}
+
+	insurerMSP, err := policyInsurer(ctx, preAuth.PolicyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireRecordOrg(ctx, "read pre-authorisation "+preAuthID, insurerMSP, preAuth.ProviderMSP); err != nil {
+		return nil, err
+	}
+
+	return preAuth, nil
+}
+
+// findPreAuthorization looks for an unused approved pre-authorisation covering the claim's diagnosis and admission date
+func findPreAuthorization(ctx contractapi.TransactionContextInterface, claim *Claim) (*PreAuthorization, error) {
+	iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(claimsCollection, preAuthByUserIndex, []string{claim.UserID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve pre-authorisations: %v", err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next pre-authorisation index entry: %v", err)
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+
+		preAuth, err := getPreAuthorization(ctx, keyParts[1])
+		if err != nil {
+			return nil, err
+		}
+		if preAuth.Status != PreAuthApproved || preAuth.PolicyID != claim.PolicyID || preAuth.Diagnosis != claim.Diagnosis {
+			continue
+		}
+		// Dates share one layout, so they compare correctly as strings
+		if claim.AdmissionDate < preAuth.ValidFrom || claim.AdmissionDate > preAuth.ValidUntil {
+			continue
+		}
+
+		return preAuth, nil
+	}
+
+	return nil, nil
+}
+
+func getPreAuthorization(ctx contractapi.TransactionContextInterface, preAuthID string) (*PreAuthorization, error) {
+	preAuthKey, err := ctx.GetStub().CreateCompositeKey("preauth", []string{preAuthID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	preAuthJSON, err := ctx.GetStub().GetPrivateData(claimsCollection, preAuthKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pre-authorisation: %v", err)
+	}
+	if preAuthJSON == nil {
+		return nil, fmt.Errorf("pre-authorisation %s does not exist", preAuthID)
+	}
+
+	var preAuth PreAuthorization
+	err = json.Unmarshal(preAuthJSON, &preAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pre-authorisation: %v", err)
+	}
+
+	return &preAuth, nil
+}
+
+func putPreAuthorization(ctx contractapi.TransactionContextInterface, preAuth *PreAuthorization) error {
+	preAuthKey, err := ctx.GetStub().CreateCompositeKey("preauth", []string{preAuth.PreAuthID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	preAuth.DocType = preAuthorizationDocType
+	preAuthJSON, err := json.Marshal(preAuth)
+	if err != nil {
+		return fmt.Errorf("failed to serialize pre-authorisation: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(claimsCollection, preAuthKey, preAuthJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store pre-authorisation: %v", err)
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(preAuthByUserIndex, []string{preAuth.UserID, preAuth.PreAuthID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutPrivateData(claimsCollection, indexKey, []byte{0x00})
+}
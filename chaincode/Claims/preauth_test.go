@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestQueryPreAuthorizationAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  *fakeIdentity
+		allowed bool
+	}{
+		{"policy insurer's auditor", withJob("Org1MSP", JobAuditor), true},
+		{"another insurer's adjuster", withJob("Org2MSP", JobAdjuster), false},
+		{"requesting provider's clinician", withJob("Org4MSP", JobClinician), true},
+		{"another provider's clinician", withJob("Org5MSP", JobClinician), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry("")
+			registry["OrgRegistryContract:QueryOrg Org5MSP"] = testOrg("Org5MSP", RoleProvider)
+			ctx, _ := newTestContext(t, tt.caller, registry)
+
+			err := putPreAuthorization(ctx, &PreAuthorization{PreAuthID: "PA1", UserID: "user1", PolicyID: "POL1", ProviderMSP: "Org4MSP", Status: PreAuthRequested})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = new(SmartContract).QueryPreAuthorization(ctx, "PA1")
+			if tt.allowed && err != nil {
+				t.Fatalf("expected to read the pre-authorisation, got %v", err)
+			}
+			if !tt.allowed && !isAccessDenied(err) {
+				t.Fatalf("expected an access denial, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecidePreAuthorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		decider    *fakeIdentity
+		approve    bool
+		validUntil string
+		want       string // Status after the decision, or "" when it is refused
+	}{
+		{"insurer's adjuster approves", withJob("Org1MSP", JobAdjuster), true, "2024-05-10", PreAuthApproved},
+		{"insurer's adjuster rejects", withJob("Org1MSP", JobAdjuster), false, "", PreAuthRejected},
+		{"window ending before it starts", withJob("Org1MSP", JobAdjuster), true, "2024-04-30", ""},
+		{"another insurer's adjuster", withJob("Org2MSP", JobAdjuster), true, "2024-05-10", ""},
+		{"requesting provider's clinician", withJob("Org4MSP", JobClinician), true, "2024-05-10", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry("")
+			registry["QueryRegistration user1"] = &Registration{UserID: "user1", PolicyID: "POL1"}
+			ctx, stub := newTestContext(t, withJob("Org4MSP", JobClinician), registry)
+
+			preAuthID, err := new(SmartContract).RequestPreAuthorization(ctx, "user1", "POL1", "Malaria", 800)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stub.MockTransactionEnd("")
+			stub.MockTransactionStart("tx2")
+
+			ctx.SetClientIdentity(tt.decider)
+			err = new(SmartContract).DecidePreAuthorization(ctx, preAuthID, tt.approve, 600, "2024-05-01", tt.validUntil, "stay of up to ten days")
+			if tt.want == "" {
+				if err == nil {
+					t.Fatal("expected the decision to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			preAuth, err := getPreAuthorization(ctx, preAuthID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if preAuth.Status != tt.want || preAuth.ProviderMSP != "Org4MSP" {
+				t.Fatalf("expected %s requested by Org4MSP, got %s by %q", tt.want, preAuth.Status, preAuth.ProviderMSP)
+			}
+			if err := new(SmartContract).DecidePreAuthorization(ctx, preAuthID, true, 600, "2024-05-01", "2024-05-10", "again"); err == nil {
+				t.Fatal("expected a second decision to be refused")
+			}
+		})
+	}
+}
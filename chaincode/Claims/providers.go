@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"insurance/internal/authz"
+)
+
+// Provider network statuses
+const (
+	InNetwork    = "InNetwork"
+	OutOfNetwork = "OutOfNetwork"
+)
+
+// networkTierRates is the share of the allowed amount reimbursed for each network status
+var networkTierRates = map[string]float64{
+	InNetwork:    1.0,
+	OutOfNetwork: 0.7,
+}
+
+// Reason codes and adjustments driven by the provider registry
+const (
+	ReasonUnknownProvider     = "UNKNOWN_PROVIDER"
+	ReasonProviderMismatch    = "PROVIDER_MISMATCH"
+	AdjustmentFeeScheduleCap  = "FEE_SCHEDULE_CAP"
+	AdjustmentNetworkTierRate = "NETWORK_TIER_RATE"
+)
+
+// Provider is a hospital in an insurer's provider registry. Each insurer keeps its own registry, with the
+// network status and fee schedule it negotiated.
+type Provider struct {
+	DocType       string             `json:"docType"`
+	ProviderID    string             `json:"providerId"`
+	InsurerMSP    string             `json:"insurerMsp"` // The insurer whose registry this is
+	Name          string             `json:"name"`
+	MSPID         string             `json:"mspId"`
+	NetworkStatus string             `json:"networkStatus"`
+	FeeSchedule   map[string]float64 `json:"feeSchedule"` // Negotiated unit rate by bill line code
+	UpdatedBy     string             `json:"updatedBy"`
+	UpdatedAt     int64              `json:"updatedAt"`
+}
+
+// RegisterProvider allows an underwriter to add a hospital to their insurer's provider registry or update its
+// terms. The hospital's MSP must be a provider in the organisation registry.
+func (s *SmartContract) RegisterProvider(ctx contractapi.TransactionContextInterface, providerID string, name string, mspID string, networkStatus string, feeScheduleJSON string) error {
+	if err := authorize(ctx, "maintain the provider registry", insurerUnderwriter); err != nil {
+		return err
+	}
+	insurerMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	var org OrgRecord
+	err = invokeRegistry(ctx, "OrgRegistryContract:QueryOrg", []string{mspID}, &org)
+	if err != nil {
+		return fmt.Errorf("failed to look up the roles of %s: %v", mspID, err)
+	}
+	if !authz.ContainsRole(org.Roles, RoleProvider) {
+		return fmt.Errorf("%s is not a %s in the organisation registry", mspID, RoleProvider)
+	}
+	if _, ok := networkTierRates[networkStatus]; !ok {
+		return fmt.Errorf("network status must be %s or %s, got %s", InNetwork, OutOfNetwork, networkStatus)
+	}
+
+	feeSchedule := make(map[string]float64)
+	if feeScheduleJSON != "" {
+		err = json.Unmarshal([]byte(feeScheduleJSON), &feeSchedule)
+		if err != nil {
+			return fmt.Errorf("failed to parse fee schedule JSON: %v", err)
+		}
+	}
+	for code, rate := range feeSchedule {
+		if rate < 0 {
+			return fmt.Errorf("negotiated rate for %s must not be negative", code)
+		}
+	}
+
+	existing, err := getProvider(ctx, insurerMSP, providerID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Name != name {
+		oldNameKey, err := ctx.GetStub().CreateCompositeKey("provider~name", []string{insurerMSP, existing.Name})
+		if err != nil {
+			return fmt.Errorf("failed to create composite key: %v", err)
+		}
+		err = ctx.GetStub().DelState(oldNameKey)
+		if err != nil {
+			return fmt.Errorf("failed to remove old provider name: %v", err)
+		}
+	}
+
+	taken, err := providerByName(ctx, insurerMSP, name)
+	if err != nil {
+		return err
+	}
+	if taken != nil && taken.ProviderID != providerID {
+		return fmt.Errorf("provider name %s is already registered to %s", name, taken.ProviderID)
+	}
+
+	updatedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	providerJSON, err := json.Marshal(Provider{
+		DocType:       providerDocType,
+		ProviderID:    providerID,
+		InsurerMSP:    insurerMSP,
+		Name:          name,
+		MSPID:         mspID,
+		NetworkStatus: networkStatus,
+		FeeSchedule:   feeSchedule,
+		UpdatedBy:     updatedBy,
+		UpdatedAt:     timestamp.Seconds,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize provider: %v", err)
+	}
+
+	providerKey, err := ctx.GetStub().CreateCompositeKey("provider", []string{insurerMSP, providerID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(providerKey, providerJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store provider: %v", err)
+	}
+
+	nameKey, err := ctx.GetStub().CreateCompositeKey("provider~name", []string{insurerMSP, name})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(nameKey, []byte(providerID))
+}
+
+// QueryProvider retrieves a provider from an insurer's registry
+func (s *SmartContract) QueryProvider(ctx contractapi.TransactionContextInterface, insurerMSP string, providerID string) (*Provider, error) {
+	provider, err := getProvider(ctx, insurerMSP, providerID)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("provider %s is not registered with %s", providerID, insurerMSP)
+	}
+
+	return provider, nil
+}
+
+// QueryAllProviders retrieves every provider in every insurer's registry
+func (s *SmartContract) QueryAllProviders(ctx contractapi.TransactionContextInterface) ([]*Provider, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("provider", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve providers: %v", err)
+	}
+	defer iterator.Close()
+
+	providers := []*Provider{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next provider: %v", err)
+		}
+
+		var provider Provider
+		err = json.Unmarshal(queryResponse.Value, &provider)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal provider: %v", err)
+		}
+		providers = append(providers, &provider)
+	}
+
+	return providers, nil
+}
+
+// providerByName resolves the hospital name recorded with patient details in an insurer's registry, returning
+// nil for providers unknown to that insurer
+func providerByName(ctx contractapi.TransactionContextInterface, insurerMSP, name string) (*Provider, error) {
+	nameKey, err := ctx.GetStub().CreateCompositeKey("provider~name", []string{insurerMSP, name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	providerID, err := ctx.GetStub().GetState(nameKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider name: %v", err)
+	}
+	if providerID == nil {
+		return nil, nil
+	}
+
+	return getProvider(ctx, insurerMSP, string(providerID))
+}
+
+func getProvider(ctx contractapi.TransactionContextInterface, insurerMSP, providerID string) (*Provider, error) {
+	providerKey, err := ctx.GetStub().CreateCompositeKey("provider", []string{insurerMSP, providerID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	providerJSON, err := ctx.GetStub().GetState(providerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider: %v", err)
+	}
+	if providerJSON == nil {
+		return nil, nil
+	}
+
+	var provider Provider
+	err = json.Unmarshal(providerJSON, &provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal provider: %v", err)
+	}
+
+	return &provider, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Document types stored in the docType field of every record, matched by rich queries and CouchDB indexes
+const (
+	claimDocType               = "claim"
+	patientDetailsDocType      = "patientDetails"
+	episodeDocType             = "episode"
+	appealDocType              = "appeal"
+	hospitalBillDocType        = "hospitalBill"
+	eobDocType                 = "explanationOfBenefits"
+	claimPaymentDocType        = "claimPayment"
+	preAuthorizationDocType    = "preAuthorization"
+	providerDocType            = "provider"
+	configDocType              = "config"
+	claimAnalyticsDocType      = "claimAnalytics"
+	benefitCoordinationDocType = "benefitCoordination"
+)
+
+// QueryClaimsByCriteria retrieves the claims matching a status, a hospital and an admission date range
+// ("2006-01-02", inclusive). Empty criteria are not filtered on. Adjusters and auditors see their insurer's
+// claims and members their own. Rich queries need CouchDB as the state database.
+func (s *SmartContract) QueryClaimsByCriteria(ctx contractapi.TransactionContextInterface, status, hospitalName, fromDate, toDate string) ([]*Claim, error) {
+	reader, err := newClaimReader(ctx, "list claims", insurerAdjuster, insurerAuditor, anyMember)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := map[string]interface{}{"docType": claimDocType}
+	if status != "" {
+		selector["status"] = status
+	}
+	if hospitalName != "" {
+		selector["hospitalName"] = hospitalName
+	}
+
+	// Dates in dateLayout sort as strings, so the range is compared on the stored admission date
+	admissionDate := map[string]interface{}{}
+	if fromDate != "" {
+		if _, err := time.Parse(dateLayout, fromDate); err != nil {
+			return nil, fmt.Errorf("failed to parse from date %s: %v", fromDate, err)
+		}
+		admissionDate["$gte"] = fromDate
+	}
+	if toDate != "" {
+		if _, err := time.Parse(dateLayout, toDate); err != nil {
+			return nil, fmt.Errorf("failed to parse to date %s: %v", toDate, err)
+		}
+		admissionDate["$lte"] = toDate
+	}
+	if fromDate != "" && toDate != "" && fromDate > toDate {
+		return nil, fmt.Errorf("from date %s is after to date %s", fromDate, toDate)
+	}
+	if len(admissionDate) > 0 {
+		selector["admissionDate"] = admissionDate
+	}
+
+	// Marshalling the selector keeps caller input as JSON values, so it cannot change the query
+	queryJSON, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build claim query: %v", err)
+	}
+
+	iterator, err := ctx.GetStub().GetPrivateDataQueryResult(claimsCollection, string(queryJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query claims: %v", err)
+	}
+	defer iterator.Close()
+
+	claims := []*Claim{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next claim: %v", err)
+		}
+
+		var claim Claim
+		err = json.Unmarshal(queryResponse.Value, &claim)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal claim: %v", err)
+		}
+		readable, err := reader.canRead(ctx, &claim)
+		if err != nil {
+			return nil, err
+		}
+		if readable {
+			claims = append(claims, &claim)
+		}
+	}
+
+	return claims, nil
+}
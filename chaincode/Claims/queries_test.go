@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestQueryClaimsByCriteria(t *testing.T) {
+	member := &fakeIdentity{mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: "user1"}}
+
+	tests := []struct {
+		name     string
+		caller   *fakeIdentity
+		from, to string
+		want     int // Claims returned, or -1 when the query is refused
+	}{
+		{"insurer's adjuster", withJob("Org1MSP", JobAdjuster), "2024-01-01", "2024-12-31", 3},
+		{"another insurer's auditor", withJob("Org2MSP", JobAuditor), "", "", 0},
+		{"member", member, "", "", 2},
+		{"provider's clinician", withJob("Org4MSP", JobClinician), "", "", -1},
+		{"malformed date", withJob("Org1MSP", JobAdjuster), "01/01/2024", "", -1},
+		{"range running backwards", withJob("Org1MSP", JobAdjuster), "2024-12-31", "2024-01-01", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry("")
+			registry["VerifyDelegation user1"] = true
+			ctx, stub := newTestContext(t, tt.caller, registry)
+			for _, claim := range []*Claim{
+				{ClaimID: "CLM1", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimSubmitted},
+				{ClaimID: "CLM2", UserID: "user1", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimSubmitted},
+				{ClaimID: "CLM3", UserID: "user2", PolicyID: "POL1", InsurerMSP: "Org1MSP", Status: ClaimSubmitted},
+			} {
+				if err := putClaim(ctx, claim); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			claims, err := new(SmartContract).QueryClaimsByCriteria(ctx, ClaimSubmitted, "City Hospital", tt.from, tt.to)
+			if tt.want < 0 {
+				if err == nil {
+					t.Fatal("expected the query to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(claims) != tt.want {
+				t.Fatalf("expected %d claims, got %d", tt.want, len(claims))
+			}
+
+			var query struct {
+				Selector map[string]interface{} `json:"selector"`
+			}
+			if err := json.Unmarshal([]byte(stub.queries[0]), &query); err != nil {
+				t.Fatal(err)
+			}
+			if query.Selector["docType"] != claimDocType || query.Selector["status"] != ClaimSubmitted || query.Selector["hospitalName"] != "City Hospital" {
+				t.Fatalf("expected the criteria in the selector, got %v", query.Selector)
+			}
+			if _, ranged := query.Selector["admissionDate"]; ranged != (tt.from != "") {
+				t.Fatalf("expected an admission date range only when dates are given, got %v", query.Selector)
+			}
+		})
+	}
+}
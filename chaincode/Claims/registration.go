@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"insurance/internal/authz"
+)
+
+// defaultRegistrationChaincode is called until SetRegistrationTarget stores a target on the ledger
+const defaultRegistrationChaincode = "registration"
+
+// registryChaincode holds the organisation registry, member enrolments, delegations, policy ownership and
+// arbitrators. Access checks always consult it on the claims chaincode's own channel, whatever the target.
+const registryChaincode = "registration"
+
+// supportedInteropMajor is the major schema version of registration responses this chaincode understands
+const supportedInteropMajor = "1"
+
+// RegistrationTarget names the registration chaincode that owns policies, registrations and cover balances
+type RegistrationTarget struct {
+	DocType       string `json:"docType"`
+	ChaincodeName string `json:"chaincodeName"`
+	Channel       string `json:"channel"`
+	SetBy         string `json:"setBy,omitempty"`
+	SetAt         int64  `json:"setAt,omitempty"`
+}
+
+// versionedResponse is implemented by the registration responses that carry a schema version
+type versionedResponse interface {
+	schemaVersion() string
+}
+
+// PolicyLookup mirrors the registration chaincode's answer to LookupPolicyForUser
+type PolicyLookup struct {
+	SchemaVersion string  `json:"schemaVersion"`
+	UserID        string  `json:"userId"`
+	PolicyID      string  `json:"policyId"`
+	Policy        *Policy `json:"policy"`
+}
+
+func (l *PolicyLookup) schemaVersion() string { return l.SchemaVersion }
+
+// PayerOrder mirrors the registration chaincode's answer to QueryPayerOrder
+type PayerOrder struct {
+	SchemaVersion     string `json:"schemaVersion"`
+	UserID            string `json:"userId"`
+	PrimaryPolicyID   string `json:"primaryPolicyId"`
+	SecondaryPolicyID string `json:"secondaryPolicyId,omitempty"`
+}
+
+func (o *PayerOrder) schemaVersion() string { return o.SchemaVersion }
+
+// CoverageVerdict mirrors the registration chaincode's answer to VerifyCoverage
+type CoverageVerdict struct {
+	SchemaVersion   string  `json:"schemaVersion"`
+	UserID          string  `json:"userId"`
+	PolicyID        string  `json:"policyId"`
+	ServiceDate     string  `json:"serviceDate"`
+	Covered         bool    `json:"covered"`
+	ReasonCode      string  `json:"reasonCode,omitempty"`
+	Reason          string  `json:"reason,omitempty"`
+	RemainingAmount float64 `json:"remainingAmount"`
+}
+
+func (v *CoverageVerdict) schemaVersion() string { return v.SchemaVersion }
+
+// Registration mirrors the registration chaincode's record of a member's registration for a policy
+type Registration struct {
+	UserID       string  `json:"userId"`
+	PolicyID     string  `json:"policyId"`
+	PremiumPaid  float64 `json:"premiumPaid"`
+	IsNonSmoker  bool    `json:"isNonSmoker"`
+	HasDisease   bool    `json:"hasDisease"`
+	RegisteredAt int64   `json:"registeredAt,omitempty"`
+	Status       string  `json:"status,omitempty"`
+}
+
+// CoverageBalance mirrors the registration chaincode's used and remaining cover of a registration
+type CoverageBalance struct {
+	UserID          string  `json:"userId"`
+	PolicyID        string  `json:"policyId"`
+	CoverAmount     float64 `json:"coverAmount"`
+	UsedAmount      float64 `json:"usedAmount"`
+	RemainingAmount float64 `json:"remainingAmount"`
+}
+
+// CoverageDebit mirrors the registration chaincode's result of drawing a claim against a member's cover
+type CoverageDebit struct {
+	SchemaVersion   string  `json:"schemaVersion"`
+	ClaimID         string  `json:"claimId"`
+	UserID          string  `json:"userId"`
+	PolicyID        string  `json:"policyId"`
+	RequestedAmount float64 `json:"requestedAmount"`
+	GrantedAmount   float64 `json:"grantedAmount"`
+	RemainingAmount float64 `json:"remainingAmount"`
+}
+
+func (d *CoverageDebit) schemaVersion() string { return d.SchemaVersion }
+
+// SetRegistrationTarget allows a registry admin to point the claims chaincode at the registration chaincode
+// that holds policies, registrations and cover balances. An empty channel means the claims chaincode's own
+// channel. Fabric discards the writes of a chaincode called on another channel, which would lose cover draws,
+// so the target must share this channel. Roles and delegations are always resolved in registryChaincode,
+// never through the target, and the target can only be changed again with the endorsement of every
+// registry admin.
+func (s *SmartContract) SetRegistrationTarget(ctx contractapi.TransactionContextInterface, chaincodeName string, channel string) error {
+	if err := authorize(ctx, "set the registration chaincode target", registryAdmin); err != nil {
+		return err
+	}
+	if chaincodeName == "" {
+		return fmt.Errorf("a registration chaincode name is required")
+	}
+
+	ownChannel := ctx.GetStub().GetChannelID()
+	if channel == "" {
+		channel = ownChannel
+	}
+	if channel != ownChannel {
+		return fmt.Errorf("registration chaincode must be on channel %s, cross-channel calls cannot update cover balances", ownChannel)
+	}
+
+	setBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	targetJSON, err := json.Marshal(RegistrationTarget{
+		DocType:       configDocType,
+		ChaincodeName: chaincodeName,
+		Channel:       channel,
+		SetBy:         setBy,
+		SetAt:         timestamp.Seconds,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal registration target: %v", err)
+	}
+
+	targetKey, err := ctx.GetStub().CreateCompositeKey("config", []string{"registrationTarget"})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(targetKey, targetJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put registration target: %v", err)
+	}
+
+	endorsers, err := registryAdminOrgs(ctx)
+	if err != nil {
+		return err
+	}
+
+	return setKeyEndorsers(ctx, targetKey, endorsers)
+}
+
+// registryAdminOrgs returns the organisations the registry makes registry admins, including the caller's,
+// which authorize has just confirmed is one
+func registryAdminOrgs(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	callerMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	var records []*OrgRecord
+	err = invokeRegistry(ctx, "OrgRegistryContract:QueryAllOrgs", nil, &records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list registry admins: %v", err)
+	}
+
+	admins := []string{callerMSP}
+	for _, record := range records {
+		if record.MSPID != callerMSP && authz.ContainsRole(record.Roles, RoleRegistryAdmin) {
+			admins = append(admins, record.MSPID)
+		}
+	}
+
+	return admins, nil
+}
+
+// QueryRegistrationTarget returns the registration chaincode the claims chaincode calls
+func (s *SmartContract) QueryRegistrationTarget(ctx contractapi.TransactionContextInterface) (*RegistrationTarget, error) {
+	return getRegistrationTarget(ctx)
+}
+
+// getRegistrationTarget reads the configured target, defaulting to the registration chaincode on this channel
+func getRegistrationTarget(ctx contractapi.TransactionContextInterface) (*RegistrationTarget, error) {
+	targetKey, err := ctx.GetStub().CreateCompositeKey("config", []string{"registrationTarget"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	targetJSON, err := ctx.GetStub().GetState(targetKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registration target: %v", err)
+	}
+	if targetJSON == nil {
+		return &RegistrationTarget{ChaincodeName: defaultRegistrationChaincode, Channel: ctx.GetStub().GetChannelID()}, nil
+	}
+
+	var target RegistrationTarget
+	err = json.Unmarshal(targetJSON, &target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal registration target: %v", err)
+	}
+
+	return &target, nil
+}
+
+// invokeRegistration calls a function of the configured registration chaincode and, when out is given,
+// decodes its JSON response into it
+func invokeRegistration(ctx contractapi.TransactionContextInterface, function string, args []string, out interface{}) error {
+	target, err := getRegistrationTarget(ctx)
+	if err != nil {
+		return err
+	}
+
+	return invokeChaincode(ctx, target.ChaincodeName, target.Channel, function, args, out)
+}
+
+// invokeRegistry calls a function of registryChaincode. Every answer an access check depends on comes from
+// here, so repointing the registration target cannot grant roles or delegations.
+func invokeRegistry(ctx contractapi.TransactionContextInterface, function string, args []string, out interface{}) error {
+	return invokeChaincode(ctx, registryChaincode, ctx.GetStub().GetChannelID(), function, args, out)
+}
+
+// invokeChaincode calls a registration chaincode function and decodes its JSON response into out. Versioned
+// responses are rejected when their major version is not the one this chaincode understands.
+func invokeChaincode(ctx contractapi.TransactionContextInterface, chaincodeName, channel, function string, args []string, out interface{}) error {
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	response := ctx.GetStub().InvokeChaincode(chaincodeName, invokeArgs, channel)
+	if response.Status != 200 {
+		return fmt.Errorf("%s failed in the registration chaincode: %v", function, response.Message)
+	}
+	if out == nil {
+		return nil
+	}
+
+	err := json.Unmarshal(response.Payload, out)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal %s response: %v", function, err)
+	}
+
+	if versioned, ok := out.(versionedResponse); ok {
+		major := strings.SplitN(versioned.schemaVersion(), ".", 2)[0]
+		if major != supportedInteropMajor {
+			return fmt.Errorf("%s answered with schema version %q, expected %s.x", function, versioned.schemaVersion(), supportedInteropMajor)
+		}
+	}
+
+	return nil
+}
+
+// consumeCoverage draws a claim's settlement against the member's remaining cover and returns how much was
+// granted, which is less than requested when the cover is nearly used up. The registration chaincode keeps
+// one debit per claim, so a retried draw returns the first grant instead of spending the cover again.
+func consumeCoverage(ctx contractapi.TransactionContextInterface, claim *Claim, amount float64) (float64, error) {
+	var debit CoverageDebit
+	err := invokeRegistration(ctx, "ConsumeCoverage", []string{claim.UserID, claim.PolicyID, claim.ClaimID, strconv.FormatFloat(amount, 'f', -1, 64)}, &debit)
+	if err != nil {
+		return 0, err
+	}
+
+	return debit.GrantedAmount, nil
+}
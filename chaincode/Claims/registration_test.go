@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+)
+
+func TestSetRegistrationTarget(t *testing.T) {
+	registryAdmin := &fakeIdentity{id: "admin3", mspID: "Org3MSP", admin: true}
+
+	tests := []struct {
+		name    string
+		caller  *fakeIdentity
+		channel string
+		set     bool
+	}{
+		{"registry admin on this channel", registryAdmin, "", true},
+		{"registry admin naming this channel", registryAdmin, testChannel, true},
+		{"registry admin on another channel", registryAdmin, "otherchannel", false},
+		{"registry admin's identity without an admin certificate", withJob("Org3MSP", JobAuditor), "", false},
+		{"admin of an insurer", &fakeIdentity{id: "admin1", mspID: "Org1MSP", admin: true}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := claimTestRegistry("")
+			registry["OrgRegistryContract:QueryOrg Org3MSP"] = testOrg("Org3MSP", RoleRegistryAdmin)
+			registry["OrgRegistryContract:QueryAllOrgs"] = []*OrgRecord{
+				testOrg("Org1MSP", RoleInsurer),
+				testOrg("Org3MSP", RoleRegistryAdmin),
+				testOrg("Org5MSP", RoleProvider, RoleRegistryAdmin),
+			}
+			ctx, stub := newTestContext(t, tt.caller, registry)
+
+			err := new(SmartContract).SetRegistrationTarget(ctx, "registration-v2", tt.channel)
+			if !tt.set {
+				if err == nil {
+					t.Fatal("expected the target to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			target, err := new(SmartContract).QueryRegistrationTarget(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target.ChaincodeName != "registration-v2" || target.Channel != testChannel {
+				t.Fatalf("expected registration-v2 on %s, got %s on %s", testChannel, target.ChaincodeName, target.Channel)
+			}
+
+			targetKey, err := stub.CreateCompositeKey("config", []string{"registrationTarget"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			policy, err := stub.GetStateValidationParameter(targetKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			endorsement, err := statebased.NewStateEP(policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			endorsers := endorsement.ListOrgs()
+			sort.Strings(endorsers)
+			if strings.Join(endorsers, ",") != "Org3MSP,Org5MSP" {
+				t.Fatalf("expected every registry admin to endorse changes of the target, got %v", endorsers)
+			}
+		})
+	}
+}
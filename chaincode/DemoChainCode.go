@@ -11,21 +11,24 @@ type SmartContract struct {
 }
 
 type Policy struct {
-	PolicyID   string json:"policyID"
-	HolderName string json:"holderName"
-	Status     string json:"status"
+	DocType    string `json:"docType"`
+	PolicyID   string `json:"policyID"`
+	HolderName string `json:"holderName"`
+	Status     string `json:"status"`
 }
 
 type Claim struct {
-	ClaimID   string  json:"claimID"
-	PolicyID  string  json:"policyID"
-	Amount    float64 json:"amount"
-	Status    string  json:"status"
+	DocType  string  `json:"docType"`
+	ClaimID  string  `json:"claimID"`
+	PolicyID string  `json:"policyID"`
+	Amount   float64 `json:"amount"`
+	Status   string  `json:"status"`
 }
 
 // Register a new policy
 func (s *SmartContract) RegisterPolicy(ctx contractapi.TransactionContextInterface, policyID string, holderName string) error {
 	policy := Policy{
+		DocType:    "policy",
 		PolicyID:   policyID,
 		HolderName: holderName,
 		Status:     "Active",
@@ -46,6 +49,7 @@ func (s *SmartContract) ProcessClaim(ctx contractapi.TransactionContextInterface
 	}
 
 	claim := Claim{
+		DocType:  "claim",
 		ClaimID:  claimID,
 		PolicyID: policyID,
 		Amount:   amount,
@@ -122,8 +126,14 @@ func (s *SmartContract) QueryClaim(ctx contractapi.TransactionContextInterface,
 
 // Query claims by policy ID
 func (s *SmartContract) QueryClaimsByPolicy(ctx contractapi.TransactionContextInterface, policyID string) ([]*Claim, error) {
-	queryString := fmt.Sprintf("{\"selector\":{\"policyID\":\"%s\"}}", policyID)
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	// Marshal the selector so the policy ID stays a JSON string value and cannot inject operators
+	queryJSON, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{"docType": "claim", "policyID": policyID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to build claims query: %s", err.Error())
+	}
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryJSON))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to retrieve claims: %s", err.Error())
 	}
@@ -157,4 +167,3 @@ func main() {
 		fmt.Printf("Error starting insurance chaincode: %s", err.Error())
 	}
 }
-
@@ -18,17 +18,30 @@ type SmartContract struct {
 	contractapi.Contract
 }
 
+// Registration statuses
+const (
+	RegistrationActive    = "Active"
+	RegistrationCancelled = "Cancelled"
+)
+
 // Registration defines the structure for a policy registration
 type Registration struct {
+	DocType      string  `json:"docType"`
 	UserID       string  `json:"userId"`
 	PolicyID     string  `json:"policyId"`
 	PremiumPaid  float64 `json:"premiumPaid"`
 	IsNonSmoker  bool    `json:"isNonSmoker"`
 	HasDisease   bool    `json:"hasDisease"`
+	RegisteredBy string  `json:"registeredBy,omitempty"` // Set when a delegate registered on the member's behalf
+	RegisteredAt int64   `json:"registeredAt,omitempty"`
+	Status       string  `json:"status,omitempty"` // RegistrationActive or RegistrationCancelled; empty on registrations made before statuses were kept
+	CancelledAt  int64   `json:"cancelledAt,omitempty"`
+	CancelReason string  `json:"cancelReason,omitempty"`
 }
 
 // Modify the PrivateData struct to include the new boolean fields
 type PrivateData struct {
+	DocType     string `json:"docType"`
 	ID          string `json:"id"`
 	IsNonSmoker bool   `json:"isNonSmoker"`
 	HasDisease  bool   `json:"hasDisease"`
@@ -37,6 +50,7 @@ type PrivateData struct {
 
 // Policy defines the structure for a policy
 type Policy struct {
+	DocType       string            `json:"docType"`
 	PolicyID      string            `json:"policyId"`
 	PolicyType    string            `json:"policyType"`
 	CoverAmount   float64           `json:"coverAmount"`
@@ -45,6 +59,7 @@ type Policy struct {
 	EndDate       string            `json:"endDate"`
 	Criteria      Criteria          `json:"criteria"` // Changed to Criteria struct
 	CoveredDiseases []string        `json:"coveredDiseases"`
+	InsurerMSP    string            `json:"insurerMsp,omitempty"` // Org that defined the policy; empty on policies defined before it was kept
 }
 
 // Criteria defines the structure for the criteria to be checked
@@ -56,7 +71,7 @@ type Criteria struct {
 var policyList = make(map[string]Policy) // Map to store policies by policyID
 
 
-// DefinePolicy: Allows Org2 to define a policy(insurance provider)
+// DefinePolicy: Allows an underwriter to define a policy
 func (s *SmartContract) DefinePolicy(ctx contractapi.TransactionContextInterface, policyID, policyType string, coverAmount, premium float64, startDate, endDate, criteriaJSON string, diseasesJSON string) error {
 	var criteria Criteria
 	err := json.Unmarshal([]byte(criteriaJSON), &criteria)
@@ -64,13 +79,13 @@ func (s *SmartContract) DefinePolicy(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to parse criteria JSON: %v", err)
 	}
 
+	if err := authorize(ctx, "define policies", insurerUnderwriter); err != nil {
+		return err
+	}
 	orgID, err1 := ctx.GetClientIdentity().GetMSPID()
 	if err1 != nil {
 		return fmt.Errorf("failed to get client identity: %v", err1)
 	}
-	if orgID != "Org2MSP" {
-		return fmt.Errorf("only Org2 can define policies")
-	}
 
 	var coveredDiseases []string
 	err = json.Unmarshal([]byte(diseasesJSON), &coveredDiseases)
@@ -79,6 +94,7 @@ func (s *SmartContract) DefinePolicy(ctx contractapi.TransactionContextInterface
 	}
 
 	policy := Policy{
+		DocType:       policyDocType,
 		PolicyID:      policyID,
 		PolicyType:    policyType,
 		CoverAmount:   coverAmount,
@@ -87,6 +103,7 @@ func (s *SmartContract) DefinePolicy(ctx contractapi.TransactionContextInterface
 		EndDate:       endDate,
 		Criteria:      criteria,
 		CoveredDiseases: coveredDiseases,
+		InsurerMSP:    orgID,
 	}
 	//list storage
 	policyList[policyID] = policy
@@ -96,7 +113,22 @@ func (s *SmartContract) DefinePolicy(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to marshal policy: %v", err)
 	}
 
-	return ctx.GetStub().PutState(policyID, policyJSON)
+	emitEvent(ctx, EventPolicyDefined, PolicyDefinedEvent{
+		PolicyID:    policyID,
+		PolicyType:  policyType,
+		CoverAmount: coverAmount,
+		Premium:     premium,
+		StartDate:   startDate,
+		EndDate:     endDate,
+	})
+
+	err = ctx.GetStub().PutState(policyID, policyJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store policy: %v", err)
+	}
+
+	// Only the defining insurer may change the policy from now on
+	return setKeyEndorsers(ctx, policyID, []string{orgID})
 }
 
 
@@ -152,6 +184,10 @@ func (s *SmartContract) QueryAllPolicies(ctx contractapi.TransactionContextInter
 			if err != nil {
 				return nil, fmt.Errorf("failed to unmarshal policy JSON from value: %v", err)
 			}
+			// Registrations share the key space with policies; skip anything tagged as another record type
+			if policy.DocType != "" && policy.DocType != policyDocType {
+				continue
+			}
 
 			policies = append(policies, policy)
 		}
@@ -166,6 +202,12 @@ func (s *SmartContract) QueryAllPolicies(ctx contractapi.TransactionContextInter
 
 // RegisterForPolicy: Allows users to register for a policy, while Org2 queries health records for validation
 func (s *SmartContract) RegisterForPolicy(ctx contractapi.TransactionContextInterface, userID, policyID string, premiumPaid float64, isNonSmoker, hasDisease bool, consent bool) error {
+	// A guardian or representative registering a dependant needs a delegation covering it
+	err := authorizeActingFor(ctx, userID, "register")
+	if err != nil {
+		return err
+	}
+
 	// Fetch the policy to validate if criteria match
 	policyJSON, err := ctx.GetStub().GetState(policyID)
 	if err != nil {
@@ -188,8 +230,24 @@ func (s *SmartContract) RegisterForPolicy(ctx contractapi.TransactionContextInte
 
 	// Fetch the health records only if consent is granted by the patient
 	if consent {
-		// Org2 queries the health records within a valid window
-		healthRecord, err := s.QueryHealthRecords(ctx, userID)
+		err = authorizeActingFor(ctx, userID, "consent")
+		if err != nil {
+			return err
+		}
+
+		actingMember, err := callerUserID(ctx)
+		if err != nil {
+			return err
+		}
+
+		// A member, or their delegate, consents to the patient's own record being checked. Org identities
+		// query it under their own access rules, which give insurers only a valid window.
+		var healthRecord *PrivateData
+		if actingMember != "" {
+			healthRecord, err = getHealthRecord(ctx, userID)
+		} else {
+			healthRecord, err = s.QueryHealthRecords(ctx, userID)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to query health records: %v", err)
 		}
@@ -204,11 +262,28 @@ func (s *SmartContract) RegisterForPolicy(ctx contractapi.TransactionContextInte
 
 		// If validation passes, register the user for the policy
 		registration := Registration{
+			DocType:     registrationDocType,
 			UserID:      userID,
 			PolicyID:    policyID,
 			PremiumPaid: premiumPaid,
 			IsNonSmoker: isNonSmoker,
 			HasDisease:  hasDisease,
+			Status:      RegistrationActive,
+		}
+
+		registeredAt, err := txTimestamp(ctx)
+		if err != nil {
+			return err
+		}
+		registration.RegisteredAt = registeredAt.Unix()
+
+		// Record the delegate when somebody other than the member registered
+		registeredBy, err := callerUserID(ctx)
+		if err != nil {
+			return err
+		}
+		if registeredBy != userID {
+			registration.RegisteredBy = registeredBy
 		}
 
 		// Store the registration
@@ -222,12 +297,36 @@ func (s *SmartContract) RegisterForPolicy(ctx contractapi.TransactionContextInte
 			return fmt.Errorf("failed to store registration: %v", err)
 		}
 
+		// Open the sum-insured balance that claims draw down
+		err = openCoverageBalance(ctx, userID, &policy)
+		if err != nil {
+			return fmt.Errorf("failed to open coverage balance: %v", err)
+		}
+
 		// Store the userID -> policyID mapping for cross-chaincode access
 		err = s.UpdateUserPolicyMapping(ctx, userID, policyID)
 		if err != nil {
 			return fmt.Errorf("failed to update user-policy mapping: %v", err)
 		}
 
+		// Rank the policy among the member's payers for coordination of benefits
+		err = addToPayerOrder(ctx, userID, policyID)
+		if err != nil {
+			return fmt.Errorf("failed to update payer order: %v", err)
+		}
+
+		// Count the premium towards the policy's analytics
+		err = recordPremium(ctx, policyID, userID, premiumPaid)
+		if err != nil {
+			return fmt.Errorf("failed to record premium: %v", err)
+		}
+
+		emitEvent(ctx, EventRegistered, RegisteredEvent{
+			UserID:       userID,
+			PolicyID:     policyID,
+			RegisteredBy: registration.RegisteredBy,
+		})
+
 		return nil
 	} else {
 		return fmt.Errorf("patient consent is required to query health records")
@@ -256,6 +355,48 @@ func (s *SmartContract) QueryRegistration(ctx contractapi.TransactionContextInte
 	return &registration, nil
 }
 
+// CancelRegistration: Allows an underwriter to end a member's registration, after which claims are no longer covered
+func (s *SmartContract) CancelRegistration(ctx contractapi.TransactionContextInterface, userID, policyID, reason string) error {
+	if err := authorize(ctx, "cancel registrations", insurerUnderwriter); err != nil {
+		return err
+	}
+	if reason == "" {
+		return fmt.Errorf("a reason is required to cancel a registration")
+	}
+
+	registration, err := s.QueryRegistration(ctx, userID, policyID)
+	if err != nil {
+		return err
+	}
+	if registration.Status == RegistrationCancelled {
+		return fmt.Errorf("registration for user %s and policy %s is already cancelled", userID, policyID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	registration.DocType = registrationDocType
+	registration.Status = RegistrationCancelled
+	registration.CancelledAt = now.Unix()
+	registration.CancelReason = reason
+
+	registrationJSON, err := json.Marshal(registration)
+	if err != nil {
+		return fmt.Errorf("failed to marshal registration: %v", err)
+	}
+
+	// A cancelled policy no longer pays, so the secondary payer moves up
+	err = dropFromPayerOrder(ctx, userID, policyID)
+	if err != nil {
+		return fmt.Errorf("failed to update payer order: %v", err)
+	}
+
+	emitEvent(ctx, EventRegistrationCancelled, RegisteredEvent{UserID: userID, PolicyID: policyID})
+
+	return ctx.GetStub().PutState(fmt.Sprintf("%s-%s", userID, policyID), registrationJSON)
+}
+
 // UpdateUserPolicyMapping: Updates the userID -> policyID mapping
 func (s *SmartContract) UpdateUserPolicyMapping(ctx contractapi.TransactionContextInterface, userID, policyID string) error {
 	// Create a composite key for user-policy mapping
@@ -297,18 +438,15 @@ func (s *SmartContract) QueryPolicyByUserID(ctx contractapi.TransactionContextIn
 
 
 
-// UploadHealthRecords: Allows Org1 to upload health records with boolean values like isNonSmoker and hasDisease
+// UploadHealthRecords: Allows a clinician to upload health records with boolean values like isNonSmoker and hasDisease
 func (s *SmartContract) UploadHealthRecords(ctx contractapi.TransactionContextInterface, id string, isNonSmoker, hasDisease bool) error {
-	orgID, err := ctx.GetClientIdentity().GetMSPID()
-	if err != nil {
-		return fmt.Errorf("failed to get client identity: %v", err)
-	}
-	if orgID != "Org1MSP" {
-		return fmt.Errorf("only Org1 can upload health records")
+	if err := authorize(ctx, "upload health records", providerClinician); err != nil {
+		return err
 	}
 
 	// Create a struct for health record with boolean fields
 	privateData := PrivateData{
+		DocType:     healthRecordDocType,
 		ID:          id,
 		IsNonSmoker: isNonSmoker,
 		HasDisease:  hasDisease,
@@ -321,23 +459,59 @@ func (s *SmartContract) UploadHealthRecords(ctx contractapi.TransactionContextIn
 		return fmt.Errorf("failed to marshal private data: %v", err)
 	}
 
+	emitEvent(ctx, EventHealthRecordUploaded, HealthRecordUploadedEvent{ID: id})
+
 	// Store the private data in Org1MSP's private collection
 	return ctx.GetStub().PutPrivateData("Org1MSPPrivateCollection", id, privateDataJSON)
 }
 
 
-// QueryHealthRecords: Allows Org2 to query health records within a time window, or Org1 at any time
+// QueryHealthRecords: Allows underwriters to query health records within a time window, or clinicians at any time.
+// Holders of an active break-glass grant can read outside these rules.
 func (s *SmartContract) QueryHealthRecords(ctx contractapi.TransactionContextInterface, id string) (*PrivateData, error) {
-	orgID, err := ctx.GetClientIdentity().GetMSPID()
+	isClinician, err := callerHolds(ctx, providerClinician)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get client identity: %v", err)
+		return nil, err
+	}
+	isUnderwriter, err := callerHolds(ctx, insurerUnderwriter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Anybody else needs an active break-glass grant
+	breakGlass := false
+	if !isClinician && !isUnderwriter {
+		breakGlass, err = hasActiveBreakGlassGrant(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !breakGlass {
+			return nil, accessDenied("query health records", providerClinician.String(), insurerUnderwriter.String(), "an active break-glass grant")
+		}
 	}
 
-	// Org2 can query health records only within a time window
-	if orgID != "Org1MSP" && orgID != "Org2MSP" {
-		return nil, fmt.Errorf("only Org1 and Org2 can query health records")
+	privateData, err := getHealthRecord(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
+	// Underwriters who are not also clinicians only get a time window (e.g., 70 seconds)
+	currentTime := time.Now().Unix()
+	if isUnderwriter && !isClinician && currentTime-privateData.Timestamp > 70 {
+		breakGlass, err = hasActiveBreakGlassGrant(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !breakGlass {
+			return nil, accessDenied("query health records after the underwriting window", providerClinician.String(), "an active break-glass grant")
+		}
+	}
+
+	return privateData, nil
+}
+
+// getHealthRecord reads a health record from the provider collection without any access check
+func getHealthRecord(ctx contractapi.TransactionContextInterface, id string) (*PrivateData, error) {
 	// Fetch the private data (health record)
 	privateDataJSON, err := ctx.GetStub().GetPrivateData("Org1MSPPrivateCollection", id)
 	if err != nil {
@@ -354,12 +528,6 @@ func (s *SmartContract) QueryHealthRecords(ctx contractapi.TransactionContextInt
 		return nil, fmt.Errorf("failed to unmarshal private data: %v", err)
 	}
 
-	// If Org2, check if it's within the time window (e.g., 70 seconds)
-	currentTime := time.Now().Unix()
-	if orgID == "Org2MSP" && currentTime-privateData.Timestamp > 70 {
-		return nil, fmt.Errorf("health records are no longer available for query by Org2")
-	}
-
 	return &privateData, nil
 }
 
@@ -368,9 +536,16 @@ func (s *SmartContract) QueryHealthRecords(ctx contractapi.TransactionContextInt
 func main() {
 	// Create a new SmartContract object
 	smartContract := new(SmartContract)
+	smartContract.TransactionContextHandler = new(TransactionContext)
+	smartContract.AfterTransaction = flushEvents
+
+	// The organisation registry is called with the "OrgRegistryContract:" prefix
+	orgRegistry := new(OrgRegistryContract)
+	orgRegistry.TransactionContextHandler = new(TransactionContext)
+	orgRegistry.AfterTransaction = flushEvents
 
-	// Create a new contract API that holds all the transactions
-	chaincode, err := contractapi.NewChaincode(smartContract)
+	// Create a new contract API that holds all the transactions; the first contract is the default
+	chaincode, err := contractapi.NewChaincode(smartContract, orgRegistry)
 	if err != nil {
 		fmt.Printf("Error creating chaincode: %s", err.Error())
 		return
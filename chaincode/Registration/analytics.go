@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// analyticsPeriodLayout is the format of the monthly periods analytics are grouped by
+const analyticsPeriodLayout = "2006-01"
+
+// PremiumDelta records the premium collected by one registration. Each registration writes its own key
+// rather than updating a running total, so concurrent registrations for a policy never conflict.
+type PremiumDelta struct {
+	DocType  string  `json:"docType"`
+	PolicyID string  `json:"policyId"`
+	Period   string  `json:"period"`
+	UserID   string  `json:"userId"`
+	Amount   float64 `json:"amount"`
+}
+
+// PremiumSummary is the response of QueryPremiumsCollected
+type PremiumSummary struct {
+	SchemaVersion     string  `json:"schemaVersion"`
+	PolicyID          string  `json:"policyId"`
+	Period            string  `json:"period"` // Empty for the lifetime of the policy
+	Registrations     int     `json:"registrations"`
+	PremiumsCollected float64 `json:"premiumsCollected"`
+}
+
+// QueryPremiumsCollected: Allows an underwriter or auditor to total the premiums collected for a policy in a
+// period ("2006-01"), or over the lifetime of the policy when the period is empty
+func (s *SmartContract) QueryPremiumsCollected(ctx contractapi.TransactionContextInterface, policyID, period string) (*PremiumSummary, error) {
+	if err := authorize(ctx, "query premium analytics", insurerUnderwriter, insurerAuditor); err != nil {
+		return nil, err
+	}
+
+	keyParts := []string{policyID}
+	if period != "" {
+		if _, err := time.Parse(analyticsPeriodLayout, period); err != nil {
+			return nil, fmt.Errorf("failed to parse period %s: %v", period, err)
+		}
+		keyParts = append(keyParts, period)
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("PremiumDelta", keyParts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read premium records: %v", err)
+	}
+	defer iterator.Close()
+
+	summary := &PremiumSummary{SchemaVersion: interopSchemaVersion, PolicyID: policyID, Period: period}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next premium record: %v", err)
+		}
+
+		var delta PremiumDelta
+		err = json.Unmarshal(queryResponse.Value, &delta)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal premium record: %v", err)
+		}
+		summary.Registrations++
+		summary.PremiumsCollected += delta.Amount
+	}
+
+	return summary, nil
+}
+
+// recordPremium adds a registration's premium to the policy's analytics for the current period
+func recordPremium(ctx contractapi.TransactionContextInterface, policyID, userID string, amount float64) error {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	period := now.UTC().Format(analyticsPeriodLayout)
+
+	deltaJSON, err := json.Marshal(PremiumDelta{
+		DocType:  premiumDeltaDocType,
+		PolicyID: policyID,
+		Period:   period,
+		UserID:   userID,
+		Amount:   amount,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal premium record: %v", err)
+	}
+
+	deltaKey, err := ctx.GetStub().CreateCompositeKey("PremiumDelta", []string{policyID, period, ctx.GetStub().GetTxID()})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(deltaKey, deltaJSON)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"insurance/internal/authz"
+)
+
+// ArbitratorConfig names the optional org that makes the final ruling on appeals against an insurer's claims
+type ArbitratorConfig struct {
+	DocType    string `json:"docType"`
+	InsurerMSP string `json:"insurerMsp"`
+	MSPID      string `json:"mspId"` // Empty when no arbitrator is appointed and the insurer decides appeals
+	SetBy      string `json:"setBy,omitempty"`
+	SetAt      int64  `json:"setAt,omitempty"`
+}
+
+// SetArbitrator: Allows a registry admin to appoint the org that rules on appeals against an insurer's claims,
+// or clear it with an empty MSP ID. The arbitrator must be a registered org other than the insurer.
+func (s *SmartContract) SetArbitrator(ctx contractapi.TransactionContextInterface, insurerMSP string, mspID string) error {
+	if err := authorize(ctx, "appoint an arbitrator", registryAdmin); err != nil {
+		return err
+	}
+
+	insurer, err := getOrgRecord(ctx, insurerMSP)
+	if err != nil {
+		return err
+	}
+	if !authz.ContainsRole(insurer.Roles, RoleInsurer) {
+		return fmt.Errorf("%s is not an %s in the organisation registry", insurerMSP, RoleInsurer)
+	}
+	if mspID != "" {
+		if mspID == insurerMSP {
+			return fmt.Errorf("an insurer cannot arbitrate appeals against its own claims")
+		}
+		arbitrator, err := getOrgRecord(ctx, mspID)
+		if err != nil {
+			return err
+		}
+		if arbitrator.DocType == "" {
+			return fmt.Errorf("arbitrator %s is not in the organisation registry", mspID)
+		}
+	}
+
+	setBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	configJSON, err := json.Marshal(ArbitratorConfig{DocType: configDocType, InsurerMSP: insurerMSP, MSPID: mspID, SetBy: setBy, SetAt: now.Unix()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal arbitrator config: %v", err)
+	}
+
+	configKey, err := ctx.GetStub().CreateCompositeKey("Config", []string{"arbitrator", insurerMSP})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(configKey, configJSON)
+}
+
+// QueryArbitrator: Returns the arbitrator appointed for an insurer, with an empty MSP ID when there is none
+func (s *SmartContract) QueryArbitrator(ctx contractapi.TransactionContextInterface, insurerMSP string) (*ArbitratorConfig, error) {
+	return getArbitrator(ctx, insurerMSP)
+}
+
+func getArbitrator(ctx contractapi.TransactionContextInterface, insurerMSP string) (*ArbitratorConfig, error) {
+	configKey, err := ctx.GetStub().CreateCompositeKey("Config", []string{"arbitrator", insurerMSP})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	configJSON, err := ctx.GetStub().GetState(configKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read arbitrator config: %v", err)
+	}
+	if configJSON == nil {
+		return &ArbitratorConfig{InsurerMSP: insurerMSP}, nil
+	}
+
+	var config ArbitratorConfig
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arbitrator config: %v", err)
+	}
+
+	return &config, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSetArbitrator(t *testing.T) {
+	registryAdmin := &fakeIdentity{id: "admin1", mspID: "Org1MSP", admin: true}
+
+	tests := []struct {
+		name       string
+		caller     *fakeIdentity
+		insurer    string
+		arbitrator string
+		appointed  bool
+	}{
+		{"registry admin appoints a registered org", registryAdmin, "Org2MSP", "Org3MSP", true},
+		{"registry admin clears the arbitrator", registryAdmin, "Org2MSP", "", true},
+		{"insurer arbitrating its own claims", registryAdmin, "Org2MSP", "Org2MSP", false},
+		{"unregistered arbitrator", registryAdmin, "Org2MSP", "Org9MSP", false},
+		{"arbitrator for an org that is not an insurer", registryAdmin, "Org3MSP", "Org1MSP", false},
+		{"registry admin's identity without an admin certificate", &fakeIdentity{id: "auditor1", mspID: "Org1MSP", attrs: map[string]string{JobAuditor: "true"}}, "Org2MSP", "Org3MSP", false},
+		{"admin of the insurer", &fakeIdentity{id: "admin2", mspID: "Org2MSP", admin: true}, "Org2MSP", "Org3MSP", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newTestContext(t, "registration")
+			registerTestOrg(t, stub, "Org1MSP", RoleRegistryAdmin)
+			registerTestOrg(t, stub, "Org2MSP", RoleInsurer)
+			registerTestOrg(t, stub, "Org3MSP", RoleRegulator)
+			ctx.SetClientIdentity(tt.caller)
+
+			err := new(SmartContract).SetArbitrator(ctx, tt.insurer, tt.arbitrator)
+			if !tt.appointed {
+				if err == nil {
+					t.Fatal("expected the appointment to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := new(SmartContract).QueryArbitrator(ctx, tt.insurer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.MSPID != tt.arbitrator {
+				t.Fatalf("expected arbitrator %q, got %q", tt.arbitrator, config.MSPID)
+			}
+		})
+	}
+}
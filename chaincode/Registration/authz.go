@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"insurance/internal/authz"
+)
+
+// Job roles, as defined by the authorisation package shared with the claims chaincode
+const (
+	JobUnderwriter = authz.JobUnderwriter
+	JobAdjuster    = authz.JobAdjuster
+	JobClinician   = authz.JobClinician
+	JobAuditor     = authz.JobAuditor
+	JobMember      = authz.JobMember
+)
+
+// permission is one way of being allowed an action: holding a job role in an organisation with a role
+type permission = authz.Permission
+
+// The permissions transactions grant
+var (
+	insurerUnderwriter = authz.InsurerUnderwriter
+	insurerAdjuster    = authz.InsurerAdjuster
+	insurerAuditor     = authz.InsurerAuditor
+	providerClinician  = authz.ProviderClinician
+	providerAuditor    = authz.ProviderAuditor
+	regulatorAuditor   = authz.RegulatorAuditor
+	registryAdmin      = authz.RegistryAdmin
+	anyMember          = authz.AnyMember
+)
+
+// checker reads organisation roles straight from this chaincode's registry
+var checker = authz.Checker{
+	UserID: callerUserID,
+	OrgRoles: func(ctx contractapi.TransactionContextInterface) ([]string, error) {
+		mspID, err := ctx.GetClientIdentity().GetMSPID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client identity: %v", err)
+		}
+		record, err := getOrgRecord(ctx, mspID)
+		if err != nil {
+			return nil, err
+		}
+		return record.Roles, nil
+	},
+}
+
+// authorize fails with an AccessDeniedError unless the caller holds at least one of the permissions
+func authorize(ctx contractapi.TransactionContextInterface, action string, allowed ...permission) error {
+	return checker.Authorize(ctx, action, allowed...)
+}
+
+// callerHolds is authorize for callers that branch on the outcome instead of refusing
+func callerHolds(ctx contractapi.TransactionContextInterface, allowed ...permission) (bool, error) {
+	return checker.Holds(ctx, allowed...)
+}
+
+// accessDenied builds the error for an action refused for want of the listed requirements
+func accessDenied(action string, requires ...string) error {
+	return authz.Denied(action, requires...)
+}
+
+// isAccessDenied tells a refusal apart from a failure to evaluate the check
+func isAccessDenied(err error) bool {
+	return authz.IsDenied(err)
+}
+
+// callerHasAttribute tells whether the caller's certificate carries the attribute set to "true"
+func callerHasAttribute(ctx contractapi.TransactionContextInterface, attribute string) (bool, error) {
+	return authz.HasAttribute(ctx, attribute)
+}
+
+// callerIsOrgAdmin tells whether the caller's certificate is an org admin certificate
+func callerIsOrgAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
+	return authz.IsOrgAdmin(ctx)
+}
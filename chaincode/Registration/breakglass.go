@@ -0,0 +1,341 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// breakGlassWindow is how long an emergency grant lets the holder read a patient's health records
+const breakGlassWindow = 30 * time.Minute
+
+// emergencyAccessAttribute is the certificate attribute that marks an identity as allowed to break the glass
+const emergencyAccessAttribute = "emergencyAccess"
+
+// breakGlassCollection holds the patient and reason of each emergency grant, which the world state and the
+// event carry only as hashes. It is never purged, so reviews can always read them.
+const breakGlassCollection = "RegistrationBreakGlassCollection"
+
+// BreakGlassGrant records an emergency override of the normal health record access rules
+type BreakGlassGrant struct {
+	DocType      string `json:"docType"`
+	GrantID      string `json:"grantId"`
+	PatientHash  string `json:"patientHash"` // SHA-256 of the patient ID
+	GranteeID    string `json:"granteeId"`
+	GranteeMSP   string `json:"granteeMsp"`
+	ReasonHash   string `json:"reasonHash"` // SHA-256 of the reason kept in breakGlassCollection
+	GrantedAt    int64  `json:"grantedAt"`
+	ExpiresAt    int64  `json:"expiresAt"`
+	ReviewStatus string `json:"reviewStatus"` // "PendingReview", "Justified", "Unjustified"
+	ReviewedBy   string `json:"reviewedBy,omitempty"`
+	ReviewNotes  string `json:"reviewNotes,omitempty"`
+	ReviewedAt   int64  `json:"reviewedAt,omitempty"`
+}
+
+// BreakGlassDetails is the private part of a grant: whose records were opened and why
+type BreakGlassDetails struct {
+	GrantID   string `json:"grantId"`
+	PatientID string `json:"patientId"`
+	Reason    string `json:"reason"`
+}
+
+// BreakGlassReview is a grant awaiting review together with its private details
+type BreakGlassReview struct {
+	Grant   *BreakGlassGrant   `json:"grant"`
+	Details *BreakGlassDetails `json:"details,omitempty"`
+}
+
+// BreakGlassEvent is the payload of the high-severity event emitted when the glass is broken
+type BreakGlassEvent struct {
+	Severity    string `json:"severity"`
+	GrantID     string `json:"grantId"`
+	PatientHash string `json:"patientHash"`
+	GranteeMSP  string `json:"granteeMsp"`
+	ReasonHash  string `json:"reasonHash"`
+	ExpiresAt   int64  `json:"expiresAt"`
+}
+
+// BreakGlassAccess: Grants an emergency-role identity short-lived read access to a patient's health records
+func (s *SmartContract) BreakGlassAccess(ctx contractapi.TransactionContextInterface, patientID, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("a reason is required to break the glass")
+	}
+
+	hasEmergencyAccess, err := callerHasAttribute(ctx, emergencyAccessAttribute)
+	if err != nil {
+		return err
+	}
+	if !hasEmergencyAccess {
+		return accessDenied("break the glass", emergencyAccessAttribute)
+	}
+
+	granteeID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	granteeMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	grant := BreakGlassGrant{
+		GrantID:      ctx.GetStub().GetTxID(),
+		PatientHash:  breakGlassHash(patientID),
+		GranteeID:    granteeID,
+		GranteeMSP:   granteeMSP,
+		ReasonHash:   breakGlassHash(reason),
+		GrantedAt:    now.Unix(),
+		ExpiresAt:    now.Add(breakGlassWindow).Unix(),
+		ReviewStatus: "PendingReview",
+	}
+
+	grantKey, err := ctx.GetStub().CreateCompositeKey("BreakGlassGrant", []string{grant.PatientHash, grant.GrantID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	if err := putBreakGlassGrant(ctx, grantKey, &grant); err != nil {
+		return err
+	}
+	err = putBreakGlassDetails(ctx, &BreakGlassDetails{GrantID: grant.GrantID, PatientID: patientID, Reason: reason})
+	if err != nil {
+		return err
+	}
+
+	emitEvent(ctx, EventBreakGlassAccess, BreakGlassEvent{
+		Severity:    "HIGH",
+		GrantID:     grant.GrantID,
+		PatientHash: grant.PatientHash,
+		GranteeMSP:  grant.GranteeMSP,
+		ReasonHash:  grant.ReasonHash,
+		ExpiresAt:   grant.ExpiresAt,
+	})
+
+	return nil
+}
+
+// ReviewBreakGlassAccess: Allows a provider's clinician or a regulator's auditor to record the mandatory
+// review of an emergency access grant
+func (s *SmartContract) ReviewBreakGlassAccess(ctx contractapi.TransactionContextInterface, patientID, grantID, outcome, notes string) error {
+	if err := authorize(ctx, "review break-glass access", providerClinician, regulatorAuditor); err != nil {
+		return err
+	}
+	if outcome != "Justified" && outcome != "Unjustified" {
+		return fmt.Errorf("review outcome must be Justified or Unjustified, got %s", outcome)
+	}
+
+	grant, grantKey, err := getBreakGlassGrant(ctx, patientID, grantID)
+	if err != nil {
+		return err
+	}
+	if grant.ReviewStatus != "PendingReview" {
+		return fmt.Errorf("break-glass grant %s has already been reviewed", grantID)
+	}
+
+	reviewerID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if reviewerID == grant.GranteeID {
+		return fmt.Errorf("break-glass access cannot be reviewed by the identity that used it")
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	grant.ReviewStatus = outcome
+	grant.ReviewedBy = reviewerID
+	grant.ReviewNotes = notes
+	grant.ReviewedAt = now.Unix()
+
+	// Rewriting a grant recorded before patients were hashed drops its patient ID and reason from the world state
+	return putBreakGlassGrant(ctx, grantKey, grant)
+}
+
+// QueryPendingBreakGlassReviews: Allows a provider's or a regulator's auditor to list the emergency access
+// grants that have not been reviewed yet, with their patients and reasons
+func (s *SmartContract) QueryPendingBreakGlassReviews(ctx contractapi.TransactionContextInterface) ([]*BreakGlassReview, error) {
+	if err := authorize(ctx, "list break-glass access", providerAuditor, regulatorAuditor); err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("BreakGlassGrant", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve break-glass grants: %v", err)
+	}
+	defer iterator.Close()
+
+	var reviews []*BreakGlassReview
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next break-glass grant: %v", err)
+		}
+
+		var grant BreakGlassGrant
+		err = json.Unmarshal(queryResponse.Value, &grant)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal break-glass grant: %v", err)
+		}
+		if grant.ReviewStatus != "PendingReview" {
+			continue
+		}
+
+		details, err := getBreakGlassDetails(ctx, grant.GrantID)
+		if err != nil {
+			return nil, err
+		}
+		if details == nil && grant.PatientHash == "" {
+			// Grants recorded before patients were hashed carry their details in the world state
+			details = &BreakGlassDetails{}
+			err = json.Unmarshal(queryResponse.Value, details)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal break-glass grant: %v", err)
+			}
+		}
+		reviews = append(reviews, &BreakGlassReview{Grant: &grant, Details: details})
+	}
+
+	return reviews, nil
+}
+
+// hasActiveBreakGlassGrant reports whether the caller holds an unexpired emergency grant for the patient
+func hasActiveBreakGlassGrant(ctx contractapi.TransactionContextInterface, patientID string) (bool, error) {
+	callerID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("BreakGlassGrant", []string{breakGlassHash(patientID)})
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve break-glass grants: %v", err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return false, fmt.Errorf("failed to retrieve next break-glass grant: %v", err)
+		}
+
+		var grant BreakGlassGrant
+		err = json.Unmarshal(queryResponse.Value, &grant)
+		if err != nil {
+			return false, fmt.Errorf("failed to unmarshal break-glass grant: %v", err)
+		}
+		if grant.GranteeID == callerID && now.Unix() <= grant.ExpiresAt {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getBreakGlassGrant also finds grants recorded before patients were hashed, which are keyed by the
+// patient ID, and returns the key the grant was found under
+func getBreakGlassGrant(ctx contractapi.TransactionContextInterface, patientID, grantID string) (*BreakGlassGrant, string, error) {
+	for _, patientKey := range []string{breakGlassHash(patientID), patientID} {
+		grantKey, err := ctx.GetStub().CreateCompositeKey("BreakGlassGrant", []string{patientKey, grantID})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create composite key: %v", err)
+		}
+
+		grantJSON, err := ctx.GetStub().GetState(grantKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read break-glass grant: %v", err)
+		}
+		if grantJSON == nil {
+			continue
+		}
+
+		var grant BreakGlassGrant
+		err = json.Unmarshal(grantJSON, &grant)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal break-glass grant: %v", err)
+		}
+		grant.PatientHash = breakGlassHash(patientID)
+
+		return &grant, grantKey, nil
+	}
+
+	return nil, "", fmt.Errorf("break-glass grant %s for patient %s does not exist", grantID, patientID)
+}
+
+func putBreakGlassGrant(ctx contractapi.TransactionContextInterface, grantKey string, grant *BreakGlassGrant) error {
+	grant.DocType = breakGlassGrantDocType
+	grantJSON, err := json.Marshal(grant)
+	if err != nil {
+		return fmt.Errorf("failed to marshal break-glass grant: %v", err)
+	}
+
+	return ctx.GetStub().PutState(grantKey, grantJSON)
+}
+
+// getBreakGlassDetails returns nil for grants whose details this peer's organisation cannot read
+func getBreakGlassDetails(ctx contractapi.TransactionContextInterface, grantID string) (*BreakGlassDetails, error) {
+	detailsKey, err := ctx.GetStub().CreateCompositeKey("BreakGlassDetails", []string{grantID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	detailsJSON, err := ctx.GetStub().GetPrivateData(breakGlassCollection, detailsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read break-glass details: %v", err)
+	}
+	if detailsJSON == nil {
+		return nil, nil
+	}
+
+	var details BreakGlassDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal break-glass details: %v", err)
+	}
+
+	return &details, nil
+}
+
+func putBreakGlassDetails(ctx contractapi.TransactionContextInterface, details *BreakGlassDetails) error {
+	detailsKey, err := ctx.GetStub().CreateCompositeKey("BreakGlassDetails", []string{details.GrantID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal break-glass details: %v", err)
+	}
+
+	return ctx.GetStub().PutPrivateData(breakGlassCollection, detailsKey, detailsJSON)
+}
+
+// breakGlassHash identifies a patient or reason in the world state and events without revealing it
+func breakGlassHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// txTimestamp returns the proposal timestamp, which every endorser agrees on, unlike the local clock
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	return time.Unix(ts.Seconds, int64(ts.Nanos)), nil
+}
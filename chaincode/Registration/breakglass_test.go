@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBreakGlassAccess(t *testing.T) {
+	responder := &fakeIdentity{id: "responder", mspID: "Org4MSP", attrs: map[string]string{emergencyAccessAttribute: "true"}}
+
+	tests := []struct {
+		name    string
+		caller  *fakeIdentity
+		reason  string
+		granted bool
+	}{
+		{"emergency identity with a reason", responder, "unconscious on arrival", true},
+		{"emergency identity without a reason", responder, "", false},
+		{"clinician without the emergency attribute", &fakeIdentity{id: "clinician", mspID: "Org4MSP", attrs: map[string]string{JobClinician: "true"}}, "unconscious on arrival", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newTestContext(t, "registration")
+			ctx.SetClientIdentity(tt.caller)
+
+			err := new(SmartContract).BreakGlassAccess(ctx, "patient1", tt.reason)
+			if !tt.granted {
+				if err == nil {
+					t.Fatal("expected the glass to stay unbroken")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for key, value := range stub.State {
+				if strings.Contains(key+string(value), "patient1") || strings.Contains(string(value), tt.reason) {
+					t.Fatalf("world state key %s reveals the patient or reason", key)
+				}
+			}
+			for patient, active := range map[string]bool{"patient1": true, "patient2": false} {
+				got, err := hasActiveBreakGlassGrant(ctx, patient)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != active {
+					t.Fatalf("expected an active grant for %s to be %v, got %v", patient, active, got)
+				}
+			}
+		})
+	}
+}
+
+func TestReviewBreakGlassAccess(t *testing.T) {
+	responder := &fakeIdentity{id: "responder", mspID: "Org4MSP", attrs: map[string]string{emergencyAccessAttribute: "true", JobClinician: "true"}}
+	reviewer := &fakeIdentity{id: "reviewer", mspID: "Org4MSP", attrs: map[string]string{JobClinician: "true"}}
+	auditor := &fakeIdentity{id: "auditor", mspID: "Org4MSP", attrs: map[string]string{JobAuditor: "true"}}
+
+	ctx, stub := newTestContext(t, "registration")
+	registerTestOrg(t, stub, "Org4MSP", RoleProvider)
+	ctx.SetClientIdentity(responder)
+	if err := new(SmartContract).BreakGlassAccess(ctx, "patient1", "unconscious on arrival"); err != nil {
+		t.Fatal(err)
+	}
+	grantID := stub.GetTxID()
+	nextTransaction(stub, "tx2")
+
+	ctx.SetClientIdentity(auditor)
+	pending, err := new(SmartContract).QueryPendingBreakGlassReviews(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Details == nil || pending[0].Details.PatientID != "patient1" {
+		t.Fatalf("expected the grant pending with its patient, got %+v", pending)
+	}
+
+	ctx.SetClientIdentity(responder)
+	if err := new(SmartContract).ReviewBreakGlassAccess(ctx, "patient1", grantID, "Justified", ""); err == nil {
+		t.Fatal("expected the grantee to be refused the review of their own grant")
+	}
+	ctx.SetClientIdentity(auditor)
+	if err := new(SmartContract).ReviewBreakGlassAccess(ctx, "patient1", grantID, "Justified", ""); !isAccessDenied(err) {
+		t.Fatalf("expected a provider auditor to be denied the review, got %v", err)
+	}
+
+	ctx.SetClientIdentity(reviewer)
+	if err := new(SmartContract).ReviewBreakGlassAccess(ctx, "patient1", grantID, "Justified", "cardiac arrest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := new(SmartContract).ReviewBreakGlassAccess(ctx, "patient1", grantID, "Unjustified", ""); err == nil {
+		t.Fatal("expected a second review to be refused")
+	}
+
+	ctx.SetClientIdentity(auditor)
+	pending, err = new(SmartContract).QueryPendingBreakGlassReviews(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no grants pending after the review, got %d", len(pending))
+	}
+}
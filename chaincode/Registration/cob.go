@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PayerOrder ranks the policies a member is covered by for coordination of benefits. The primary payer
+// settles an episode first and the secondary payer covers what is left of the charges.
+type PayerOrder struct {
+	DocType           string `json:"docType"`
+	SchemaVersion     string `json:"schemaVersion,omitempty"` // Set on responses only
+	UserID            string `json:"userId"`
+	PrimaryPolicyID   string `json:"primaryPolicyId"`
+	SecondaryPolicyID string `json:"secondaryPolicyId,omitempty"` // Empty when the member has a single payer
+	SetBy             string `json:"setBy,omitempty"`             // Empty while the order follows registration order
+	SetAt             int64  `json:"setAt,omitempty"`
+}
+
+// SetPayerOrder: Allows an underwriter to decide which of a member's policies pays first, for example under the
+// birthday rule. Both policies must be active registrations of the member; an empty secondary policy
+// leaves the member with a single payer.
+func (s *SmartContract) SetPayerOrder(ctx contractapi.TransactionContextInterface, userID, primaryPolicyID, secondaryPolicyID string) error {
+	if err := authorize(ctx, "set the payer order", insurerUnderwriter); err != nil {
+		return err
+	}
+	if primaryPolicyID == secondaryPolicyID {
+		return fmt.Errorf("the primary and secondary payer must be different policies")
+	}
+
+	for _, policyID := range []string{primaryPolicyID, secondaryPolicyID} {
+		if policyID == "" {
+			continue
+		}
+		registration, err := s.QueryRegistration(ctx, userID, policyID)
+		if err != nil {
+			return err
+		}
+		if registration.Status == RegistrationCancelled {
+			return fmt.Errorf("registration for user %s and policy %s is cancelled", userID, policyID)
+		}
+	}
+
+	setBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putPayerOrder(ctx, &PayerOrder{
+		UserID:            userID,
+		PrimaryPolicyID:   primaryPolicyID,
+		SecondaryPolicyID: secondaryPolicyID,
+		SetBy:             setBy,
+		SetAt:             now.Unix(),
+	})
+}
+
+// QueryPayerOrder: Returns the payer order of a member, for other chaincodes to consume
+func (s *SmartContract) QueryPayerOrder(ctx contractapi.TransactionContextInterface, userID string) (*PayerOrder, error) {
+	order, err := getPayerOrder(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, fmt.Errorf("no payer order found for user %s", userID)
+	}
+
+	return order, nil
+}
+
+// addToPayerOrder ranks a new registration after the member's existing payers. A member's first policy
+// becomes the primary payer and the second the secondary; later policies are only ranked through SetPayerOrder.
+func addToPayerOrder(ctx contractapi.TransactionContextInterface, userID, policyID string) error {
+	order, err := getPayerOrder(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case order == nil:
+		order = &PayerOrder{UserID: userID, PrimaryPolicyID: policyID}
+	case order.PrimaryPolicyID == policyID || order.SecondaryPolicyID == policyID:
+		return nil
+	case order.SecondaryPolicyID == "":
+		order.SecondaryPolicyID = policyID
+	default:
+		return nil
+	}
+
+	return putPayerOrder(ctx, order)
+}
+
+// dropFromPayerOrder removes a cancelled registration from the payer order, promoting the secondary payer
+func dropFromPayerOrder(ctx contractapi.TransactionContextInterface, userID, policyID string) error {
+	order, err := getPayerOrder(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return nil
+	}
+
+	switch policyID {
+	case order.PrimaryPolicyID:
+		order.PrimaryPolicyID = order.SecondaryPolicyID
+		order.SecondaryPolicyID = ""
+	case order.SecondaryPolicyID:
+		order.SecondaryPolicyID = ""
+	default:
+		return nil
+	}
+
+	return putPayerOrder(ctx, order)
+}
+
+func getPayerOrder(ctx contractapi.TransactionContextInterface, userID string) (*PayerOrder, error) {
+	orderKey, err := ctx.GetStub().CreateCompositeKey("PayerOrder", []string{userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	orderJSON, err := ctx.GetStub().GetState(orderKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payer order: %v", err)
+	}
+	if orderJSON == nil {
+		return nil, nil
+	}
+
+	var order PayerOrder
+	err = json.Unmarshal(orderJSON, &order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payer order: %v", err)
+	}
+	order.SchemaVersion = interopSchemaVersion
+
+	return &order, nil
+}
+
+func putPayerOrder(ctx contractapi.TransactionContextInterface, order *PayerOrder) error {
+	orderKey, err := ctx.GetStub().CreateCompositeKey("PayerOrder", []string{order.UserID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	order.DocType = payerOrderDocType
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payer order: %v", err)
+	}
+
+	return ctx.GetStub().PutState(orderKey, orderJSON)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// CoverageBalance tracks how much of a registration's sum insured has been used
+type CoverageBalance struct {
+	DocType         string  `json:"docType"`
+	UserID          string  `json:"userId"`
+	PolicyID        string  `json:"policyId"`
+	CoverAmount     float64 `json:"coverAmount"`
+	UsedAmount      float64 `json:"usedAmount"`
+	RemainingAmount float64 `json:"remainingAmount"`
+}
+
+// CoverageDebit is the outcome of drawing a claim's settlement against a registration's remaining cover.
+// It is kept per claim, so a claim draws against the cover at most once.
+type CoverageDebit struct {
+	DocType         string  `json:"docType,omitempty"`
+	SchemaVersion   string  `json:"schemaVersion,omitempty"` // Set on responses only
+	ClaimID         string  `json:"claimId"`
+	UserID          string  `json:"userId"`
+	PolicyID        string  `json:"policyId"`
+	RequestedAmount float64 `json:"requestedAmount"`
+	GrantedAmount   float64 `json:"grantedAmount"`
+	RemainingAmount float64 `json:"remainingAmount"`
+}
+
+// QueryCoverageBalance: Returns the used and remaining cover of a registration
+func (s *SmartContract) QueryCoverageBalance(ctx contractapi.TransactionContextInterface, userID, policyID string) (*CoverageBalance, error) {
+	return getCoverageBalance(ctx, userID, policyID)
+}
+
+// ConsumeCoverage: Allows the claims chaincode to draw a claim's settlement against the remaining cover,
+// capped at what is left. The caller must be an adjuster of the policy's insurer, or of the arbitrator
+// settling an overturned appeal, and the call must come through the claims chaincode, which vouches for
+// the claim. A claim draws once: calling again for the same claim returns the first debit unchanged.
+// The balance lives on one key per registration, so two claims for the same member endorsed
+// concurrently fail MVCC validation on commit instead of both spending the same balance. The
+// losing transaction must be resubmitted, at which point it sees the reduced balance. Claims
+// for different members never touch the same key and do not conflict.
+func (s *SmartContract) ConsumeCoverage(ctx contractapi.TransactionContextInterface, userID, policyID, claimID string, requestedAmount float64) (*CoverageDebit, error) {
+	if err := requireClaimsChaincodeCall(ctx, "consume coverage"); err != nil {
+		return nil, err
+	}
+	if claimID == "" {
+		return nil, fmt.Errorf("a claim ID is required")
+	}
+
+	policy, err := s.QueryPolicy(ctx, policyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireSettlingInsurer(ctx, policy); err != nil {
+		return nil, err
+	}
+	if requestedAmount <= 0 {
+		return nil, fmt.Errorf("requested amount must be positive, got %.2f", requestedAmount)
+	}
+
+	debit, err := getCoverageDebit(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+	if debit != nil {
+		if debit.UserID != userID || debit.PolicyID != policyID {
+			return nil, fmt.Errorf("claim %s has already drawn against the cover of user %s under policy %s", claimID, debit.UserID, debit.PolicyID)
+		}
+		debit.SchemaVersion = interopSchemaVersion
+		return debit, nil
+	}
+
+	balance, err := getCoverageBalance(ctx, userID, policyID)
+	if err != nil {
+		return nil, err
+	}
+	if balance.RemainingAmount <= 0 {
+		return nil, fmt.Errorf("cover for user %s under policy %s is exhausted", userID, policyID)
+	}
+
+	granted := math.Min(requestedAmount, balance.RemainingAmount)
+	balance.UsedAmount += granted
+	balance.RemainingAmount -= granted
+
+	err = putCoverageBalance(ctx, balance)
+	if err != nil {
+		return nil, err
+	}
+
+	debit = &CoverageDebit{
+		DocType:         coverageDebitDocType,
+		ClaimID:         claimID,
+		UserID:          userID,
+		PolicyID:        policyID,
+		RequestedAmount: requestedAmount,
+		GrantedAmount:   granted,
+		RemainingAmount: balance.RemainingAmount,
+	}
+	if err := putCoverageDebit(ctx, debit); err != nil {
+		return nil, err
+	}
+	debit.DocType = ""
+	debit.SchemaVersion = interopSchemaVersion
+
+	return debit, nil
+}
+
+// requireSettlingInsurer fails unless the caller is an adjuster of the policy's insurer, or an adjuster of the
+// arbitrator appointed for appeals against that insurer's claims
+func requireSettlingInsurer(ctx contractapi.TransactionContextInterface, policy *Policy) error {
+	action := "consume coverage under policy " + policy.PolicyID
+	insurerMSP, err := policyInsurer(ctx, policy)
+	if err != nil {
+		return err
+	}
+	orgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	arbitrator, err := getArbitrator(ctx, insurerMSP)
+	if err != nil {
+		return err
+	}
+	if arbitrator.MSPID != "" && orgID == arbitrator.MSPID {
+		return authorize(ctx, action, permission{Job: JobAdjuster})
+	}
+
+	if err := authorize(ctx, action, insurerAdjuster); err != nil {
+		return err
+	}
+	if orgID != insurerMSP {
+		return accessDenied(action, insurerMSP)
+	}
+
+	return nil
+}
+
+func getCoverageDebit(ctx contractapi.TransactionContextInterface, claimID string) (*CoverageDebit, error) {
+	debitKey, err := ctx.GetStub().CreateCompositeKey("CoverageDebit", []string{claimID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	debitJSON, err := ctx.GetStub().GetState(debitKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coverage debit: %v", err)
+	}
+	if debitJSON == nil {
+		return nil, nil
+	}
+
+	var debit CoverageDebit
+	err = json.Unmarshal(debitJSON, &debit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal coverage debit: %v", err)
+	}
+
+	return &debit, nil
+}
+
+func putCoverageDebit(ctx contractapi.TransactionContextInterface, debit *CoverageDebit) error {
+	debitKey, err := ctx.GetStub().CreateCompositeKey("CoverageDebit", []string{debit.ClaimID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	debitJSON, err := json.Marshal(debit)
+	if err != nil {
+		return fmt.Errorf("failed to marshal coverage debit: %v", err)
+	}
+
+	return ctx.GetStub().PutState(debitKey, debitJSON)
+}
+
+// getCoverageBalance reads the balance, opening it at the full cover for registrations made before balances were tracked
+func getCoverageBalance(ctx contractapi.TransactionContextInterface, userID, policyID string) (*CoverageBalance, error) {
+	balanceKey, err := ctx.GetStub().CreateCompositeKey("CoverageBalance", []string{userID, policyID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	balanceJSON, err := ctx.GetStub().GetState(balanceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coverage balance: %v", err)
+	}
+	if balanceJSON != nil {
+		var balance CoverageBalance
+		err = json.Unmarshal(balanceJSON, &balance)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal coverage balance: %v", err)
+		}
+		return &balance, nil
+	}
+
+	registrationJSON, err := ctx.GetStub().GetState(fmt.Sprintf("%s-%s", userID, policyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registration from the ledger: %v", err)
+	}
+	if registrationJSON == nil {
+		return nil, fmt.Errorf("registration for user %s and policy %s does not exist", userID, policyID)
+	}
+
+	return newCoverageBalance(ctx, userID, policyID)
+}
+
+// openCoverageBalance starts the balance of a new registration at the full cover amount.
+// An existing balance is kept, so registering again cannot reset used cover.
+func openCoverageBalance(ctx contractapi.TransactionContextInterface, userID string, policy *Policy) error {
+	balanceKey, err := ctx.GetStub().CreateCompositeKey("CoverageBalance", []string{userID, policy.PolicyID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	balanceJSON, err := ctx.GetStub().GetState(balanceKey)
+	if err != nil {
+		return fmt.Errorf("failed to read coverage balance: %v", err)
+	}
+	if balanceJSON != nil {
+		return nil
+	}
+
+	return putCoverageBalance(ctx, &CoverageBalance{
+		UserID:          userID,
+		PolicyID:        policy.PolicyID,
+		CoverAmount:     policy.CoverAmount,
+		RemainingAmount: policy.CoverAmount,
+	})
+}
+
+// newCoverageBalance opens a balance at the policy's full cover amount
+func newCoverageBalance(ctx contractapi.TransactionContextInterface, userID, policyID string) (*CoverageBalance, error) {
+	policyJSON, err := ctx.GetStub().GetState(policyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch policy with ID %s: %v", policyID, err)
+	}
+	if policyJSON == nil {
+		return nil, fmt.Errorf("policy with ID %s not found", policyID)
+	}
+
+	var policy Policy
+	err = json.Unmarshal(policyJSON, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy: %v", err)
+	}
+
+	return &CoverageBalance{
+		UserID:          userID,
+		PolicyID:        policyID,
+		CoverAmount:     policy.CoverAmount,
+		RemainingAmount: policy.CoverAmount,
+	}, nil
+}
+
+func putCoverageBalance(ctx contractapi.TransactionContextInterface, balance *CoverageBalance) error {
+	balanceKey, err := ctx.GetStub().CreateCompositeKey("CoverageBalance", []string{balance.UserID, balance.PolicyID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	balance.DocType = coverageBalanceDocType
+	balanceJSON, err := json.Marshal(balance)
+	if err != nil {
+		return fmt.Errorf("failed to marshal coverage balance: %v", err)
+	}
+
+	return ctx.GetStub().PutState(balanceKey, balanceJSON)
+}
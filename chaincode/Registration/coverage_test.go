@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+)
+
+// newCoverageContext has Org1MSP insure user1 under POL1 for 1000, with Org2MSP another insurer
+func newCoverageContext(t *testing.T, chaincode string, caller *fakeIdentity) (*TransactionContext, *proposedStub) {
+	ctx, stub := newTestContext(t, chaincode)
+	ctx.SetClientIdentity(caller)
+
+	registerTestOrg(t, stub, "Org1MSP", RoleInsurer)
+	registerTestOrg(t, stub, "Org2MSP", RoleInsurer)
+	putTestValue(t, stub, "POL1", &Policy{DocType: policyDocType, PolicyID: "POL1", CoverAmount: 1000, InsurerMSP: "Org1MSP"})
+	putTestValue(t, stub, "user1-POL1", &Registration{DocType: registrationDocType, UserID: "user1", PolicyID: "POL1", Status: RegistrationActive})
+
+	return ctx, stub
+}
+
+func adjusterOf(mspID string) *fakeIdentity {
+	return &fakeIdentity{id: "adjuster@" + mspID, mspID: mspID, attrs: map[string]string{JobAdjuster: "true"}}
+}
+
+func TestConsumeCoverageDrawsOncePerClaim(t *testing.T) {
+	ctx, stub := newCoverageContext(t, claimsChaincode, adjusterOf("Org1MSP"))
+	contract := new(SmartContract)
+
+	debit, err := contract.ConsumeCoverage(ctx, "user1", "POL1", "CLM1", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if debit.GrantedAmount != 600 || debit.RemainingAmount != 400 {
+		t.Fatalf("expected 600 granted and 400 left, got %+v", debit)
+	}
+
+	// A retried draw for the same claim returns the first debit without spending the cover again
+	nextTransaction(stub, "tx2")
+	debit, err = contract.ConsumeCoverage(ctx, "user1", "POL1", "CLM1", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if debit.GrantedAmount != 600 || debit.RemainingAmount != 400 {
+		t.Fatalf("expected the first debit back, got %+v", debit)
+	}
+
+	// Another claim gets what is left, and after that the cover is exhausted
+	nextTransaction(stub, "tx3")
+	debit, err = contract.ConsumeCoverage(ctx, "user1", "POL1", "CLM2", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if debit.GrantedAmount != 400 || debit.RemainingAmount != 0 {
+		t.Fatalf("expected the remaining 400 granted, got %+v", debit)
+	}
+
+	nextTransaction(stub, "tx4")
+	if _, err := contract.ConsumeCoverage(ctx, "user1", "POL1", "CLM3", 100); err == nil {
+		t.Fatal("expected exhausted cover to be refused")
+	}
+
+	balance, err := getCoverageBalance(ctx, "user1", "POL1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.UsedAmount != 1000 || balance.RemainingAmount != 0 {
+		t.Fatalf("expected the cover to be used up, got %+v", balance)
+	}
+}
+
+func TestConsumeCoverageRefusesClaimForAnotherMember(t *testing.T) {
+	ctx, stub := newCoverageContext(t, claimsChaincode, adjusterOf("Org1MSP"))
+	putTestValue(t, stub, "user2-POL1", &Registration{DocType: registrationDocType, UserID: "user2", PolicyID: "POL1", Status: RegistrationActive})
+	contract := new(SmartContract)
+
+	if _, err := contract.ConsumeCoverage(ctx, "user1", "POL1", "CLM1", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	nextTransaction(stub, "tx2")
+	if _, err := contract.ConsumeCoverage(ctx, "user2", "POL1", "CLM1", 100); err == nil {
+		t.Fatal("expected a claim that has drawn for one member to be refused for another")
+	}
+}
+
+func TestConsumeCoverageAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		chaincode  string
+		caller     *fakeIdentity
+		arbitrator string
+		allowed    bool
+	}{
+		{"policy insurer's adjuster through claims", claimsChaincode, adjusterOf("Org1MSP"), "", true},
+		{"called directly", "registration", adjusterOf("Org1MSP"), "", false},
+		{"another insurer's adjuster", claimsChaincode, adjusterOf("Org2MSP"), "", false},
+		{"policy insurer's clinician", claimsChaincode, &fakeIdentity{id: "clinician", mspID: "Org1MSP", attrs: map[string]string{JobClinician: "true"}}, "", false},
+		{"member", claimsChaincode, &fakeIdentity{id: "user1", mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: "user1", JobAdjuster: "true"}}, "", false},
+		{"arbitrator's adjuster", claimsChaincode, adjusterOf("Org3MSP"), "Org3MSP", true},
+		{"arbitrator for another insurer", claimsChaincode, adjusterOf("Org3MSP"), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newCoverageContext(t, tt.chaincode, tt.caller)
+			if tt.arbitrator != "" {
+				putTestState(t, stub, "Config", []string{"arbitrator", "Org1MSP"}, &ArbitratorConfig{InsurerMSP: "Org1MSP", MSPID: tt.arbitrator})
+			}
+
+			_, err := new(SmartContract).ConsumeCoverage(ctx, "user1", "POL1", "CLM1", 100)
+			if tt.allowed && err != nil {
+				t.Fatalf("expected the draw to be allowed, got %v", err)
+			}
+			if !tt.allowed && !isAccessDenied(err) {
+				t.Fatalf("expected an access denial, got %v", err)
+			}
+		})
+	}
+}
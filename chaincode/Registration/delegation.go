@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// userIDAttribute is the certificate attribute carrying the userID of a member acting for themselves or a dependant
+const userIDAttribute = "userId"
+
+// delegationScopes are the actions a guardian or representative can be authorised to take
+var delegationScopes = map[string]bool{
+	"consent":  true,
+	"register": true,
+	"claim":    true,
+}
+
+// Delegation records that a guardian or authorised representative may act for a dependant
+type Delegation struct {
+	DocType      string   `json:"docType"`
+	PatientID    string   `json:"patientId"`
+	DelegateID   string   `json:"delegateId"`
+	Relationship string   `json:"relationship"` // Example: "guardian", "representative"
+	Scopes       []string `json:"scopes"`
+	GrantedBy    string   `json:"grantedBy"`
+	GrantedAt    int64    `json:"grantedAt"`
+	ExpiresAt    int64    `json:"expiresAt,omitempty"` // 0 means the delegation does not expire
+	Revoked      bool     `json:"revoked"`
+}
+
+// GrantDelegation: Allows a patient, or a provider on their behalf, to let a guardian or representative act for them
+func (s *SmartContract) GrantDelegation(ctx contractapi.TransactionContextInterface, patientID, delegateID, relationship, scopesJSON, expiryDate string) error {
+	if patientID == delegateID {
+		return fmt.Errorf("a patient cannot delegate to themselves")
+	}
+	if err := requirePatientOrProvider(ctx, patientID); err != nil {
+		return err
+	}
+
+	var scopes []string
+	err := json.Unmarshal([]byte(scopesJSON), &scopes)
+	if err != nil {
+		return fmt.Errorf("failed to parse scopes JSON: %v", err)
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one delegation scope is required")
+	}
+	for _, scope := range scopes {
+		if !delegationScopes[scope] {
+			return fmt.Errorf("unknown delegation scope %s", scope)
+		}
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt int64
+	if expiryDate != "" {
+		expiry, err := time.Parse("2006-01-02", expiryDate)
+		if err != nil {
+			return fmt.Errorf("failed to parse expiry date %s: %v", expiryDate, err)
+		}
+		// The delegation stays valid until the end of the expiry day
+		expiresAt = expiry.Add(24 * time.Hour).Unix()
+		if expiresAt <= now.Unix() {
+			return fmt.Errorf("expiry date %s is in the past", expiryDate)
+		}
+	}
+
+	grantedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	delegation := Delegation{
+		PatientID:    patientID,
+		DelegateID:   delegateID,
+		Relationship: relationship,
+		Scopes:       scopes,
+		GrantedBy:    grantedBy,
+		GrantedAt:    now.Unix(),
+		ExpiresAt:    expiresAt,
+	}
+
+	emitEvent(ctx, EventDelegationGranted, DelegationEvent{
+		PatientID:  patientID,
+		DelegateID: delegateID,
+		Scopes:     scopes,
+	})
+
+	return putDelegation(ctx, &delegation)
+}
+
+// RevokeDelegation: Allows a patient, or a provider on their behalf, to withdraw a delegation
+func (s *SmartContract) RevokeDelegation(ctx contractapi.TransactionContextInterface, patientID, delegateID string) error {
+	if err := requirePatientOrProvider(ctx, patientID); err != nil {
+		return err
+	}
+
+	delegation, err := getDelegation(ctx, patientID, delegateID)
+	if err != nil {
+		return err
+	}
+	if delegation == nil {
+		return fmt.Errorf("no delegation from %s to %s exists", patientID, delegateID)
+	}
+
+	delegation.Revoked = true
+
+	emitEvent(ctx, EventDelegationRevoked, DelegationEvent{
+		PatientID:  patientID,
+		DelegateID: delegateID,
+		Scopes:     delegation.Scopes,
+	})
+
+	return putDelegation(ctx, delegation)
+}
+
+// QueryDelegations: Lists the delegations granted by a patient to the patient or a provider's clinician, and
+// to any other member only the delegations granted to them
+func (s *SmartContract) QueryDelegations(ctx contractapi.TransactionContextInterface, patientID string) ([]*Delegation, error) {
+	callerID, err := callerUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if callerID == "" {
+		err = authorize(ctx, "list delegations for "+patientID, providerClinician)
+		if isAccessDenied(err) {
+			return nil, accessDenied("list delegations for "+patientID, "being the patient or their delegate", providerClinician.String())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("Delegation", []string{patientID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve delegations: %v", err)
+	}
+	defer iterator.Close()
+
+	var delegations []*Delegation
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next delegation: %v", err)
+		}
+
+		var delegation Delegation
+		err = json.Unmarshal(queryResponse.Value, &delegation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal delegation: %v", err)
+		}
+		if callerID != "" && callerID != patientID && delegation.DelegateID != callerID {
+			continue
+		}
+		delegations = append(delegations, &delegation)
+	}
+
+	return delegations, nil
+}
+
+// VerifyDelegation: Fails unless the caller is the patient's enrolled identity or holds a live delegation with
+// the given scope. The claims chaincode calls this before a member acts for a patient.
+func (s *SmartContract) VerifyDelegation(ctx contractapi.TransactionContextInterface, patientID, scope string) error {
+	return authorizeActingFor(ctx, patientID, scope)
+}
+
+// callerUserID returns the userID carried by the caller's certificate, or "" for org identities. A member
+// must have enrolled, and only the identity that enrolled a userID can act as it.
+func callerUserID(ctx contractapi.TransactionContextInterface) (string, error) {
+	userID, _, err := ctx.GetClientIdentity().GetAttributeValue(userIDAttribute)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client attributes: %v", err)
+	}
+	if userID == "" {
+		return "", nil
+	}
+
+	enrolment, err := getMemberEnrolment(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if enrolment == nil {
+		return "", accessDenied("act as member "+userID, "enrolment through EnrolMember")
+	}
+	identityID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if identityID != enrolment.IdentityID {
+		return "", accessDenied("act as member "+userID, "the identity enrolled for "+userID)
+	}
+
+	return userID, nil
+}
+
+// authorizeActingFor checks the delegation when a member acts for somebody other than themselves. Org
+// identities act for members who have not enrolled, and keep handling claims for those who have.
+func authorizeActingFor(ctx contractapi.TransactionContextInterface, patientID, scope string) error {
+	callerID, err := callerUserID(ctx)
+	if err != nil {
+		return err
+	}
+	if callerID == patientID {
+		return nil
+	}
+	if callerID == "" {
+		if scope == "claim" {
+			return nil
+		}
+		enrolment, err := getMemberEnrolment(ctx, patientID)
+		if err != nil {
+			return err
+		}
+		if enrolment != nil {
+			return accessDenied(scope+" for "+patientID, "the identity enrolled for "+patientID, "a delegation from "+patientID)
+		}
+		return nil
+	}
+
+	delegation, err := getDelegation(ctx, patientID, callerID)
+	if err != nil {
+		return err
+	}
+	if delegation == nil || delegation.Revoked {
+		return accessDenied("act for "+patientID, "a delegation from "+patientID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if delegation.ExpiresAt != 0 && now.Unix() >= delegation.ExpiresAt {
+		return accessDenied("act for "+patientID, "an unexpired delegation from "+patientID)
+	}
+
+	for _, granted := range delegation.Scopes {
+		if granted == scope {
+			return nil
+		}
+	}
+
+	return accessDenied("act for "+patientID, "a delegation covering "+scope)
+}
+
+// requirePatientOrProvider allows the patient themselves, or a provider's clinician who verifies guardianship documents
+func requirePatientOrProvider(ctx contractapi.TransactionContextInterface, patientID string) error {
+	callerID, err := callerUserID(ctx)
+	if err != nil {
+		return err
+	}
+	if callerID == patientID {
+		return nil
+	}
+
+	err = authorize(ctx, "manage delegations for "+patientID, providerClinician)
+	if isAccessDenied(err) {
+		return accessDenied("manage delegations for "+patientID, "being the patient", providerClinician.String())
+	}
+
+	return err
+}
+
+func getDelegation(ctx contractapi.TransactionContextInterface, patientID, delegateID string) (*Delegation, error) {
+	delegationKey, err := ctx.GetStub().CreateCompositeKey("Delegation", []string{patientID, delegateID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	delegationJSON, err := ctx.GetStub().GetState(delegationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delegation: %v", err)
+	}
+	if delegationJSON == nil {
+		return nil, nil
+	}
+
+	var delegation Delegation
+	err = json.Unmarshal(delegationJSON, &delegation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal delegation: %v", err)
+	}
+
+	return &delegation, nil
+}
+
+func putDelegation(ctx contractapi.TransactionContextInterface, delegation *Delegation) error {
+	delegationKey, err := ctx.GetStub().CreateCompositeKey("Delegation", []string{delegation.PatientID, delegation.DelegateID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	delegation.DocType = delegationDocType
+	delegationJSON, err := json.Marshal(delegation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delegation: %v", err)
+	}
+
+	return ctx.GetStub().PutState(delegationKey, delegationJSON)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAuthorizeActingFor(t *testing.T) {
+	member := func(userID, identityID string) *fakeIdentity {
+		return &fakeIdentity{id: identityID, mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: userID}}
+	}
+	org := &fakeIdentity{id: "admin", mspID: "Org1MSP"}
+
+	tests := []struct {
+		name    string
+		caller  *fakeIdentity
+		patient string
+		scope   string
+		allowed bool
+	}{
+		{"enrolled member for themselves", member("child", "child-cert"), "child", "register", true},
+		{"another certificate with the member's userId", member("child", "other-cert"), "child", "register", false},
+		{"member who has not enrolled", member("stranger", "stranger-cert"), "stranger", "claim", false},
+		{"delegate within scope", member("parent", "parent-cert"), "child", "claim", true},
+		{"delegate outside scope", member("parent", "parent-cert"), "child", "consent", false},
+		{"delegate whose delegation expired", member("aunt", "aunt-cert"), "child", "claim", false},
+		{"delegate whose delegation was revoked", member("uncle", "uncle-cert"), "child", "claim", false},
+		{"member without a delegation", member("neighbour", "neighbour-cert"), "child", "claim", false},
+		{"org identity handling a claim", org, "child", "claim", true},
+		{"org identity registering an enrolled member", org, "child", "register", false},
+		{"org identity registering a member who has not enrolled", org, "newborn", "register", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newTestContext(t, "registration")
+			ctx.SetClientIdentity(tt.caller)
+
+			now, err := txTimestamp(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, enrolled := range []string{"child", "parent", "aunt", "uncle", "neighbour"} {
+				putTestState(t, stub, "Member", []string{enrolled}, &MemberEnrolment{DocType: memberDocType, UserID: enrolled, IdentityID: enrolled + "-cert", MSPID: "Org1MSP"})
+			}
+			for _, delegation := range []*Delegation{
+				{PatientID: "child", DelegateID: "parent", Scopes: []string{"claim", "register"}},
+				{PatientID: "child", DelegateID: "aunt", Scopes: []string{"claim"}, ExpiresAt: now.Unix() - 1},
+				{PatientID: "child", DelegateID: "uncle", Scopes: []string{"claim"}, Revoked: true},
+			} {
+				if err := putDelegation(ctx, delegation); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = authorizeActingFor(ctx, tt.patient, tt.scope)
+			if tt.allowed && err != nil {
+				t.Fatalf("expected to act for %s, got %v", tt.patient, err)
+			}
+			if !tt.allowed && !isAccessDenied(err) {
+				t.Fatalf("expected an access denial, got %v", err)
+			}
+		})
+	}
+}
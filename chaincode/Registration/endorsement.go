@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// RotatePolicyEndorsement: Allows an org admin of the insurer of a policy to change the orgs whose peers must
+// all endorse changes to it. The orgs must be registered and include the insurer, and an empty list resets it
+// to the insurer alone. The transaction itself must be endorsed by the policy's current endorsers.
+func (s *SmartContract) RotatePolicyEndorsement(ctx contractapi.TransactionContextInterface, policyID string, endorsersJSON string) error {
+	if err := authorize(ctx, "rotate policy endorsement policies", insurerUnderwriter); err != nil {
+		return err
+	}
+
+	policy, err := s.QueryPolicy(ctx, policyID)
+	if err != nil {
+		return err
+	}
+
+	orgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	insurerMSP, err := policyInsurer(ctx, policy)
+	if err != nil {
+		return err
+	}
+	if orgID != insurerMSP {
+		return accessDenied("rotate the endorsement policy of "+policyID, insurerMSP)
+	}
+	isAdmin, err := callerIsOrgAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return accessDenied("rotate the endorsement policy of "+policyID, "an org admin certificate")
+	}
+
+	endorsers := []string{insurerMSP}
+	if endorsersJSON != "" {
+		var requested []string
+		err = json.Unmarshal([]byte(endorsersJSON), &requested)
+		if err != nil {
+			return fmt.Errorf("failed to parse endorsers JSON: %v", err)
+		}
+		if len(requested) > 0 {
+			endorsers = requested
+		}
+	}
+	if !includesOrg(endorsers, insurerMSP) {
+		return fmt.Errorf("the endorsers of policy %s must include its insurer %s", policyID, insurerMSP)
+	}
+	for _, mspID := range endorsers {
+		org, err := getOrgRecord(ctx, mspID)
+		if err != nil {
+			return err
+		}
+		if org.DocType == "" {
+			return fmt.Errorf("endorser %s is not registered in the organisation registry", mspID)
+		}
+	}
+
+	return setKeyEndorsers(ctx, policyID, endorsers)
+}
+
+// QueryPolicyEndorsement: Lists the orgs that must endorse changes to a policy; an empty list means the
+// chaincode endorsement policy applies
+func (s *SmartContract) QueryPolicyEndorsement(ctx contractapi.TransactionContextInterface, policyID string) ([]string, error) {
+	policy, err := ctx.GetStub().GetStateValidationParameter(policyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read endorsement policy of %s: %v", policyID, err)
+	}
+	if len(policy) == 0 {
+		return []string{}, nil
+	}
+
+	endorsement, err := statebased.NewStateEP(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endorsement policy of %s: %v", policyID, err)
+	}
+
+	return endorsement.ListOrgs(), nil
+}
+
+// setKeyEndorsers requires a peer of every given org to endorse later changes to a world state key
+func setKeyEndorsers(ctx contractapi.TransactionContextInterface, key string, endorsers []string) error {
+	endorsement, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create endorsement policy: %v", err)
+	}
+	err = endorsement.AddOrgs(statebased.RoleTypePeer, endorsers...)
+	if err != nil {
+		return fmt.Errorf("failed to add endorsers to the policy of %s: %v", key, err)
+	}
+	policy, err := endorsement.Policy()
+	if err != nil {
+		return fmt.Errorf("failed to build endorsement policy of %s: %v", key, err)
+	}
+
+	err = ctx.GetStub().SetStateValidationParameter(key, policy)
+	if err != nil {
+		return fmt.Errorf("failed to set endorsement policy of %s: %v", key, err)
+	}
+
+	return nil
+}
+
+// includesOrg tells whether mspID is among the orgs
+func includesOrg(orgs []string, mspID string) bool {
+	for _, org := range orgs {
+		if org == mspID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRotatePolicyEndorsement(t *testing.T) {
+	insurerAdmin := &fakeIdentity{id: "admin1", mspID: "Org1MSP", admin: true}
+
+	tests := []struct {
+		name      string
+		caller    *fakeIdentity
+		endorsers string
+		want      []string // Nil when the rotation is refused
+	}{
+		{"insurer admin adds a registered org", insurerAdmin, `["Org1MSP","Org4MSP"]`, []string{"Org1MSP", "Org4MSP"}},
+		{"insurer admin resets to the insurer", insurerAdmin, "", []string{"Org1MSP"}},
+		{"endorsers without the insurer", insurerAdmin, `["Org4MSP"]`, nil},
+		{"unregistered endorser", insurerAdmin, `["Org1MSP","Org9MSP"]`, nil},
+		{"underwriter without an admin certificate", &fakeIdentity{id: "underwriter1", mspID: "Org1MSP", attrs: map[string]string{JobUnderwriter: "true"}}, "", nil},
+		{"admin of another insurer", &fakeIdentity{id: "admin2", mspID: "Org2MSP", admin: true}, `["Org2MSP"]`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newCoverageContext(t, "registration", tt.caller)
+			registerTestOrg(t, stub, "Org4MSP", RoleProvider)
+
+			err := new(SmartContract).RotatePolicyEndorsement(ctx, "POL1", tt.endorsers)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("expected the rotation to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := new(SmartContract).QueryPolicyEndorsement(ctx, "POL1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected endorsers %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// eventSchemaVersion is the version of the event envelope and payloads documented in the README.
+// It changes only when a field is removed or changes meaning; adding optional fields keeps it.
+const eventSchemaVersion = "1.0"
+
+// Event types emitted by the registration chaincode
+const (
+	EventPolicyDefined         = "PolicyDefined"
+	EventRegistered            = "Registered"
+	EventRegistrationCancelled = "RegistrationCancelled"
+	EventHealthRecordUploaded  = "HealthRecordUploaded"
+	EventDelegationGranted     = "DelegationGranted"
+	EventDelegationRevoked     = "DelegationRevoked"
+	EventBreakGlassAccess      = "BreakGlassAccess"
+	EventOrgRegistered         = "OrgRegistered"
+	EventMemberEnrolled        = "MemberEnrolled"
+)
+
+// EventRecord is one typed change inside an event envelope
+type EventRecord struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// EventEnvelope is the payload of every chaincode event
+type EventEnvelope struct {
+	SchemaVersion string        `json:"schemaVersion"`
+	TxID          string        `json:"txId"`
+	Timestamp     int64         `json:"timestamp"`
+	Events        []EventRecord `json:"events"`
+}
+
+// PolicyDefinedEvent announces a new or redefined policy
+type PolicyDefinedEvent struct {
+	PolicyID    string  `json:"policyId"`
+	PolicyType  string  `json:"policyType"`
+	CoverAmount float64 `json:"coverAmount"`
+	Premium     float64 `json:"premium"`
+	StartDate   string  `json:"startDate"`
+	EndDate     string  `json:"endDate"`
+}
+
+// RegisteredEvent announces a member registering for a policy, or the registration being cancelled.
+// Underwriting answers are left out.
+type RegisteredEvent struct {
+	UserID       string `json:"userId"`
+	PolicyID     string `json:"policyId"`
+	RegisteredBy string `json:"registeredBy,omitempty"`
+}
+
+// HealthRecordUploadedEvent announces that a health record changed without revealing its contents
+type HealthRecordUploadedEvent struct {
+	ID string `json:"id"`
+}
+
+// DelegationEvent announces a delegation being granted or revoked
+type DelegationEvent struct {
+	PatientID  string   `json:"patientId"`
+	DelegateID string   `json:"delegateId"`
+	Scopes     []string `json:"scopes"`
+}
+
+// TransactionContext buffers the events raised during a transaction. Fabric keeps only the last
+// SetEvent call of a transaction, so the events are emitted together once the transaction succeeds.
+type TransactionContext struct {
+	contractapi.TransactionContext
+	events []EventRecord
+}
+
+// emitEvent queues an event to be emitted when the transaction completes
+func emitEvent(ctx contractapi.TransactionContextInterface, eventType string, data interface{}) {
+	if eventCtx, ok := ctx.(*TransactionContext); ok {
+		eventCtx.events = append(eventCtx.events, EventRecord{Type: eventType, Data: data})
+	}
+}
+
+// flushEvents is the contract's AfterTransaction hook. The chaincode event is named after the first
+// event of the transaction and carries all of them in one envelope.
+func flushEvents(ctx contractapi.TransactionContextInterface) error {
+	eventCtx, ok := ctx.(*TransactionContext)
+	if !ok || len(eventCtx.events) == 0 {
+		return nil
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	payload, err := json.Marshal(EventEnvelope{
+		SchemaVersion: eventSchemaVersion,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     timestamp.Seconds,
+		Events:        eventCtx.events,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal chaincode event: %v", err)
+	}
+
+	return ctx.GetStub().SetEvent(eventCtx.events[0].Type, payload)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// fakeIdentity is a client identity with the given ID, MSP, certificate attributes and, for admins, an admin
+// certificate
+type fakeIdentity struct {
+	id    string
+	mspID string
+	attrs map[string]string
+	admin bool
+}
+
+func (f *fakeIdentity) GetID() (string, error)    { return f.id, nil }
+func (f *fakeIdentity) GetMSPID() (string, error) { return f.mspID, nil }
+
+func (f *fakeIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := f.attrs[name]
+	return value, found, nil
+}
+
+func (f *fakeIdentity) AssertAttributeValue(name, value string) error {
+	if f.attrs[name] != value {
+		return errors.New("attribute mismatch")
+	}
+	return nil
+}
+
+func (f *fakeIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	ou := "client"
+	if f.admin {
+		ou = "admin"
+	}
+	return &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{ou}}}, nil
+}
+
+// proposedStub is a MockStub whose transaction proposal names a chaincode, as a proposal sent to it would
+type proposedStub struct {
+	*shimtest.MockStub
+	proposal *peer.SignedProposal
+}
+
+func (s *proposedStub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return s.proposal, nil
+}
+
+// newTestContext starts a transaction proposed to the named chaincode on a fresh ledger
+func newTestContext(t *testing.T, chaincode string) (*TransactionContext, *proposedStub) {
+	t.Helper()
+
+	input, err := proto.Marshal(&peer.ChaincodeInvocationSpec{
+		ChaincodeSpec: &peer.ChaincodeSpec{ChaincodeId: &peer.ChaincodeID{Name: chaincode}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := proto.Marshal(&peer.ChaincodeProposalPayload{Input: input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposal, err := proto.Marshal(&peer.Proposal{Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &proposedStub{
+		MockStub: shimtest.NewMockStub("registration", nil),
+		proposal: &peer.SignedProposal{ProposalBytes: proposal},
+	}
+	stub.MockTransactionStart("tx1")
+
+	ctx := new(TransactionContext)
+	ctx.SetStub(stub)
+	return ctx, stub
+}
+
+// nextTransaction starts another transaction on the same ledger
+func nextTransaction(stub *proposedStub, txID string) {
+	stub.MockTransactionEnd("")
+	stub.MockTransactionStart(txID)
+}
+
+// putTestState writes a record under a composite key
+func putTestState(t *testing.T, stub *proposedStub, objectType string, attributes []string, record interface{}) {
+	t.Helper()
+
+	key, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putTestValue(t, stub, key, record)
+}
+
+// putTestValue writes a record under a plain key
+func putTestValue(t *testing.T, stub *proposedStub, key string, record interface{}) {
+	t.Helper()
+
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stub.PutState(key, recordJSON); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// registerTestOrg records an organisation and its roles in the registry
+func registerTestOrg(t *testing.T, stub *proposedStub, mspID string, roles ...string) {
+	t.Helper()
+	putTestState(t, stub, "Org", []string{mspID}, &OrgRecord{DocType: orgDocType, MSPID: mspID, Name: mspID, Roles: roles})
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// claimsChaincode is the chaincode that files and settles claims. Transactions that spend a member's cover
+// only accept calls made through it.
+const claimsChaincode = "claims"
+
+// interopSchemaVersion versions the responses built for other chaincodes. The major version changes
+// only when a field is removed or changes meaning, so callers accept any response with the same major.
+const interopSchemaVersion = "1.0"
+
+// Reason codes given when a coverage verdict is negative
+const (
+	CoverageNotRegistered       = "NOT_REGISTERED"
+	CoverageRegistrationEnded   = "REGISTRATION_CANCELLED"
+	CoveragePremiumUnpaid       = "PREMIUM_UNPAID"
+	CoverageOutsidePolicyPeriod = "OUTSIDE_POLICY_PERIOD"
+	CoverageBeforeRegistration  = "BEFORE_REGISTRATION"
+	CoverageExhausted           = "COVER_EXHAUSTED"
+)
+
+// CoverageVerdict is the response of VerifyCoverage. ReasonCode and Reason explain a negative verdict.
+type CoverageVerdict struct {
+	SchemaVersion   string  `json:"schemaVersion"`
+	UserID          string  `json:"userId"`
+	PolicyID        string  `json:"policyId"`
+	ServiceDate     string  `json:"serviceDate"`
+	Covered         bool    `json:"covered"`
+	ReasonCode      string  `json:"reasonCode,omitempty"`
+	Reason          string  `json:"reason,omitempty"`
+	RemainingAmount float64 `json:"remainingAmount"`
+}
+
+// PolicyLookup is the response of LookupPolicyForUser
+type PolicyLookup struct {
+	SchemaVersion string  `json:"schemaVersion"`
+	UserID        string  `json:"userId"`
+	PolicyID      string  `json:"policyId"`
+	Policy        *Policy `json:"policy"`
+}
+
+// LookupPolicyForUser: Returns the policy a user is registered for, for other chaincodes to consume.
+// A member covered by several policies gets their primary payer.
+func (s *SmartContract) LookupPolicyForUser(ctx contractapi.TransactionContextInterface, userID string) (*PolicyLookup, error) {
+	order, err := getPayerOrder(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var policyID string
+	if order != nil && order.PrimaryPolicyID != "" {
+		policyID = order.PrimaryPolicyID
+	} else {
+		// Members registered before payer orders were kept have only the user-policy mapping
+		policyID, err = s.QueryPolicyByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	policy, err := s.QueryPolicy(ctx, policyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch policy %s for user %s: %v", policyID, userID, err)
+	}
+
+	return &PolicyLookup{
+		SchemaVersion: interopSchemaVersion,
+		UserID:        userID,
+		PolicyID:      policyID,
+		Policy:        policy,
+	}, nil
+}
+
+// VerifyCoverage: Tells other chaincodes whether a member's registration covers a service on the given date
+// ("2006-01-02"). The registration must exist and be active with the full premium paid, the date must fall
+// inside the policy period and not before the registration, and some cover must remain.
+func (s *SmartContract) VerifyCoverage(ctx contractapi.TransactionContextInterface, userID, policyID, serviceDate string) (*CoverageVerdict, error) {
+	service, err := time.Parse("2006-01-02", serviceDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service date %s: %v", serviceDate, err)
+	}
+
+	verdict := &CoverageVerdict{
+		SchemaVersion: interopSchemaVersion,
+		UserID:        userID,
+		PolicyID:      policyID,
+		ServiceDate:   serviceDate,
+	}
+	deny := func(code, reason string) (*CoverageVerdict, error) {
+		verdict.ReasonCode = code
+		verdict.Reason = reason
+		return verdict, nil
+	}
+
+	registrationJSON, err := ctx.GetStub().GetState(fmt.Sprintf("%s-%s", userID, policyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registration from the ledger: %v", err)
+	}
+	if registrationJSON == nil {
+		return deny(CoverageNotRegistered, fmt.Sprintf("user %s is not registered for policy %s", userID, policyID))
+	}
+	var registration Registration
+	err = json.Unmarshal(registrationJSON, &registration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize registration data: %v", err)
+	}
+	if registration.Status == RegistrationCancelled {
+		return deny(CoverageRegistrationEnded, fmt.Sprintf("registration for policy %s was cancelled", policyID))
+	}
+
+	policy, err := s.QueryPolicy(ctx, policyID)
+	if err != nil {
+		return nil, err
+	}
+	if registration.PremiumPaid < policy.Premium {
+		return deny(CoveragePremiumUnpaid, fmt.Sprintf("premium paid %.2f is below the required premium %.2f", registration.PremiumPaid, policy.Premium))
+	}
+
+	start, err := time.Parse("2006-01-02", policy.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse start date of policy %s: %v", policyID, err)
+	}
+	end, err := time.Parse("2006-01-02", policy.EndDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse end date of policy %s: %v", policyID, err)
+	}
+	if service.Before(start) || service.After(end) {
+		return deny(CoverageOutsidePolicyPeriod, fmt.Sprintf("service date %s is outside the policy period %s to %s", serviceDate, policy.StartDate, policy.EndDate))
+	}
+
+	// Cover starts on the day of registration; registrations made before the date was kept are not checked
+	if registration.RegisteredAt != 0 {
+		registeredOn := time.Unix(registration.RegisteredAt, 0).UTC().Truncate(24 * time.Hour)
+		if service.Before(registeredOn) {
+			return deny(CoverageBeforeRegistration, fmt.Sprintf("service date %s is before the registration on %s", serviceDate, registeredOn.Format("2006-01-02")))
+		}
+	}
+
+	balance, err := getCoverageBalance(ctx, userID, policyID)
+	if err != nil {
+		return nil, err
+	}
+	verdict.RemainingAmount = balance.RemainingAmount
+	if balance.RemainingAmount <= 0 {
+		return deny(CoverageExhausted, fmt.Sprintf("cover under policy %s is exhausted", policyID))
+	}
+
+	verdict.Covered = true
+	return verdict, nil
+}
+
+// requireClaimsChaincodeCall fails unless the transaction was proposed to the claims chaincode, which then
+// called this one. A chaincode called by another sees the original proposal, naming the outer chaincode.
+func requireClaimsChaincodeCall(ctx contractapi.TransactionContextInterface, action string) error {
+	name, err := proposedChaincode(ctx)
+	if err != nil {
+		return err
+	}
+	if name != claimsChaincode {
+		return accessDenied(action, "a call through the "+claimsChaincode+" chaincode")
+	}
+
+	return nil
+}
+
+// proposedChaincode returns the name of the chaincode the transaction proposal was sent to
+func proposedChaincode(ctx contractapi.TransactionContextInterface) (string, error) {
+	signedProposal, err := ctx.GetStub().GetSignedProposal()
+	if err != nil {
+		return "", fmt.Errorf("failed to read signed proposal: %v", err)
+	}
+	if signedProposal == nil {
+		return "", nil
+	}
+
+	var proposal peer.Proposal
+	if err := proto.Unmarshal(signedProposal.ProposalBytes, &proposal); err != nil {
+		return "", fmt.Errorf("failed to unmarshal proposal: %v", err)
+	}
+	var payload peer.ChaincodeProposalPayload
+	if err := proto.Unmarshal(proposal.Payload, &payload); err != nil {
+		return "", fmt.Errorf("failed to unmarshal proposal payload: %v", err)
+	}
+	var invocation peer.ChaincodeInvocationSpec
+	if err := proto.Unmarshal(payload.Input, &invocation); err != nil {
+		return "", fmt.Errorf("failed to unmarshal chaincode invocation: %v", err)
+	}
+
+	return invocation.GetChaincodeSpec().GetChaincodeId().GetName(), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyCoverage(t *testing.T) {
+	registeredAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).Unix()
+	active := &Registration{DocType: registrationDocType, UserID: "user1", PolicyID: "POL1", PremiumPaid: 100, RegisteredAt: registeredAt, Status: RegistrationActive}
+
+	tests := []struct {
+		name         string
+		registration *Registration // Nil when user1 is not registered
+		exhausted    bool          // Whether user1's cover has been used up
+		serviceDate  string
+		want         string // Reason code, or "" when covered
+	}{
+		{"active registration", active, false, "2024-06-01", ""},
+		{"service on the day of registration", active, false, "2024-03-01", ""},
+		{"not registered", nil, false, "2024-06-01", CoverageNotRegistered},
+		{"cancelled registration", &Registration{DocType: registrationDocType, UserID: "user1", PolicyID: "POL1", PremiumPaid: 100, Status: RegistrationCancelled}, false, "2024-06-01", CoverageRegistrationEnded},
+		{"premium unpaid", &Registration{DocType: registrationDocType, UserID: "user1", PolicyID: "POL1", PremiumPaid: 50, Status: RegistrationActive}, false, "2024-06-01", CoveragePremiumUnpaid},
+		{"outside the policy period", active, false, "2025-02-01", CoverageOutsidePolicyPeriod},
+		{"before the registration", active, false, "2024-02-28", CoverageBeforeRegistration},
+		{"cover used up", active, true, "2024-06-01", CoverageExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newTestContext(t, "claims")
+			putTestValue(t, stub, "POL1", &Policy{DocType: policyDocType, PolicyID: "POL1", CoverAmount: 1000, Premium: 100, StartDate: "2024-01-01", EndDate: "2024-12-31"})
+			if tt.registration != nil {
+				putTestValue(t, stub, "user1-POL1", tt.registration)
+			}
+			if tt.exhausted {
+				putTestState(t, stub, "CoverageBalance", []string{"user1", "POL1"}, &CoverageBalance{UserID: "user1", PolicyID: "POL1", CoverAmount: 1000, UsedAmount: 1000})
+			}
+
+			verdict, err := new(SmartContract).VerifyCoverage(ctx, "user1", "POL1", tt.serviceDate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verdict.Covered != (tt.want == "") || verdict.ReasonCode != tt.want {
+				t.Fatalf("expected reason code %q, got covered %v with %q", tt.want, verdict.Covered, verdict.ReasonCode)
+			}
+		})
+	}
+}
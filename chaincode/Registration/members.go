@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// MemberEnrolment binds a userID to the certificate identity of the member who enrolled it. From then on
+// only that identity acts as the member, and org identities can no longer register or consent for them.
+type MemberEnrolment struct {
+	DocType    string `json:"docType"`
+	UserID     string `json:"userId"`
+	IdentityID string `json:"identityId"` // cid.GetID() of the enrolled certificate
+	MSPID      string `json:"mspId"`
+	EnrolledAt int64  `json:"enrolledAt"`
+}
+
+// MemberEnrolledEvent announces a member binding their userID to their own identity
+type MemberEnrolledEvent struct {
+	UserID string `json:"userId"`
+	MSPID  string `json:"mspId"`
+}
+
+// EnrolMember: Binds the caller's certificate to the userID in its userId attribute. Each userID can be
+// enrolled once; a certificate reissued with the same subject and issuer keeps the same identity.
+func (s *SmartContract) EnrolMember(ctx contractapi.TransactionContextInterface, userID string) error {
+	attributeID, _, err := ctx.GetClientIdentity().GetAttributeValue(userIDAttribute)
+	if err != nil {
+		return fmt.Errorf("failed to read client attributes: %v", err)
+	}
+	if userID == "" || attributeID != userID {
+		return accessDenied("enrol as "+userID, userIDAttribute+" "+userID)
+	}
+
+	identityID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	existing, err := getMemberEnrolment(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if existing.IdentityID != identityID {
+			return accessDenied("enrol as "+userID, "the identity already enrolled for "+userID)
+		}
+		return fmt.Errorf("member %s is already enrolled", userID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	enrolment := MemberEnrolment{
+		DocType:    memberDocType,
+		UserID:     userID,
+		IdentityID: identityID,
+		MSPID:      mspID,
+		EnrolledAt: now.Unix(),
+	}
+	enrolmentJSON, err := json.Marshal(enrolment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal member enrolment: %v", err)
+	}
+
+	enrolmentKey, err := ctx.GetStub().CreateCompositeKey("Member", []string{userID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	emitEvent(ctx, EventMemberEnrolled, MemberEnrolledEvent{UserID: userID, MSPID: mspID})
+
+	return ctx.GetStub().PutState(enrolmentKey, enrolmentJSON)
+}
+
+// QueryMemberEnrolment: Returns the enrolment of a member to the member themselves, an underwriter or a clinician
+func (s *SmartContract) QueryMemberEnrolment(ctx contractapi.TransactionContextInterface, userID string) (*MemberEnrolment, error) {
+	callerID, err := callerUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if callerID != userID {
+		if err := authorize(ctx, "query the enrolment of "+userID, insurerUnderwriter, providerClinician); err != nil {
+			return nil, err
+		}
+	}
+
+	enrolment, err := getMemberEnrolment(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrolment == nil {
+		return nil, fmt.Errorf("member %s has not enrolled", userID)
+	}
+
+	return enrolment, nil
+}
+
+func getMemberEnrolment(ctx contractapi.TransactionContextInterface, userID string) (*MemberEnrolment, error) {
+	enrolmentKey, err := ctx.GetStub().CreateCompositeKey("Member", []string{userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	enrolmentJSON, err := ctx.GetStub().GetState(enrolmentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read member enrolment: %v", err)
+	}
+	if enrolmentJSON == nil {
+		return nil, nil
+	}
+
+	var enrolment MemberEnrolment
+	err = json.Unmarshal(enrolmentJSON, &enrolment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal member enrolment: %v", err)
+	}
+
+	return &enrolment, nil
+}
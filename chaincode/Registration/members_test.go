@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEnrolMember(t *testing.T) {
+	member := func(userID, identityID string) *fakeIdentity {
+		return &fakeIdentity{id: identityID, mspID: "Org1MSP", attrs: map[string]string{userIDAttribute: userID}}
+	}
+
+	tests := []struct {
+		name     string
+		first    *fakeIdentity // Enrols user1 first, when set
+		caller   *fakeIdentity
+		enrolled bool
+	}{
+		{"member with their userId", nil, member("user1", "user1-cert"), true},
+		{"certificate with another userId", nil, member("user2", "user2-cert"), false},
+		{"org identity", nil, &fakeIdentity{id: "admin", mspID: "Org1MSP", admin: true}, false},
+		{"second certificate with the same userId", member("user1", "user1-cert"), member("user1", "other-cert"), false},
+		{"same certificate again", member("user1", "user1-cert"), member("user1", "user1-cert"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newTestContext(t, "registration")
+			if tt.first != nil {
+				ctx.SetClientIdentity(tt.first)
+				if err := new(SmartContract).EnrolMember(ctx, "user1"); err != nil {
+					t.Fatal(err)
+				}
+				nextTransaction(stub, "tx2")
+			}
+			ctx.SetClientIdentity(tt.caller)
+
+			err := new(SmartContract).EnrolMember(ctx, "user1")
+			if !tt.enrolled {
+				if err == nil {
+					t.Fatal("expected the enrolment to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			enrolment, err := new(SmartContract).QueryMemberEnrolment(ctx, "user1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if enrolment.IdentityID != tt.caller.id {
+				t.Fatalf("expected user1 bound to %s, got %s", tt.caller.id, enrolment.IdentityID)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"insurance/internal/authz"
+)
+
+// Roles an organisation can hold on the network, as defined by the shared authorisation package
+const (
+	RoleProvider      = authz.RoleProvider
+	RoleInsurer       = authz.RoleInsurer
+	RoleRegulator     = authz.RoleRegulator
+	RoleBroker        = authz.RoleBroker
+	RoleReinsurer     = authz.RoleReinsurer
+	RoleRegistryAdmin = authz.RoleRegistryAdmin
+)
+
+// knownRoles are the roles RegisterOrg accepts
+var knownRoles = map[string]bool{
+	RoleProvider:      true,
+	RoleInsurer:       true,
+	RoleRegulator:     true,
+	RoleBroker:        true,
+	RoleReinsurer:     true,
+	RoleRegistryAdmin: true,
+}
+
+// OrgRegistryContract maps organisations to the roles they act in. Every contract method checks roles
+// from here instead of comparing MSP IDs, so organisations join or change roles without a code change.
+type OrgRegistryContract struct {
+	contractapi.Contract
+}
+
+// OrgRecord is the registry entry of one organisation
+type OrgRecord struct {
+	DocType       string   `json:"docType"`
+	SchemaVersion string   `json:"schemaVersion,omitempty"` // Set on responses only
+	MSPID         string   `json:"mspId"`
+	Name          string   `json:"name"`
+	Roles         []string `json:"roles"`
+	UpdatedBy     string   `json:"updatedBy,omitempty"`
+	UpdatedAt     int64    `json:"updatedAt,omitempty"`
+}
+
+// RegistrySeed is the founding content of the registry, passed once to InitRegistry
+type RegistrySeed struct {
+	Orgs              []OrgRecord `json:"orgs"`
+	LegacyInsurerMSP  string      `json:"legacyInsurerMsp,omitempty"`
+	LegacyProviderMSP string      `json:"legacyProviderMsp,omitempty"`
+}
+
+// RegistryDefaults names the organisations that own records written before records named their owner
+type RegistryDefaults struct {
+	DocType           string `json:"docType"`
+	SchemaVersion     string `json:"schemaVersion,omitempty"` // Set on responses only
+	LegacyInsurerMSP  string `json:"legacyInsurerMsp,omitempty"`
+	LegacyProviderMSP string `json:"legacyProviderMsp,omitempty"`
+}
+
+// OrgRegisteredEvent announces an organisation joining the registry or its roles changing
+type OrgRegisteredEvent struct {
+	MSPID string   `json:"mspId"`
+	Roles []string `json:"roles"`
+}
+
+// InitRegistry: Seeds the registry with the founding organisations and the owners of legacy records. It is
+// run once, straight after the chaincode is deployed, by an org admin of one of the seeded registry admins,
+// and fails once the registry holds anything.
+func (c *OrgRegistryContract) InitRegistry(ctx contractapi.TransactionContextInterface, seedJSON string) error {
+	var seed RegistrySeed
+	err := json.Unmarshal([]byte(seedJSON), &seed)
+	if err != nil {
+		return fmt.Errorf("failed to parse registry seed JSON: %v", err)
+	}
+
+	existing, err := c.QueryAllOrgs(ctx)
+	if err != nil {
+		return err
+	}
+	defaults, err := getRegistryDefaults(ctx)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 || defaults.DocType != "" {
+		return fmt.Errorf("the organisation registry has already been initialised")
+	}
+
+	callerMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	isAdmin, err := callerIsOrgAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	seeded := make(map[string][]string)
+	for _, org := range seed.Orgs {
+		if _, ok := seeded[org.MSPID]; ok {
+			return fmt.Errorf("organisation %s is seeded twice", org.MSPID)
+		}
+		seeded[org.MSPID] = org.Roles
+	}
+	if !isAdmin || !authz.ContainsRole(seeded[callerMSP], RoleRegistryAdmin) {
+		return accessDenied("initialise the organisation registry", "an org admin of a seeded "+RoleRegistryAdmin)
+	}
+	if seed.LegacyInsurerMSP != "" && !authz.ContainsRole(seeded[seed.LegacyInsurerMSP], RoleInsurer) {
+		return fmt.Errorf("legacy insurer %s must be seeded as an %s", seed.LegacyInsurerMSP, RoleInsurer)
+	}
+	if seed.LegacyProviderMSP != "" && !authz.ContainsRole(seeded[seed.LegacyProviderMSP], RoleProvider) {
+		return fmt.Errorf("legacy provider %s must be seeded as a %s", seed.LegacyProviderMSP, RoleProvider)
+	}
+
+	for _, org := range seed.Orgs {
+		if err := putOrgRecord(ctx, org.MSPID, org.Name, org.Roles); err != nil {
+			return err
+		}
+	}
+
+	defaultsJSON, err := json.Marshal(RegistryDefaults{
+		DocType:           configDocType,
+		LegacyInsurerMSP:  seed.LegacyInsurerMSP,
+		LegacyProviderMSP: seed.LegacyProviderMSP,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal registry defaults: %v", err)
+	}
+	defaultsKey, err := ctx.GetStub().CreateCompositeKey("Config", []string{"registryDefaults"})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(defaultsKey, defaultsJSON)
+}
+
+// RegisterOrg: Allows a registry admin to add an organisation or replace its roles. An empty role list
+// leaves the organisation registered without any role.
+func (c *OrgRegistryContract) RegisterOrg(ctx contractapi.TransactionContextInterface, mspID, name, rolesJSON string) error {
+	if err := authorize(ctx, "maintain the organisation registry", registryAdmin); err != nil {
+		return err
+	}
+
+	var roles []string
+	err := json.Unmarshal([]byte(rolesJSON), &roles)
+	if err != nil {
+		return fmt.Errorf("failed to parse roles JSON: %v", err)
+	}
+
+	// An admin cannot lock its own organisation out of the registry
+	callerMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if mspID == callerMSP && !authz.ContainsRole(roles, RoleRegistryAdmin) {
+		return fmt.Errorf("an organisation cannot remove its own %s role", RoleRegistryAdmin)
+	}
+
+	return putOrgRecord(ctx, mspID, name, roles)
+}
+
+// putOrgRecord validates and stores the registry entry of an organisation
+func putOrgRecord(ctx contractapi.TransactionContextInterface, mspID, name string, roles []string) error {
+	if mspID == "" {
+		return fmt.Errorf("an MSP ID is required")
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	for _, role := range roles {
+		if !knownRoles[role] {
+			return fmt.Errorf("unknown role %s", role)
+		}
+	}
+
+	updatedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	record := OrgRecord{
+		DocType:   orgDocType,
+		MSPID:     mspID,
+		Name:      name,
+		Roles:     roles,
+		UpdatedBy: updatedBy,
+		UpdatedAt: now.Unix(),
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal organisation record: %v", err)
+	}
+
+	recordKey, err := ctx.GetStub().CreateCompositeKey("Org", []string{mspID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	emitEvent(ctx, EventOrgRegistered, OrgRegisteredEvent{MSPID: mspID, Roles: roles})
+
+	return ctx.GetStub().PutState(recordKey, recordJSON)
+}
+
+// QueryOrg: Returns the registry entry of an organisation, for clients and other chaincodes to consume.
+// Organisations that were never registered have no roles.
+func (c *OrgRegistryContract) QueryOrg(ctx contractapi.TransactionContextInterface, mspID string) (*OrgRecord, error) {
+	record, err := getOrgRecord(ctx, mspID)
+	if err != nil {
+		return nil, err
+	}
+	record.SchemaVersion = interopSchemaVersion
+
+	return record, nil
+}
+
+// QueryAllOrgs: Lists every organisation registered on the ledger
+func (c *OrgRegistryContract) QueryAllOrgs(ctx contractapi.TransactionContextInterface) ([]*OrgRecord, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("Org", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve organisations: %v", err)
+	}
+	defer iterator.Close()
+
+	records := []*OrgRecord{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next organisation: %v", err)
+		}
+
+		var record OrgRecord
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal organisation record: %v", err)
+		}
+		records = append(records, &record)
+	}
+
+	return records, nil
+}
+
+// QueryRegistryDefaults: Returns the owners of legacy records, for clients and other chaincodes to consume
+func (c *OrgRegistryContract) QueryRegistryDefaults(ctx contractapi.TransactionContextInterface) (*RegistryDefaults, error) {
+	defaults, err := getRegistryDefaults(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defaults.SchemaVersion = interopSchemaVersion
+
+	return defaults, nil
+}
+
+// getRegistryDefaults reads the owners of legacy records; before InitRegistry there are none
+func getRegistryDefaults(ctx contractapi.TransactionContextInterface) (*RegistryDefaults, error) {
+	defaultsKey, err := ctx.GetStub().CreateCompositeKey("Config", []string{"registryDefaults"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	defaultsJSON, err := ctx.GetStub().GetState(defaultsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry defaults: %v", err)
+	}
+	if defaultsJSON == nil {
+		return &RegistryDefaults{}, nil
+	}
+
+	var defaults RegistryDefaults
+	err = json.Unmarshal(defaultsJSON, &defaults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal registry defaults: %v", err)
+	}
+
+	return &defaults, nil
+}
+
+// policyInsurer returns the MSP of the insurer that defined a policy, or the legacy insurer for policies
+// defined before policies recorded their insurer
+func policyInsurer(ctx contractapi.TransactionContextInterface, policy *Policy) (string, error) {
+	if policy.InsurerMSP != "" {
+		return policy.InsurerMSP, nil
+	}
+
+	defaults, err := getRegistryDefaults(ctx)
+	if err != nil {
+		return "", err
+	}
+	if defaults.LegacyInsurerMSP == "" {
+		return "", fmt.Errorf("policy %s records no insurer and the registry names no legacy insurer", policy.PolicyID)
+	}
+
+	return defaults.LegacyInsurerMSP, nil
+}
+
+// getOrgRecord reads an organisation's registry entry; organisations never registered have no roles
+func getOrgRecord(ctx contractapi.TransactionContextInterface, mspID string) (*OrgRecord, error) {
+	recordKey, err := ctx.GetStub().CreateCompositeKey("Org", []string{mspID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	recordJSON, err := ctx.GetStub().GetState(recordKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read organisation record: %v", err)
+	}
+	if recordJSON == nil {
+		return &OrgRecord{MSPID: mspID, Roles: []string{}}, nil
+	}
+
+	var record OrgRecord
+	err = json.Unmarshal(recordJSON, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal organisation record: %v", err)
+	}
+
+	return &record, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInitRegistry(t *testing.T) {
+	seed := `{"orgs":[{"mspId":"Org1MSP","roles":["insurer","registryAdmin"]},{"mspId":"Org4MSP","roles":["provider"]}],"legacyInsurerMsp":"Org1MSP"}`
+
+	tests := []struct {
+		name   string
+		caller *fakeIdentity
+		seed   string
+		seeded bool
+	}{
+		{"admin of a seeded registry admin", &fakeIdentity{id: "admin1", mspID: "Org1MSP", admin: true}, seed, true},
+		{"other identity of a seeded registry admin", &fakeIdentity{id: "adjuster1", mspID: "Org1MSP", attrs: map[string]string{JobAdjuster: "true"}}, seed, false},
+		{"admin of an org seeded without the registry admin role", &fakeIdentity{id: "admin4", mspID: "Org4MSP", admin: true}, seed, false},
+		{"legacy insurer that is not an insurer", &fakeIdentity{id: "admin1", mspID: "Org1MSP", admin: true}, `{"orgs":[{"mspId":"Org1MSP","roles":["registryAdmin"]}],"legacyInsurerMsp":"Org1MSP"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newTestContext(t, "registration")
+			ctx.SetClientIdentity(tt.caller)
+
+			err := new(OrgRegistryContract).InitRegistry(ctx, tt.seed)
+			if !tt.seeded {
+				if err == nil {
+					t.Fatal("expected the seed to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			record, err := new(OrgRegistryContract).QueryOrg(ctx, "Org4MSP")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(record.Roles) != 1 || record.Roles[0] != RoleProvider {
+				t.Fatalf("expected Org4MSP seeded as a provider, got %v", record.Roles)
+			}
+			defaults, err := new(OrgRegistryContract).QueryRegistryDefaults(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if defaults.LegacyInsurerMSP != "Org1MSP" {
+				t.Fatalf("expected Org1MSP as the legacy insurer, got %q", defaults.LegacyInsurerMSP)
+			}
+
+			nextTransaction(stub, "tx2")
+			if err := new(OrgRegistryContract).InitRegistry(ctx, tt.seed); err == nil {
+				t.Fatal("expected a second seed to be refused")
+			}
+		})
+	}
+}
+
+func TestRegisterOrg(t *testing.T) {
+	registryAdmin := &fakeIdentity{id: "admin1", mspID: "Org1MSP", admin: true}
+
+	tests := []struct {
+		name       string
+		caller     *fakeIdentity
+		mspID      string
+		roles      string
+		registered bool
+	}{
+		{"registry admin adds a provider", registryAdmin, "Org5MSP", `["provider"]`, true},
+		{"registry admin changes its own roles", registryAdmin, "Org1MSP", `["insurer","registryAdmin"]`, true},
+		{"registry admin drops its own registry admin role", registryAdmin, "Org1MSP", `["insurer"]`, false},
+		{"unknown role", registryAdmin, "Org5MSP", `["hospital"]`, false},
+		{"admin of an org without the registry admin role", &fakeIdentity{id: "admin4", mspID: "Org4MSP", admin: true}, "Org5MSP", `["provider"]`, false},
+		{"registry admin's identity without an admin certificate", &fakeIdentity{id: "adjuster1", mspID: "Org1MSP", attrs: map[string]string{JobAdjuster: "true"}}, "Org5MSP", `["provider"]`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stub := newTestContext(t, "registration")
+			registerTestOrg(t, stub, "Org1MSP", RoleInsurer, RoleRegistryAdmin)
+			registerTestOrg(t, stub, "Org4MSP", RoleProvider)
+			ctx.SetClientIdentity(tt.caller)
+
+			err := new(OrgRegistryContract).RegisterOrg(ctx, tt.mspID, tt.mspID, tt.roles)
+			if !tt.registered {
+				if err == nil {
+					t.Fatal("expected the registration to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			record, err := new(OrgRegistryContract).QueryOrg(ctx, tt.mspID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.DocType != orgDocType {
+				t.Fatalf("expected %s in the registry", tt.mspID)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Document types stored in the docType field of every record, matched by rich queries and CouchDB indexes
+const (
+	policyDocType          = "policy"
+	registrationDocType    = "registration"
+	healthRecordDocType    = "healthRecord"
+	coverageBalanceDocType = "coverageBalance"
+	coverageDebitDocType   = "coverageDebit"
+	delegationDocType      = "delegation"
+	breakGlassGrantDocType = "breakGlassGrant"
+	configDocType          = "config"
+	premiumDeltaDocType    = "premiumDelta"
+	payerOrderDocType      = "payerOrder"
+	orgDocType             = "org"
+	memberDocType          = "member"
+)
+
+// QueryPoliciesByTypeAndPremium: Returns the policies of a type whose premium lies between minPremium and
+// maxPremium inclusive. An empty policy type matches every type and a zero maxPremium leaves the range open.
+// Rich queries need CouchDB as the state database.
+func (s *SmartContract) QueryPoliciesByTypeAndPremium(ctx contractapi.TransactionContextInterface, policyType string, minPremium, maxPremium float64) ([]*Policy, error) {
+	if minPremium < 0 {
+		return nil, fmt.Errorf("minimum premium cannot be negative, got %.2f", minPremium)
+	}
+	if maxPremium != 0 && maxPremium < minPremium {
+		return nil, fmt.Errorf("maximum premium %.2f is below the minimum premium %.2f", maxPremium, minPremium)
+	}
+
+	premium := map[string]interface{}{"$gte": minPremium}
+	if maxPremium != 0 {
+		premium["$lte"] = maxPremium
+	}
+	selector := map[string]interface{}{
+		"docType": policyDocType,
+		"premium": premium,
+	}
+	if policyType != "" {
+		selector["policyType"] = policyType
+	}
+
+	// Marshalling the selector keeps caller input as JSON values, so it cannot change the query
+	queryJSON, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build policy query: %v", err)
+	}
+
+	iterator, err := ctx.GetStub().GetQueryResult(string(queryJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query policies: %v", err)
+	}
+	defer iterator.Close()
+
+	policies := []*Policy{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve next policy: %v", err)
+		}
+
+		var policy Policy
+		err = json.Unmarshal(queryResponse.Value, &policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal policy JSON: %v", err)
+		}
+		policies = append(policies, &policy)
+	}
+
+	return policies, nil
+}
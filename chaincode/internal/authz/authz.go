@@ -0,0 +1,210 @@
+// Package authz is the access check shared by the registration and claims chaincodes. A caller is allowed
+// an action when its organisation holds the role the organisation registry gives it and the caller holds
+// the job role its certificate attributes give it. Each chaincode supplies how it learns the caller's
+// organisation roles and member userID through a Checker.
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Roles an organisation can hold on the network, as recorded by the organisation registry
+const (
+	RoleProvider      = "provider"      // Hospitals, which hold health records and file claims
+	RoleInsurer       = "insurer"       // Insurers, which define policies and settle claims
+	RoleRegulator     = "regulator"     // Regulators, which review emergency access
+	RoleBroker        = "broker"        // Brokers, which sell policies on behalf of insurers
+	RoleReinsurer     = "reinsurer"     // Reinsurers, which take on part of an insurer's risk
+	RoleRegistryAdmin = "registryAdmin" // Organisations allowed to maintain the registry itself
+)
+
+// Job roles an identity holds within its organisation. Each is a certificate attribute set to "true" by
+// the organisation's CA, for example `fabric-ca-client register --id.attrs 'adjuster=true:ecert'`.
+// Members are the exception: they are identified by the userId attribute.
+const (
+	JobUnderwriter = "underwriter" // Defines policies and manages registrations
+	JobAdjuster    = "adjuster"    // Adjudicates, approves and pays claims
+	JobClinician   = "clinician"   // Records and reads the clinical record
+	JobAuditor     = "auditor"     // Reads analytics and reviews access
+	JobMember      = "member"      // Acts for themselves or, under a delegation, a dependant
+	JobOrgAdmin    = "orgAdmin"    // Maintains the network's configuration; held only through an org admin certificate
+)
+
+// adminOU is the organisational unit Fabric puts in org admin certificates. Admins hold every job role of
+// their organisation, so an organisation whose identities carry no job attributes keeps working.
+const adminOU = "admin"
+
+// Permission is one way of being allowed an action: holding a job role in an organisation with OrgRole.
+// An empty OrgRole accepts any organisation and an empty Job any identity of the organisation.
+type Permission struct {
+	OrgRole string
+	Job     string
+}
+
+func (p Permission) String() string {
+	switch {
+	case p.OrgRole == "":
+		return p.Job
+	case p.Job == "":
+		return p.OrgRole
+	default:
+		return p.OrgRole + "/" + p.Job
+	}
+}
+
+// The permissions transactions grant
+var (
+	InsurerUnderwriter = Permission{RoleInsurer, JobUnderwriter}
+	InsurerAdjuster    = Permission{RoleInsurer, JobAdjuster}
+	InsurerAuditor     = Permission{RoleInsurer, JobAuditor}
+	ProviderClinician  = Permission{RoleProvider, JobClinician}
+	ProviderAuditor    = Permission{RoleProvider, JobAuditor}
+	RegulatorAuditor   = Permission{RoleRegulator, JobAuditor}
+	RegistryAdmin      = Permission{RoleRegistryAdmin, JobOrgAdmin}
+	AnyMember          = Permission{Job: JobMember}
+)
+
+// AccessDeniedError is returned by every authorisation check that refuses the caller
+type AccessDeniedError struct {
+	Action   string
+	Requires []string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("access denied: cannot %s without %s", e.Action, strings.Join(e.Requires, " or "))
+}
+
+// Denied builds the error for an action refused for want of the listed requirements
+func Denied(action string, requires ...string) error {
+	return &AccessDeniedError{Action: action, Requires: requires}
+}
+
+// IsDenied tells a refusal apart from a failure to evaluate the check
+func IsDenied(err error) bool {
+	var denied *AccessDeniedError
+	return errors.As(err, &denied)
+}
+
+// Checker evaluates permissions with the lookups of one chaincode
+type Checker struct {
+	// UserID returns the member the caller acts as, or "" for an organisation identity
+	UserID func(ctx contractapi.TransactionContextInterface) (string, error)
+	// OrgRoles returns the roles the organisation registry gives the caller's organisation
+	OrgRoles func(ctx contractapi.TransactionContextInterface) ([]string, error)
+}
+
+// Authorize fails with an AccessDeniedError unless the caller holds at least one of the permissions.
+// Identities carrying a userId act only as members, whatever their organisation. Organisation roles are
+// looked up at most once per check.
+func (c Checker) Authorize(ctx contractapi.TransactionContextInterface, action string, allowed ...Permission) error {
+	userID, err := c.UserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var orgRoles []string
+	requires := make([]string, 0, len(allowed))
+	for _, p := range allowed {
+		requires = append(requires, p.String())
+
+		if userID != "" || p.Job == JobMember {
+			if userID != "" && p.Job == JobMember {
+				return nil
+			}
+			continue
+		}
+
+		if p.OrgRole != "" {
+			if orgRoles == nil {
+				orgRoles, err = c.OrgRoles(ctx)
+				if err != nil {
+					return err
+				}
+				if orgRoles == nil {
+					orgRoles = []string{}
+				}
+			}
+			if !ContainsRole(orgRoles, p.OrgRole) {
+				continue
+			}
+		}
+
+		if p.Job == "" {
+			return nil
+		}
+		hasJob, err := HasJob(ctx, p.Job)
+		if err != nil {
+			return err
+		}
+		if hasJob {
+			return nil
+		}
+	}
+
+	return Denied(action, requires...)
+}
+
+// Holds is Authorize for callers that branch on the outcome instead of refusing
+func (c Checker) Holds(ctx contractapi.TransactionContextInterface, allowed ...Permission) (bool, error) {
+	err := c.Authorize(ctx, "", allowed...)
+	if IsDenied(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// HasJob tells whether the caller holds a job role through its attribute or as an org admin. JobOrgAdmin is
+// only held as an org admin.
+func HasJob(ctx contractapi.TransactionContextInterface, job string) (bool, error) {
+	if job != JobOrgAdmin {
+		hasAttribute, err := HasAttribute(ctx, job)
+		if err != nil || hasAttribute {
+			return hasAttribute, err
+		}
+	}
+
+	return IsOrgAdmin(ctx)
+}
+
+// HasAttribute tells whether the caller's certificate carries the attribute set to "true"
+func HasAttribute(ctx contractapi.TransactionContextInterface, attribute string) (bool, error) {
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue(attribute)
+	if err != nil {
+		return false, fmt.Errorf("failed to read client attributes: %v", err)
+	}
+
+	return found && value == "true", nil
+}
+
+// IsOrgAdmin tells whether the caller's certificate is an org admin certificate
+func IsOrgAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return false, fmt.Errorf("failed to read client certificate: %v", err)
+	}
+	if cert == nil {
+		return false, nil
+	}
+
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if ou == adminOU {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ContainsRole tells whether role is among roles
+func ContainsRole(roles []string, role string) bool {
+	for _, held := range roles {
+		if held == role {
+			return true
+		}
+	}
+	return false
+}
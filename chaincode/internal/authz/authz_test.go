@@ -0,0 +1,148 @@
+package authz
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// fakeIdentity is a client identity with the given MSP, attributes and, for admins, an admin certificate
+type fakeIdentity struct {
+	mspID string
+	attrs map[string]string
+	admin bool
+}
+
+func (f *fakeIdentity) GetID() (string, error)    { return "x509::CN=" + f.mspID, nil }
+func (f *fakeIdentity) GetMSPID() (string, error) { return f.mspID, nil }
+
+func (f *fakeIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := f.attrs[name]
+	return value, found, nil
+}
+
+func (f *fakeIdentity) AssertAttributeValue(name, value string) error {
+	if f.attrs[name] != value {
+		return errors.New("attribute mismatch")
+	}
+	return nil
+}
+
+func (f *fakeIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	if !f.admin {
+		return &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"client"}}}, nil
+	}
+	return &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{adminOU}}}, nil
+}
+
+func newContext(identity *fakeIdentity) *contractapi.TransactionContext {
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetClientIdentity(identity)
+	return ctx
+}
+
+// newChecker gives every caller the roles and, when set, the member userID
+func newChecker(roles []string, userID string) Checker {
+	return Checker{
+		UserID: func(contractapi.TransactionContextInterface) (string, error) { return userID, nil },
+		OrgRoles: func(contractapi.TransactionContextInterface) ([]string, error) {
+			return roles, nil
+		},
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name     string
+		roles    []string
+		userID   string
+		identity *fakeIdentity
+		allowed  []Permission
+		want     bool
+	}{
+		{"job in org with role", []string{RoleInsurer}, "", &fakeIdentity{attrs: map[string]string{JobAdjuster: "true"}}, []Permission{InsurerAdjuster}, true},
+		{"job attribute not true", []string{RoleInsurer}, "", &fakeIdentity{attrs: map[string]string{JobAdjuster: "false"}}, []Permission{InsurerAdjuster}, false},
+		{"other job", []string{RoleInsurer}, "", &fakeIdentity{attrs: map[string]string{JobAdjuster: "true"}}, []Permission{InsurerUnderwriter}, false},
+		{"job in org without role", []string{RoleProvider}, "", &fakeIdentity{attrs: map[string]string{JobAdjuster: "true"}}, []Permission{InsurerAdjuster}, false},
+		{"unregistered org", nil, "", &fakeIdentity{attrs: map[string]string{JobAdjuster: "true"}}, []Permission{InsurerAdjuster}, false},
+		{"any of several", []string{RoleProvider}, "", &fakeIdentity{attrs: map[string]string{JobClinician: "true"}}, []Permission{InsurerAdjuster, ProviderClinician}, true},
+		{"admin holds every job", []string{RoleInsurer}, "", &fakeIdentity{admin: true}, []Permission{InsurerUnderwriter}, true},
+		{"admin still needs the org role", []string{RoleProvider}, "", &fakeIdentity{admin: true}, []Permission{InsurerUnderwriter}, false},
+		{"org role alone", []string{RoleRegistryAdmin}, "", &fakeIdentity{}, []Permission{{OrgRole: RoleRegistryAdmin}}, true},
+		{"registry admin org's admin", []string{RoleRegistryAdmin}, "", &fakeIdentity{admin: true}, []Permission{RegistryAdmin}, true},
+		{"registry admin org's other identities", []string{RoleRegistryAdmin}, "", &fakeIdentity{attrs: map[string]string{JobAdjuster: "true"}}, []Permission{RegistryAdmin}, false},
+		{"org admin attribute is not an admin certificate", []string{RoleRegistryAdmin}, "", &fakeIdentity{attrs: map[string]string{JobOrgAdmin: "true"}}, []Permission{RegistryAdmin}, false},
+		{"any org with job", nil, "", &fakeIdentity{attrs: map[string]string{JobAdjuster: "true"}}, []Permission{{Job: JobAdjuster}}, true},
+		{"member as member", []string{RoleInsurer}, "user1", &fakeIdentity{}, []Permission{AnyMember}, true},
+		{"member never acts for the org", []string{RoleInsurer}, "user1", &fakeIdentity{attrs: map[string]string{JobAdjuster: "true"}, admin: true}, []Permission{InsurerAdjuster}, false},
+		{"org identity is no member", []string{RoleInsurer}, "", &fakeIdentity{admin: true}, []Permission{AnyMember}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newChecker(tt.roles, tt.userID).Authorize(newContext(tt.identity), "act", tt.allowed...)
+			if tt.want && err != nil {
+				t.Fatalf("expected access, got %v", err)
+			}
+			if !tt.want && !IsDenied(err) {
+				t.Fatalf("expected an AccessDeniedError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizeListsRequirements(t *testing.T) {
+	err := newChecker([]string{RoleProvider}, "").Authorize(newContext(&fakeIdentity{}), "settle claims", InsurerAdjuster, AnyMember)
+
+	want := "access denied: cannot settle claims without insurer/adjuster or member"
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+}
+
+func TestAuthorizeLooksUpOrgRolesOnce(t *testing.T) {
+	lookups := 0
+	checker := Checker{
+		UserID: func(contractapi.TransactionContextInterface) (string, error) { return "", nil },
+		OrgRoles: func(contractapi.TransactionContextInterface) ([]string, error) {
+			lookups++
+			return nil, nil
+		},
+	}
+
+	err := checker.Authorize(newContext(&fakeIdentity{}), "act", InsurerAdjuster, InsurerAuditor, ProviderClinician)
+	if !IsDenied(err) {
+		t.Fatalf("expected an AccessDeniedError, got %v", err)
+	}
+	if lookups != 1 {
+		t.Fatalf("expected one role lookup, got %d", lookups)
+	}
+}
+
+func TestHolds(t *testing.T) {
+	ctx := newContext(&fakeIdentity{attrs: map[string]string{JobAuditor: "true"}})
+
+	held, err := newChecker([]string{RoleInsurer}, "").Holds(ctx, InsurerAuditor)
+	if err != nil || !held {
+		t.Fatalf("expected the permission to be held, got %v, %v", held, err)
+	}
+
+	held, err = newChecker([]string{RoleInsurer}, "").Holds(ctx, InsurerAdjuster)
+	if err != nil || held {
+		t.Fatalf("expected the permission not to be held without error, got %v, %v", held, err)
+	}
+
+	failing := Checker{
+		UserID: func(contractapi.TransactionContextInterface) (string, error) { return "", nil },
+		OrgRoles: func(contractapi.TransactionContextInterface) ([]string, error) {
+			return nil, errors.New("registry unavailable")
+		},
+	}
+	held, err = failing.Holds(ctx, InsurerAuditor)
+	if err == nil || IsDenied(err) || held {
+		t.Fatalf("expected the lookup failure, got %v, %v", held, err)
+	}
+}
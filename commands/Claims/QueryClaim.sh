@@ -1 +1,2 @@
-peer chaincode query -C mychannel -n registration -c '{"function":"QueryClaim","Args":["user123"]}'
+peer chaincode query -C mychannel -n claims -c '{"function":"QueryClaim","Args":["CLM-0123456789abcdef"]}'
+peer chaincode query -C mychannel -n claims -c '{"function":"QueryClaimsByUser","Args":["user123","10",""]}'
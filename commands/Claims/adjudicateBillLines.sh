@@ -0,0 +1 @@
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"AdjudicateBillLines","Args":["CLM-0123456789abcdef","[{\"lineId\":\"1\",\"allowed\":true,\"allowedAmount\":2100,\"reasonCode\":\"ROOM_RATE_CAP\"},{\"lineId\":\"2\",\"allowed\":true}]"]}'
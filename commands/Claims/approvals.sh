@@ -0,0 +1,8 @@
+# Claims under policy123 settling for more than 100000 need two adjuster approvals
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"SetApprovalRule","Args":["policy123","100000","2"]}'
+
+# Run once by each adjuster, with a certificate carrying adjuster=true
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"ApproveClaimSettlement","Args":["CLM-0123456789abcdef","250000","Reviewed discharge summary"]}'
+
+# Settle once enough approvals are in
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"ApproveClaim","Args":["CLM-0123456789abcdef","250000","Approved by two adjusters"]}'
@@ -0,0 +1,7 @@
+# Rank a member's policies; the first is claimed by ProcessClaim and the second by ProcessSecondaryClaim
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n registration $PEER_CONN_PARMS -c '{"function":"SetPayerOrder","Args":["user123","policy123","policy456"]}'
+
+# Claim what the primary payer left of an episode's charges with the secondary payer
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"ProcessSecondaryClaim","Args":["EP-0123456789abcdef"]}'
+
+peer chaincode query -C mychannel -n claims -c '{"function":"QueryBenefitCoordination","Args":["user123","EP-0123456789abcdef"]}'
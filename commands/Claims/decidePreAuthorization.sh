@@ -0,0 +1 @@
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"DecidePreAuthorization","Args":["PA-0123456789abcdef","true","35000.0","2024-01-01","2024-01-31","Standard chemotherapy package"]}'
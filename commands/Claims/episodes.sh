@@ -0,0 +1,12 @@
+# Open an episode of care; the episode ID is returned in the payload
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"AdmitPatient","Args":["user123","Hospital A","2024-06-01","Chest pain"]}'
+
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"RecordDiagnosis","Args":["EP-0123456789abcdef","Cancer"]}'
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"RecordTreatment","Args":["EP-0123456789abcdef","Chemotherapy"]}'
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"DischargePatient","Args":["EP-0123456789abcdef","2024-06-14","Stable"]}'
+
+# Claim a specific episode
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"ProcessEpisodeClaim","Args":["EP-0123456789abcdef"]}'
+
+# List a patient's episodes with their claim status
+peer chaincode query -C mychannel -n claims -c '{"function":"QueryPatientEpisodes","Args":["user123"]}'
@@ -0,0 +1,2 @@
+# Adjudicate up to 25 discharged episodes per transaction; invoke again while "remaining" is true in the payload
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"ProcessPendingClaims","Args":["25"]}'
@@ -0,0 +1 @@
+peer chaincode query -C mychannel -n claims -c '{"function":"QueryClaimsByCriteria","Args":["Approved","Hospital A","2024-01-01","2024-12-31"]}'
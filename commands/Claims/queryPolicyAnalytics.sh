@@ -0,0 +1 @@
+peer chaincode query -C mychannel -n claims -c '{"function":"QueryPolicyAnalytics","Args":["policy123","2024-06"]}'
@@ -0,0 +1,2 @@
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"RecordClaimPayment","Args":["CLM-0123456789abcdef","hospital","12500.0","NEFT-2024-000123"]}'
+peer chaincode query -C mychannel -n claims -c '{"function":"ReconcileClaimPayments","Args":[]}'
@@ -0,0 +1 @@
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"RegisterProvider","Args":["hospitalA","Hospital A","Org1MSP","InNetwork","{\"CHEMO-01\": 4500.0}"]}'
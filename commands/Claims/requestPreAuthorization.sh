@@ -0,0 +1 @@
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"RequestPreAuthorization","Args":["user123","policy123","Cancer","40000.0"]}'
@@ -0,0 +1,4 @@
+# Reset a claim's endorsers to its hospital and insurer; both must endorse this transaction
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"RotateClaimEndorsement","Args":["CLM-0123456789abcdef",""]}'
+
+peer chaincode query -C mychannel -n claims -c '{"function":"QueryClaimEndorsement","Args":["CLM-0123456789abcdef"]}'
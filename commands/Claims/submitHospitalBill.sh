@@ -0,0 +1 @@
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n claims $PEER_CONN_PARMS -c '{"function":"SubmitHospitalBill","Args":["EP-0123456789abcdef","[{\"lineId\":\"1\",\"category\":\"room\",\"description\":\"General ward\",\"quantity\":14,\"unitAmount\":200,\"amount\":2800},{\"lineId\":\"2\",\"category\":\"procedure\",\"code\":\"CHEMO-01\",\"description\":\"Chemotherapy cycle\",\"quantity\":2,\"unitAmount\":5000,\"amount\":10000}]"]}'
@@ -0,0 +1,11 @@
+# Seed the registry once, straight after deploying the registration chaincode, as an admin of a seeded registry admin
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n registration $PEER_CONN_PARMS -c '{"function":"OrgRegistryContract:InitRegistry","Args":["{\"orgs\":[{\"mspId\":\"Org1MSP\",\"name\":\"Org1\",\"roles\":[\"provider\"]},{\"mspId\":\"Org2MSP\",\"name\":\"Org2\",\"roles\":[\"insurer\",\"registryAdmin\"]}],\"legacyInsurerMsp\":\"Org2MSP\",\"legacyProviderMsp\":\"Org1MSP\"}"]}'
+
+# Give Org3 the insurer role; roles replace any the org already holds
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n registration $PEER_CONN_PARMS -c '{"function":"OrgRegistryContract:RegisterOrg","Args":["Org3MSP","Org3","[\"insurer\"]"]}'
+
+peer chaincode query -C mychannel -n registration -c '{"function":"OrgRegistryContract:QueryOrg","Args":["Org3MSP"]}'
+
+peer chaincode query -C mychannel -n registration -c '{"function":"OrgRegistryContract:QueryAllOrgs","Args":[]}'
+
+peer chaincode query -C mychannel -n registration -c '{"function":"OrgRegistryContract:QueryRegistryDefaults","Args":[]}'
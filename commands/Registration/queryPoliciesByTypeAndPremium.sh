@@ -0,0 +1 @@
+peer chaincode query -C mychannel -n registration -c '{"function":"QueryPoliciesByTypeAndPremium","Args":["HealthInsurance","100.0","1000.0"]}'
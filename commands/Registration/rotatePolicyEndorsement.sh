@@ -0,0 +1,4 @@
+# Require both Org2 and Org3 to endorse changes to policy123; endorse with the policy's current endorsers
+peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile $ORDERER_CA -C mychannel -n registration $PEER_CONN_PARMS -c '{"function":"RotatePolicyEndorsement","Args":["policy123","[\"Org2MSP\",\"Org3MSP\"]"]}'
+
+peer chaincode query -C mychannel -n registration -c '{"function":"QueryPolicyEndorsement","Args":["policy123"]}'
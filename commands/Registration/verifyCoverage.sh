@@ -0,0 +1 @@
+peer chaincode query -C mychannel -n registration -c '{"function":"VerifyCoverage","Args":["user123","policy123","2024-06-01"]}'
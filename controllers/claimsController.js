@@ -1,9 +1,11 @@
 // controllers/claimsController.js
 
 const connectToNetwork = require('../network/connect');
+const { connectAsMember } = require('../network/connect');
 
 const REGISTRATION_CONTRACT = 'registration'; // Name of the Registration chaincode
 const CLAIMS_CONTRACT = 'claims'; // Name of the Claims chaincode
+const MAX_MVCC_RETRIES = 3; // Resubmissions of a claim that lost an MVCC race
 
 module.exports = {
     uploadPatientDetails: async (req, res) => {
@@ -12,7 +14,7 @@ module.exports = {
             const network = await connectToNetwork('org1', 'Admin@org1.example.com');
             const contract = network.getContract(CLAIMS_CONTRACT);
 
-            await contract.submitTransaction(
+            const episodeID = await contract.submitTransaction(
                 'UploadPatientDetails',
                 userID,
                 diseaseDiagnosis,
@@ -22,7 +24,7 @@ module.exports = {
                 dischargeDate
             );
 
-            res.status(200).send(`Patient details for ${userID} uploaded successfully.`);
+            res.status(200).send(`Patient details for ${userID} uploaded as episode ${episodeID.toString()}.`);
         } catch (error) {
             console.error('Error uploading patient details:', error);
             res.status(500).json({ error: error.message });
@@ -35,22 +37,66 @@ module.exports = {
             const network = await connectToNetwork('org2', 'Admin@org2.example.com');
             const contract = network.getContract(CLAIMS_CONTRACT);
 
-            await contract.submitTransaction('ProcessClaim', userID);
+            // Concurrent claims for the same member race on its cover balance; the loser
+            // fails MVCC validation and is resubmitted against the updated balance
+            let claimID;
+            for (let attempt = 1; ; attempt++) {
+                try {
+                    claimID = await contract.submitTransaction('ProcessClaim', userID);
+                    break;
+                } catch (error) {
+                    if (attempt >= MAX_MVCC_RETRIES || !String(error.message).includes('MVCC_READ_CONFLICT')) {
+                        throw error;
+                    }
+                }
+            }
 
-            res.status(200).send(`Claim for user ${userID} processed successfully.`);
+            res.status(200).send(`Claim ${claimID.toString()} for user ${userID} processed successfully.`);
         } catch (error) {
             console.error('Error processing claim:', error);
             res.status(500).json({ error: error.message });
         }
     },
 
+    processPendingClaims: async (req, res) => {
+        const limit = req.body.limit || 25;
+        try {
+            const network = await connectToNetwork('org2', 'Admin@org2.example.com');
+            const contract = network.getContract(CLAIMS_CONTRACT);
+
+            // Each batch is one transaction; keep submitting until no pending episodes remain
+            const results = [];
+            let remaining = true;
+            while (remaining) {
+                let batch;
+                for (let attempt = 1; ; attempt++) {
+                    try {
+                        batch = JSON.parse((await contract.submitTransaction('ProcessPendingClaims', limit.toString())).toString());
+                        break;
+                    } catch (error) {
+                        if (attempt >= MAX_MVCC_RETRIES || !String(error.message).includes('MVCC_READ_CONFLICT')) {
+                            throw error;
+                        }
+                    }
+                }
+                results.push(...batch.results);
+                remaining = batch.remaining;
+            }
+
+            res.status(200).json(results);
+        } catch (error) {
+            console.error('Error processing pending claims:', error);
+            res.status(500).json({ error: error.message });
+        }
+    },
+
     queryClaim: async (req, res) => {
-        const { userID } = req.params;
+        const { claimID } = req.params;
         try {
             const network = await connectToNetwork('org2', 'Admin@org2.example.com');
             const contract = network.getContract(CLAIMS_CONTRACT);
 
-            const result = await contract.evaluateTransaction('QueryClaim', userID);
+            const result = await contract.evaluateTransaction('QueryClaim', claimID);
             res.status(200).json(JSON.parse(result.toString()));
         } catch (error) {
             console.error('Error querying claim:', error);
@@ -58,6 +104,37 @@ module.exports = {
         }
     },
 
+    queryClaimsByUser: async (req, res) => {
+        const { userID } = req.params;
+        const { pageSize = '10', bookmark = '' } = req.query;
+        try {
+            // Members see their own claims under their own identity
+            const network = await connectAsMember(userID, 'org2', 'Admin@org2.example.com');
+            const contract = network.getContract(CLAIMS_CONTRACT);
+
+            const result = await contract.evaluateTransaction('QueryClaimsByUser', userID, pageSize, bookmark);
+            res.status(200).json(JSON.parse(result.toString()));
+        } catch (error) {
+            console.error('Error querying claims by user:', error);
+            res.status(500).json({ error: error.message });
+        }
+    },
+
+    queryClaimsByPolicy: async (req, res) => {
+        const { policyID } = req.params;
+        const { pageSize = '10', bookmark = '' } = req.query;
+        try {
+            const network = await connectToNetwork('org2', 'Admin@org2.example.com');
+            const contract = network.getContract(CLAIMS_CONTRACT);
+
+            const result = await contract.evaluateTransaction('QueryClaimsByPolicy', policyID, pageSize, bookmark);
+            res.status(200).json(JSON.parse(result.toString()));
+        } catch (error) {
+            console.error('Error querying claims by policy:', error);
+            res.status(500).json({ error: error.message });
+        }
+    },
+
     queryAllPatientData: async (req, res) => {
         try {
             const network = await connectToNetwork('org2', 'Admin@org2.example.com'); // Update org and admin user as needed
@@ -1,6 +1,7 @@
 // controllers/insuranceController.js
 
 const connectToNetwork = require('../network/connect');
+const { connectAsMember } = require('../network/connect');
 
 const CONTRACT_NAME = 'registration'; // Name of the Registration chaincode
 
@@ -49,7 +50,7 @@ module.exports = {
         const { userID, policyID, premiumPaid, isNonSmoker, hasDisease, consent } = req.body;
         try {
             console.log("connecting")
-            const network = await connectToNetwork('org1', 'Admin@org1.example.com');//org1 check
+            const network = await connectAsMember(userID, 'org1', 'Admin@org1.example.com');//org1 check
             console.log("connected")
             const contract = network.getContract(CONTRACT_NAME);
             console.log(userID)
@@ -76,6 +77,21 @@ module.exports = {
         }
     },
 
+    enrolMember: async (req, res) => {
+        const { userID } = req.body;
+        try {
+            // Only the member's own certificate, carrying userId=<userID>, can enrol
+            const network = await connectToNetwork('org1', userID);
+            const contract = network.getContract(CONTRACT_NAME);
+
+            await contract.submitTransaction('EnrolMember', userID);
+            res.status(200).send(`Member ${userID} enrolled successfully.`);
+        } catch (error) {
+            console.error('Error enrolling member:', error);
+            res.status(500).json({ error: error.message });
+        }
+    },
+
     queryRegistration: async (req, res) => {
         const { userId, policyId } = req.params;
         try {
@@ -40,4 +40,27 @@ const connectToNetwork = async (org, user) => {
     return network;
 };
 
+// Members are enrolled with Org1's CA and connect through Org1's peers
+const MEMBER_ORG = 'org1';
+
+/**
+ * Connects as a member's own identity when the wallet holds one labelled with their userID,
+ * otherwise as the fallback identity, which cannot register or consent for members who have enrolled.
+ * @param {string} userID - The member's userID.
+ * @param {string} fallbackOrg - The organization of the fallback identity.
+ * @param {string} fallbackUser - The identity label to use when the member has no identity in the wallet.
+ * @returns {Promise<Network>} - The Fabric network object.
+ */
+const connectAsMember = async (userID, fallbackOrg, fallbackUser) => {
+    const walletPath = path.resolve(__dirname, '..', 'wallet');
+    const wallet = await Wallets.newFileSystemWallet(walletPath);
+
+    const identity = await wallet.get(userID);
+    if (!identity) {
+        return connectToNetwork(fallbackOrg, fallbackUser);
+    }
+    return connectToNetwork(MEMBER_ORG, userID);
+};
+
 module.exports = connectToNetwork;
+module.exports.connectAsMember = connectAsMember;